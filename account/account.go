@@ -0,0 +1,26 @@
+package account
+
+import (
+	"core"
+)
+
+const (
+	LAYOUT = "templates/layout.html"
+)
+
+var (
+	Router = core.Router
+)
+
+func init() {
+	Router.HandleFunc("/profile/", ProfileHandler).Name("profile")
+	Router.HandleFunc("/login/", LoginHandler).Name("login")
+	Router.HandleFunc("/login/{provider}/", LoginProviderHandler).Name("loginProvider")
+	Router.HandleFunc("/login/{provider}/callback/", LoginCallbackHandler).Name("loginCallback")
+	Router.HandleFunc("/logout/", LogoutHandler).Name("logout")
+	Router.HandleFunc("/register/", RegisterHandler).Name("register")
+	Router.HandleFunc("/admin/users/", UserRolesHandler).Name("userRoles")
+	Router.HandleFunc("/profile/tokens/", APITokenCreateHandler).Name("apiTokenCreate")
+	Router.HandleFunc("/users/{id:[0-9]+}/", UserHandler).Name("userProfile")
+	Router.HandleFunc("/profile/tokens/{id:[0-9]+}/revoke/", APITokenRevokeHandler).Name("apiTokenRevoke")
+}
@@ -0,0 +1,70 @@
+//go:build appengine
+// +build appengine
+
+package account
+
+import (
+	"net/http"
+
+	"appengine"
+	"appengine/blobstore"
+	"appengine/image"
+	"github.com/vmihailenco/gforms/gaeforms"
+
+	"core/store"
+	"core/store/gae"
+)
+
+const AVATAR_UPLOAD = true
+
+// parseProfileForm validates profile form posted through blobstore
+// upload URL and returns uploaded avatar if any.
+func parseProfileForm(c store.Context, r *http.Request, form *ProfileForm) (bool, *avatar, error) {
+	ac := gae.AppengineContext(c)
+
+	blobs, values, err := blobstore.ParseUpload(r)
+	if err != nil {
+		return false, nil, err
+	}
+	isValid := gaeforms.IsBlobstoreFormValid(form, blobs, values)
+
+	var blobInfo *blobstore.BlobInfo
+	for name, blobInfos := range blobs {
+		for _, info := range blobInfos {
+			if name == "Avatar" && blobInfo == nil {
+				blobInfo = info
+			} else {
+				deleteAvatar(c, string(info.BlobKey))
+			}
+		}
+	}
+	if blobInfo == nil {
+		return isValid, nil, nil
+	}
+
+	if !avatarContentTypes[blobInfo.ContentType] || blobInfo.Size > MAX_AVATAR_SIZE {
+		deleteAvatar(c, string(blobInfo.BlobKey))
+		return isValid, nil, errInvalidAvatar
+	}
+
+	servingURL, err := image.ServingURL(ac, blobInfo.BlobKey, &image.ServingURLOptions{
+		Size: AVATAR_SIZE,
+		Crop: true,
+	})
+	if err != nil {
+		deleteAvatar(c, string(blobInfo.BlobKey))
+		return false, nil, err
+	}
+
+	return isValid, &avatar{
+		BlobKey: string(blobInfo.BlobKey),
+		URL:     servingURL.String(),
+	}, nil
+}
+
+func deleteAvatar(c store.Context, blobKey string) {
+	err := blobstore.Delete(gae.AppengineContext(c), appengine.BlobKey(blobKey))
+	if err != nil {
+		c.Errorf("error deleting avatar: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package account
+
+import (
+	"strings"
+
+	"github.com/vmihailenco/gforms"
+
+	"auth"
+)
+
+type APITokenForm struct {
+	*gforms.BaseForm
+	Name          *gforms.StringField
+	CanWrite      *gforms.BoolField
+	ExpiresInDays *gforms.StringField
+}
+
+func NewAPITokenForm() *APITokenForm {
+	name := gforms.NewStringField()
+	name.MinLen = 1
+	name.MaxLen = 100
+	name.Label = "Token name"
+
+	canWrite := gforms.NewBoolField()
+	canWrite.IsRequired = false
+	canWrite.Label = "Allow changes (otherwise read only)"
+
+	expiresInDays := gforms.NewStringField()
+	expiresInDays.IsRequired = false
+	expiresInDays.Label = "Expires in days (empty for never)"
+
+	f := &APITokenForm{
+		BaseForm:      &gforms.BaseForm{},
+		Name:          name,
+		CanWrite:      canWrite,
+		ExpiresInDays: expiresInDays,
+	}
+	gforms.InitForm(f)
+
+	return f
+}
+
+type LoginForm struct {
+	*gforms.BaseForm
+	Username *gforms.StringField
+	Password *gforms.StringField
+}
+
+func NewLoginForm() *LoginForm {
+	username := gforms.NewStringField()
+	username.MaxLen = 50
+	username.Label = "Username"
+
+	password := gforms.NewStringField()
+	password.Label = "Password"
+
+	f := &LoginForm{
+		BaseForm: &gforms.BaseForm{},
+		Username: username,
+		Password: password,
+	}
+	gforms.InitForm(f)
+
+	return f
+}
+
+type RegisterForm struct {
+	*gforms.BaseForm
+	Username        *gforms.StringField
+	Password        *gforms.StringField
+	PasswordConfirm *gforms.StringField
+}
+
+func NewRegisterForm() *RegisterForm {
+	username := gforms.NewStringField()
+	username.MaxLen = 50
+	username.Label = "Username"
+
+	password := gforms.NewStringField()
+	password.Label = "Password"
+
+	passwordConfirm := gforms.NewStringField()
+	passwordConfirm.Label = "Password again"
+
+	f := &RegisterForm{
+		BaseForm:        &gforms.BaseForm{},
+		Username:        username,
+		Password:        password,
+		PasswordConfirm: passwordConfirm,
+	}
+	gforms.InitForm(f)
+
+	return f
+}
+
+type ProfileForm struct {
+	*gforms.BaseForm
+	DisplayName *gforms.StringField
+	Bio         *gforms.StringField
+	Website     *gforms.StringField
+	Links       *gforms.StringField
+}
+
+func NewProfileForm(user *auth.User) *ProfileForm {
+	displayName := gforms.NewStringField()
+	displayName.IsRequired = false
+	displayName.MaxLen = 100
+	displayName.Label = "Display name"
+
+	bio := gforms.NewTextareaStringField()
+	bio.IsRequired = false
+	bio.MaxLen = 5000
+	bio.Label = "Bio (markdown)"
+
+	website := gforms.NewStringField()
+	website.IsRequired = false
+	website.MaxLen = 500
+	website.Label = "Website"
+
+	links := gforms.NewTextareaStringField()
+	links.IsRequired = false
+	links.Label = "Social links (one per line)"
+
+	displayName.SetInitial(user.DisplayName)
+	bio.SetInitial(user.Bio())
+	website.SetInitial(user.Website)
+	links.SetInitial(strings.Join(user.Links, "\n"))
+
+	f := &ProfileForm{
+		BaseForm:    &gforms.BaseForm{},
+		DisplayName: displayName,
+		Bio:         bio,
+		Website:     website,
+		Links:       links,
+	}
+	gforms.InitForm(f)
+
+	return f
+}
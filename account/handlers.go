@@ -0,0 +1,225 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.google.com/p/gorilla/mux"
+	"github.com/vmihailenco/gforms"
+
+	"auth"
+	"core"
+	"core/store"
+	"tmplt"
+)
+
+var (
+	errInvalidExpiresInDays = errors.New("Enter number of days.")
+	errOwnRole              = errors.New("You can't change your own role.")
+)
+
+// parseTTL parses token lifetime in days. Empty value means forever.
+func parseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	days, err := strconv.Atoi(s)
+	if err != nil || days < 1 {
+		return 0, errInvalidExpiresInDays
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// renderProfile renders profile page of the user with forms and API
+// tokens. Forms missing in context are created from the user.
+func renderProfile(c store.Context, w http.ResponseWriter, user *auth.User, context tmplt.Context) {
+	if _, ok := context["profileForm"]; !ok {
+		context["profileForm"] = NewProfileForm(user)
+	}
+	if _, ok := context["tokenForm"]; !ok {
+		context["tokenForm"] = NewAPITokenForm()
+	}
+	context["avatarUpload"] = AVATAR_UPLOAD
+
+	tokens, err := auth.GetUserAPITokens(c, user)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	context["tokens"] = tokens
+
+	core.RenderTemplate(c, w, context,
+		"templates/profile.html", "templates/account/apiTokens.html", LAYOUT)
+}
+
+func ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	user := core.AuthUser(c, w)
+	if user == nil {
+		return
+	}
+
+	context := tmplt.Context{}
+	if r.Method == "POST" {
+		form := NewProfileForm(user)
+		context["profileForm"] = form
+
+		isValid, avatar, err := parseProfileForm(c, r, form)
+		if _, ok := err.(avatarError); ok {
+			context["avatarError"] = err
+		} else if err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+
+		website, websiteErr := parseURL(form.Website.Value())
+		links, linksErr := parseLinks(form.Links.Value())
+		context["websiteError"] = websiteErr
+		context["linksError"] = linksErr
+
+		if isValid && err == nil && websiteErr == nil && linksErr == nil {
+			oldAvatar := user.AvatarBlobKey
+			err := updateProfile(c, user, form.DisplayName.Value(), form.Bio.Value(), website, links, avatar)
+			if err != nil {
+				core.HandleError(c, w, err)
+				return
+			}
+			if avatar != nil && oldAvatar != "" {
+				deleteAvatar(c, oldAvatar)
+			}
+			http.Redirect(w, r, r.URL.Path, 302)
+			return
+		}
+
+		if avatar != nil {
+			deleteAvatar(c, avatar.BlobKey)
+		}
+	}
+
+	renderProfile(c, w, user, context)
+}
+
+func APITokenCreateHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	user := core.AuthUser(c, w)
+	if user == nil {
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	form := NewAPITokenForm()
+	context := tmplt.Context{"tokenForm": form}
+
+	isValid := gforms.IsFormValid(form, r.Form)
+	ttl, ttlErr := parseTTL(form.ExpiresInDays.Value())
+	if isValid && ttlErr == nil {
+		scopes := []string{auth.SCOPE_READ}
+		if form.CanWrite.Value() {
+			scopes = append(scopes, auth.SCOPE_WRITE)
+		}
+		_, secret, err := auth.CreateAPIToken(c, user, form.Name.Value(), scopes, ttl)
+		if err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+		context["newToken"] = secret
+		context["tokenForm"] = NewAPITokenForm()
+	}
+	context["expiresInDaysError"] = ttlErr
+
+	renderProfile(c, w, user, context)
+}
+
+func APITokenRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	user := core.AuthUser(c, w)
+	if user == nil {
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	err = auth.RevokeAPIToken(c, user, id)
+	if err == store.ErrNoSuchEntity {
+		core.HandleNotFound(c, w)
+		return
+	} else if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/profile/#api-tokens", 302)
+}
+
+func UserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	user := core.RequirePermission(c, w, auth.PERM_USER_MANAGE, nil)
+	if user == nil {
+		return
+	}
+
+	context := tmplt.Context{}
+	if r.Method == "POST" {
+		key, err := store.DecodeKey(r.FormValue("key"))
+		if err != nil {
+			core.HandleNotFound(c, w)
+			return
+		}
+		target, err := auth.GetUser(c, key)
+		if err == store.ErrNoSuchEntity {
+			core.HandleNotFound(c, w)
+			return
+		} else if err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+
+		// admins can't lock themselves out
+		if target.Key().Equal(user.Key()) {
+			context["roleError"] = errOwnRole
+		} else if err := auth.SetRole(c, target, r.FormValue("role")); err == auth.ErrInvalidRole {
+			context["roleError"] = err
+		} else if err != nil {
+			core.HandleError(c, w, err)
+			return
+		} else {
+			http.Redirect(w, r, r.URL.Path, 302)
+			return
+		}
+	}
+
+	users, err := auth.GetUsers(c)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	context["users"] = users
+	context["roles"] = auth.Roles
+	core.RenderTemplate(c, w, context, "templates/account/userRoles.html", LAYOUT)
+}
@@ -0,0 +1,243 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"code.google.com/p/gorilla/mux"
+	"github.com/vmihailenco/gforms"
+
+	"auth"
+	"core"
+	"core/store"
+	"tmplt"
+)
+
+var (
+	errPasswordMismatch = errors.New("Passwords do not match.")
+)
+
+// nextURL returns local URL to redirect to after login or logout.
+func nextURL(r *http.Request) string {
+	next := r.FormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func localProvider() *auth.LocalProvider {
+	p, _ := auth.GetProvider(auth.LOCAL_PROVIDER).(*auth.LocalProvider)
+	return p
+}
+
+func callbackURL(r *http.Request, p *auth.OIDCProvider) (string, error) {
+	if p.RedirectURL != "" {
+		return p.RedirectURL, nil
+	}
+	u, err := Router.GetRoute("loginCallback").URL("provider", p.Name())
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	u.Host = r.Host
+	return u.String(), nil
+}
+
+func renderLogin(c store.Context, w http.ResponseWriter, form *LoginForm, loginErr error) {
+	context := tmplt.Context{
+		"providers":  auth.Providers(),
+		"local":      localProvider(),
+		"form":       form,
+		"next":       nextURL(c.Request()),
+		"loginError": loginErr,
+	}
+	core.RenderTemplate(c, w, context, "templates/account/login.html", LAYOUT)
+}
+
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+	renderLogin(c, w, NewLoginForm(), nil)
+}
+
+func LoginProviderHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	switch p := auth.GetProvider(mux.Vars(r)["provider"]).(type) {
+	case nil:
+		core.HandleNotFound(c, w)
+	case *auth.LocalProvider:
+		localLogin(c, w, r, p)
+	case *auth.OIDCProvider:
+		oidcLoginRedirect(c, w, r, p)
+	default:
+		loginURL, err := p.LoginURL(c, nextURL(r))
+		if err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+		http.Redirect(w, r, loginURL, 302)
+	}
+}
+
+func localLogin(c store.Context, w http.ResponseWriter, r *http.Request, p *auth.LocalProvider) {
+	form := NewLoginForm()
+	if r.Method != "POST" {
+		renderLogin(c, w, form, nil)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	if !gforms.IsFormValid(form, r.Form) {
+		renderLogin(c, w, form, nil)
+		return
+	}
+
+	user, err := p.Authenticate(c, form.Username.Value(), form.Password.Value())
+	if err == auth.ErrInvalidCredentials {
+		renderLogin(c, w, form, err)
+		return
+	} else if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	if err := auth.Login(c, w, user, p); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	http.Redirect(w, r, nextURL(r), 302)
+}
+
+func oidcLoginRedirect(c store.Context, w http.ResponseWriter, r *http.Request, p *auth.OIDCProvider) {
+	redirectURL, err := callbackURL(r, p)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	authURL, err := p.StartLogin(c, w, redirectURL, nextURL(r))
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	http.Redirect(w, r, authURL, 302)
+}
+
+func LoginCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	p, ok := auth.GetProvider(mux.Vars(r)["provider"]).(*auth.OIDCProvider)
+	if !ok {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	redirectURL, err := callbackURL(r, p)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	user, next, err := p.FinishLogin(c, w, redirectURL)
+	if _, ok := err.(*auth.OIDCError); ok || err == auth.ErrOIDCState || err == auth.ErrInvalidIDToken {
+		renderLogin(c, w, NewLoginForm(), err)
+		return
+	} else if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	if err := auth.Login(c, w, user, p); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	http.Redirect(w, r, next, 302)
+}
+
+// LogoutHandler logs out on POST and asks to confirm on GET, because
+// logout revokes sessions on all devices and must not be triggered by
+// other sites. Users of providers with logout pages of their own are
+// redirected there.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+	next := nextURL(r)
+
+	if r.Method != "POST" {
+		context := tmplt.Context{"next": next}
+		core.RenderTemplate(c, w, context, "templates/account/logout.html", LAYOUT)
+		return
+	}
+
+	p := auth.CurrentUser(c).Provider()
+	if err := auth.Logout(c, w); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	if p != nil {
+		logoutURL, err := p.LogoutURL(c, next)
+		if err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+		if !strings.HasPrefix(logoutURL, auth.LOGOUT_PATH) {
+			next = logoutURL
+		}
+	}
+	http.Redirect(w, r, next, 302)
+}
+
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	p := localProvider()
+	if p == nil || !p.AllowRegistration {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	form := NewRegisterForm()
+	context := tmplt.Context{
+		"form": form,
+		"next": nextURL(r),
+	}
+
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+
+		if gforms.IsFormValid(form, r.Form) {
+			var user *auth.User
+			var err error
+			if form.Password.Value() != form.PasswordConfirm.Value() {
+				err = errPasswordMismatch
+			} else {
+				user, err = auth.CreateLocalUser(c, form.Username.Value(), form.Password.Value(), false)
+			}
+
+			switch err {
+			case nil:
+				if err := auth.Login(c, w, user, p); err != nil {
+					core.HandleError(c, w, err)
+					return
+				}
+				http.Redirect(w, r, nextURL(r), 302)
+				return
+			case errPasswordMismatch, auth.ErrUsernameTaken, auth.ErrInvalidUsername, auth.ErrShortPassword:
+				context["registerError"] = err
+			default:
+				core.HandleError(c, w, err)
+				return
+			}
+		}
+	}
+
+	core.RenderTemplate(c, w, context, "templates/account/register.html", LAYOUT)
+}
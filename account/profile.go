@@ -0,0 +1,143 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"code.google.com/p/gorilla/mux"
+
+	"auth"
+	"blog"
+	"core"
+	"core/store"
+	"tmplt"
+)
+
+const (
+	PROFILE_ARTICLES = 10
+	PROFILE_COMMENTS = 10
+
+	MAX_LINKS       = 10
+	MAX_AVATAR_SIZE = 1 << 20
+	AVATAR_SIZE     = 128
+)
+
+var (
+	errInvalidURL   = errors.New("Enter URL starting with http:// or https://.")
+	errTooManyLinks = errors.New("Enter at most 10 links.")
+
+	avatarContentTypes = map[string]bool{
+		"image/gif":  true,
+		"image/jpeg": true,
+		"image/png":  true,
+	}
+
+	errInvalidAvatar = avatarError("Avatar must be GIF, JPEG or PNG image up to 1MB.")
+)
+
+// avatarError is error in uploaded avatar shown to the user.
+type avatarError string
+
+func (e avatarError) Error() string {
+	return string(e)
+}
+
+// avatar is uploaded profile picture.
+type avatar struct {
+	BlobKey string
+	URL     string
+}
+
+// parseURL returns normalized http(s) URL. Empty string is allowed.
+func parseURL(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errInvalidURL
+	}
+	return u.String(), nil
+}
+
+// parseLinks parses URLs entered one per line.
+func parseLinks(s string) ([]string, error) {
+	links := make([]string, 0)
+	for _, line := range strings.Split(s, "\n") {
+		link, err := parseURL(line)
+		if err != nil {
+			return nil, err
+		}
+		if link != "" {
+			links = append(links, link)
+		}
+	}
+	if len(links) > MAX_LINKS {
+		return nil, errTooManyLinks
+	}
+	return links, nil
+}
+
+// updateProfile saves public profile of the user. Avatar is left
+// unchanged when nil.
+func updateProfile(c store.Context, user *auth.User, displayName, bio, website string, links []string, avatar *avatar) error {
+	publicName := user.PublicName()
+	user.DisplayName = strings.TrimSpace(displayName)
+	user.BioBytes = []byte(bio)
+	user.BioHTMLBytes = blog.RenderCommentMarkdown(user.BioBytes)
+	user.Website = website
+	user.Links = links
+	if avatar != nil {
+		user.AvatarBlobKey = avatar.BlobKey
+		user.AvatarURL = avatar.URL
+	}
+	if err := auth.Users.Put(c, user); err != nil {
+		return err
+	}
+	if user.PublicName() != publicName {
+		auth.ProfileChanged(c, user)
+	}
+	return nil
+}
+
+func UserHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	profile, err := auth.GetUser(c, store.NewKey(auth.USER_KIND, "", id, nil))
+	if err == store.ErrNoSuchEntity {
+		core.HandleNotFound(c, w)
+		return
+	} else if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	articles, err := blog.GetAuthorArticles(c, profile, PROFILE_ARTICLES)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	comments, err := blog.GetUserComments(c, profile, PROFILE_COMMENTS)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	context := tmplt.Context{
+		"profile":  profile,
+		"articles": articles,
+		"comments": comments,
+	}
+	core.RenderTemplate(c, w, context, "templates/account/user.html", LAYOUT)
+}
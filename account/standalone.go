@@ -0,0 +1,34 @@
+//go:build !appengine
+// +build !appengine
+
+package account
+
+import (
+	"net/http"
+
+	"github.com/vmihailenco/gforms"
+
+	"core/store"
+)
+
+const (
+	AVATAR_UPLOAD = false
+
+	MAX_FORM_MEMORY = 1 << 20
+)
+
+var errNoBlobstore = avatarError("Avatar uploads require App Engine blobstore.")
+
+func parseProfileForm(c store.Context, r *http.Request, form *ProfileForm) (bool, *avatar, error) {
+	if err := r.ParseMultipartForm(MAX_FORM_MEMORY); err != nil && err != http.ErrNotMultipart {
+		return false, nil, err
+	}
+	isValid := gforms.IsFormValid(form, r.Form)
+	if r.MultipartForm != nil && len(r.MultipartForm.File["Avatar"]) > 0 {
+		return isValid, nil, errNoBlobstore
+	}
+	return isValid, nil, nil
+}
+
+// deleteAvatar does nothing: without blobstore avatars are never stored.
+func deleteAvatar(c store.Context, blobKey string) {}
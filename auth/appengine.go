@@ -0,0 +1,92 @@
+//go:build appengine
+// +build appengine
+
+package auth
+
+import (
+	"net/http"
+
+	"appengine/urlfetch"
+	"appengine/user"
+
+	"core/store"
+	"core/store/gae"
+)
+
+func init() {
+	RegisterProvider(AppengineProvider{})
+}
+
+func newHTTPClient(c store.Context) *http.Client {
+	return urlfetch.Client(gae.AppengineContext(c))
+}
+
+func CreateUserFromAppengine(c store.Context, appengineUser *user.User) (*User, error) {
+	u := &User{
+		UserId: appengineUser.ID,
+
+		Name:       appengineUser.String(),
+		Email:      appengineUser.Email,
+		AuthDomain: appengineUser.AuthDomain,
+		IsAdmin:    user.IsAdmin(gae.AppengineContext(c)),
+
+		FederatedIdentity: appengineUser.FederatedIdentity,
+		FederatedProvider: appengineUser.FederatedProvider,
+	}
+	if u.FederatedProvider == "" {
+		u.FederatedProvider = "appengine"
+	}
+	initUser(u)
+	if err := Users.Put(c, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// AppengineProvider authenticates users with App Engine users service.
+type AppengineProvider struct{}
+
+func (AppengineProvider) Name() string {
+	return "appengine"
+}
+
+func (AppengineProvider) Title() string {
+	return "Google"
+}
+
+func (AppengineProvider) CurrentUser(c store.Context) (*User, error) {
+	ac := gae.AppengineContext(c)
+
+	appengineUser := user.Current(ac)
+	if appengineUser == nil {
+		return nil, nil
+	}
+
+	u, err := GetUserByUserId(c, appengineUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if u == nil {
+		u, err = CreateUserFromAppengine(c, appengineUser)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if user.IsAdmin(ac) && !u.IsAdmin {
+		u.IsAdmin = true
+		// ignore error
+		Users.Put(c, u)
+	}
+
+	return u, nil
+}
+
+func (AppengineProvider) LoginURL(c store.Context, redirectTo string) (string, error) {
+	return user.LoginURL(gae.AppengineContext(c), redirectTo)
+}
+
+func (AppengineProvider) LogoutURL(c store.Context, redirectTo string) (string, error) {
+	return user.LogoutURL(gae.AppengineContext(c), redirectTo)
+}
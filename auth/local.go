@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"regexp"
+
+	"code.google.com/p/go.crypto/bcrypt"
+
+	"core/store"
+)
+
+const (
+	LOCAL_PROVIDER = "local"
+
+	MIN_PASSWORD_LEN = 8
+)
+
+var (
+	ErrInvalidCredentials = errors.New("Invalid username or password.")
+	ErrUsernameTaken      = errors.New("Username is already taken.")
+	ErrInvalidUsername    = errors.New("Username may only contain letters, digits, dots, dashes and underscores.")
+	ErrShortPassword      = errors.New("Password is too short.")
+
+	usernameRe = regexp.MustCompile(`^[0-9A-Za-z._-]{1,50}$`)
+)
+
+// LocalProvider authenticates users with username and password stored
+// in the blog itself. Sessions are kept in signed cookies.
+type LocalProvider struct {
+	// AllowRegistration lets visitors create accounts themselves.
+	AllowRegistration bool
+}
+
+func NewLocalProvider() *LocalProvider {
+	return &LocalProvider{}
+}
+
+func (p *LocalProvider) Name() string {
+	return LOCAL_PROVIDER
+}
+
+func (p *LocalProvider) Title() string {
+	return "Username and password"
+}
+
+func (p *LocalProvider) CurrentUser(c store.Context) (*User, error) {
+	return sessionUser(c, p)
+}
+
+func (p *LocalProvider) LoginURL(c store.Context, redirectTo string) (string, error) {
+	return loginPageURL(p.Name(), redirectTo)
+}
+
+func (p *LocalProvider) LogoutURL(c store.Context, redirectTo string) (string, error) {
+	return logoutPageURL(redirectTo)
+}
+
+func localUserId(username string) string {
+	return LOCAL_PROVIDER + ":" + username
+}
+
+// CreateLocalUser creates user that logs in with the username and password.
+func CreateLocalUser(c store.Context, username, password string, isAdmin bool) (*User, error) {
+	if !usernameRe.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+
+	existing, err := GetUserByUserId(c, localUserId(username))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrUsernameTaken
+	}
+
+	u := NewUser()
+	u.UserId = localUserId(username)
+	u.Name = username
+	u.IsAdmin = isAdmin
+	u.FederatedIdentity = username
+	u.FederatedProvider = LOCAL_PROVIDER
+	if err := setPassword(u, password); err != nil {
+		return nil, err
+	}
+	if err := Users.Put(c, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func setPassword(u *User, password string) error {
+	if len(password) < MIN_PASSWORD_LEN {
+		return ErrShortPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+	return nil
+}
+
+// SetPassword changes local password of the user.
+func SetPassword(c store.Context, u *User, password string) error {
+	if err := setPassword(u, password); err != nil {
+		return err
+	}
+	return Users.Put(c, u)
+}
+
+// Authenticate returns user with the username and password.
+func (p *LocalProvider) Authenticate(c store.Context, username, password string) (*User, error) {
+	u, err := GetUserByUserId(c, localUserId(username))
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || len(u.PasswordHash) == 0 {
+		// spend the same time as for existing user
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
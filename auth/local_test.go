@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestCreateLocalUser(t *testing.T) {
+	b := newTestBackend()
+	c := newTestContext(b)
+	if _, err := CreateLocalUser(c, "alice", "password1", true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		password string
+		err      error
+	}{
+		{"bob", "password2", nil},
+		{"alice", "password3", ErrUsernameTaken},
+		{"bad name", "password4", ErrInvalidUsername},
+		{"", "password5", ErrInvalidUsername},
+		{"carol", "short", ErrShortPassword},
+	}
+	for _, test := range tests {
+		u, err := CreateLocalUser(c, test.username, test.password, false)
+		if err != test.err {
+			t.Errorf("CreateLocalUser(%q) returned %v, want %v", test.username, err, test.err)
+			continue
+		}
+		if err == nil && (u.Key() == nil || u.UserId != localUserId(test.username) || u.IsAdmin) {
+			t.Errorf("CreateLocalUser(%q) = %+v", test.username, u)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	b := newTestBackend()
+	c := newTestContext(b)
+	p := NewLocalProvider()
+	alice, err := CreateLocalUser(c, "alice", "password1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	federated := NewUser()
+	federated.UserId = localUserId("fed")
+	if err := Users.Put(c, federated); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		password string
+		err      error
+	}{
+		{"alice", "password1", nil},
+		{"alice", "password2", ErrInvalidCredentials},
+		{"alice", "", ErrInvalidCredentials},
+		{"Alice", "password1", ErrInvalidCredentials},
+		{"unknown", "password1", ErrInvalidCredentials},
+		{"fed", "", ErrInvalidCredentials},
+	}
+	for _, test := range tests {
+		u, err := p.Authenticate(c, test.username, test.password)
+		if err != test.err {
+			t.Errorf("Authenticate(%q, %q) returned %v, want %v", test.username, test.password, err, test.err)
+			continue
+		}
+		if err == nil && !u.Key().Equal(alice.Key()) {
+			t.Errorf("Authenticate(%q) = %v, want %v", test.username, u.Key(), alice.Key())
+		}
+	}
+
+	if err := SetPassword(c, alice, "password2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Authenticate(c, "alice", "password1"); err != ErrInvalidCredentials {
+		t.Errorf("old password accepted after change: %v", err)
+	}
+	if _, err := p.Authenticate(c, "alice", "password2"); err != nil {
+		t.Errorf("new password rejected: %v", err)
+	}
+}
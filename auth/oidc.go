@@ -0,0 +1,462 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"core/store"
+)
+
+const (
+	OIDC_COOKIE         = "oidc"
+	OIDC_COOKIE_MAX_AGE = 10 * time.Minute
+
+	OIDC_STATE_SIZE = 16
+)
+
+var (
+	ErrInvalidIDToken = errors.New("Invalid ID token.")
+	ErrOIDCState      = errors.New("Login has expired, please try again.")
+)
+
+// OIDCError is error returned by the issuer to the callback, e.g. when
+// the user denies access.
+type OIDCError struct {
+	Provider string
+	Code     string
+}
+
+func (e *OIDCError) Error() string {
+	return e.Provider + ": " + e.Code
+}
+
+// oidcLogin is kept in signed cookie between redirect to the issuer
+// and callback.
+type oidcLogin struct {
+	Provider string
+	State    string
+	Nonce    string
+	Next     string
+}
+
+// OIDCProvider authenticates users with OpenID Connect authorization
+// code flow. Endpoints are discovered from the issuer.
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Scopes default to "openid email profile".
+	Scopes []string
+	// RedirectURL is the callback URL registered with the issuer. When
+	// empty it is derived from the request.
+	RedirectURL string
+
+	name   string
+	title  string
+	mu     sync.Mutex
+	config *oidcConfig
+	keys   map[string]*rsa.PublicKey
+}
+
+func NewOIDCProvider(name, title, issuer, clientID, clientSecret string) *OIDCProvider {
+	return &OIDCProvider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		name:         name,
+		title:        title,
+	}
+}
+
+type oidcConfig struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type oidcClaims struct {
+	Issuer            string          `json:"iss"`
+	Subject           string          `json:"sub"`
+	Audience          json.RawMessage `json:"aud"`
+	Expires           int64           `json:"exp"`
+	Nonce             string          `json:"nonce"`
+	Email             string          `json:"email"`
+	Name              string          `json:"name"`
+	PreferredUsername string          `json:"preferred_username"`
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+func (p *OIDCProvider) Title() string {
+	return p.title
+}
+
+func (p *OIDCProvider) CurrentUser(c store.Context) (*User, error) {
+	return sessionUser(c, p)
+}
+
+func (p *OIDCProvider) LoginURL(c store.Context, redirectTo string) (string, error) {
+	return loginPageURL(p.name, redirectTo)
+}
+
+func (p *OIDCProvider) LogoutURL(c store.Context, redirectTo string) (string, error) {
+	return logoutPageURL(redirectTo)
+}
+
+func getJSON(c store.Context, req *http.Request, dst interface{}) error {
+	resp, err := newHTTPClient(c).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+func (p *OIDCProvider) discover(c store.Context) (*oidcConfig, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.config != nil {
+		return p.config, nil
+	}
+
+	req, err := http.NewRequest("GET", p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	config := &oidcConfig{}
+	if err := getJSON(c, req, config); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(config.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: %q", config.Issuer)
+	}
+
+	p.config = config
+	return config, nil
+}
+
+// AuthCodeURL returns URL of the provider page the user is redirected to.
+func (p *OIDCProvider) AuthCodeURL(c store.Context, redirectURL, state, nonce string) (string, error) {
+	config, err := p.discover(c)
+	if err != nil {
+		return "", err
+	}
+
+	values := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.ClientID},
+		"redirect_uri":  {redirectURL},
+		"scope":         {strings.Join(p.Scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(config.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return config.AuthorizationEndpoint + sep + values.Encode(), nil
+}
+
+// StartLogin returns URL of the issuer page the user is redirected to.
+// State of the login is kept in cookie until FinishLogin.
+func (p *OIDCProvider) StartLogin(c store.Context, w http.ResponseWriter, redirectURL, next string) (string, error) {
+	state, err := RandomString(OIDC_STATE_SIZE)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := RandomString(OIDC_STATE_SIZE)
+	if err != nil {
+		return "", err
+	}
+	authURL, err := p.AuthCodeURL(c, redirectURL, state, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	login := &oidcLogin{
+		Provider: p.name,
+		State:    state,
+		Nonce:    nonce,
+		Next:     next,
+	}
+	if err := SetSignedCookie(c, w, OIDC_COOKIE, login, OIDC_COOKIE_MAX_AGE); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// FinishLogin handles callback of the login started by StartLogin and
+// returns the user and URL passed to StartLogin as next. Callbacks of
+// other logins fail with ErrOIDCState, errors of the issuer are returned
+// as *OIDCError.
+func (p *OIDCProvider) FinishLogin(c store.Context, w http.ResponseWriter, redirectURL string) (*User, string, error) {
+	r := c.Request()
+	login := &oidcLogin{}
+	err := GetSignedCookie(c, OIDC_COOKIE, login)
+	DeleteCookie(w, OIDC_COOKIE)
+	if err != nil || login.Provider != p.name || login.State == "" ||
+		subtle.ConstantTimeCompare([]byte(login.State), []byte(r.FormValue("state"))) != 1 {
+		return nil, "", ErrOIDCState
+	}
+	if code := r.FormValue("error"); code != "" {
+		return nil, "", &OIDCError{Provider: p.title, Code: code}
+	}
+
+	u, err := p.Exchange(c, r.FormValue("code"), redirectURL, login.Nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	return u, login.Next, nil
+}
+
+// Exchange exchanges authorization code for ID token and returns user
+// identified by it. The user is created on first login.
+func (p *OIDCProvider) Exchange(c store.Context, code, redirectURL, nonce string) (*User, error) {
+	config, err := p.discover(c)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	}
+	req, err := http.NewRequest("POST", config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}
+	if err := getJSON(c, req, &tokens); err != nil {
+		return nil, err
+	}
+
+	claims, err := p.parseIDToken(c, tokens.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Name == "" && config.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		req, err := http.NewRequest("GET", config.UserinfoEndpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		info := &oidcClaims{}
+		if err := getJSON(c, req, info); err != nil {
+			c.Warningf("can't get userinfo: %v", err)
+		} else if info.Subject == claims.Subject {
+			claims.Name, claims.PreferredUsername = info.Name, info.PreferredUsername
+			if claims.Email == "" {
+				claims.Email = info.Email
+			}
+		}
+	}
+
+	return p.user(c, claims)
+}
+
+// parseIDToken verifies signature and claims of the ID token. Only RS256
+// signatures, required by OpenID Connect, are accepted.
+func (p *OIDCProvider) parseIDToken(c store.Context, idToken, nonce string) (*oidcClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+	header := &jwtHeader{}
+	if err := decodeSegment(parts[0], header); err != nil || header.Alg != "RS256" {
+		return nil, ErrInvalidIDToken
+	}
+	signature, err := base64.URLEncoding.DecodeString(padBase64(parts[2]))
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	key, err := p.signingKey(c, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature) != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	claims := &oidcClaims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != p.Issuer ||
+		!p.isAudience(claims.Audience) ||
+		claims.Subject == "" ||
+		claims.Nonce != nonce ||
+		time.Unix(claims.Expires, 0).Before(time.Now()) {
+		return nil, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+func decodeSegment(s string, dst interface{}) error {
+	b, err := base64.URLEncoding.DecodeString(padBase64(s))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// signingKey returns issuer key with the id from JWKS of the issuer.
+// Keys are fetched again when the id is unknown, because issuers
+// rotate them.
+func (p *OIDCProvider) signingKey(c store.Context, kid string) (*rsa.PublicKey, error) {
+	config, err := p.discover(c)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := findKey(p.keys, kid); key != nil {
+		return key, nil
+	}
+
+	req, err := http.NewRequest("GET", config.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(c, req, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.URLEncoding.DecodeString(padBase64(k.N))
+		e, errE := base64.URLEncoding.DecodeString(padBase64(k.E))
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+
+	if key := findKey(keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrInvalidIDToken
+}
+
+// findKey returns key with the id; tokens without id may use the only
+// key of the issuer.
+func findKey(keys map[string]*rsa.PublicKey, kid string) *rsa.PublicKey {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return keys[kid]
+}
+
+func padBase64(s string) string {
+	if n := len(s) % 4; n > 0 {
+		s += strings.Repeat("=", 4-n)
+	}
+	return s
+}
+
+// isAudience reports whether aud claim, string or list of strings,
+// contains client id.
+func (p *OIDCProvider) isAudience(aud json.RawMessage) bool {
+	var one string
+	if json.Unmarshal(aud, &one) == nil {
+		return one == p.ClientID
+	}
+	var many []string
+	if json.Unmarshal(aud, &many) == nil {
+		for _, a := range many {
+			if a == p.ClientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *OIDCProvider) user(c store.Context, claims *oidcClaims) (*User, error) {
+	name := claims.Name
+	for _, s := range []string{claims.PreferredUsername, claims.Email, claims.Subject} {
+		if name == "" {
+			name = s
+		}
+	}
+
+	u, err := getOrCreateUser(c, &User{
+		UserId:            p.name + ":" + claims.Subject,
+		Name:              name,
+		Email:             claims.Email,
+		FederatedIdentity: claims.Subject,
+		FederatedProvider: p.Issuer,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Email != claims.Email && claims.Email != "" {
+		u.Email = claims.Email
+		if err := Users.Put(c, u); err != nil {
+			return nil, err
+		}
+		ProfileChanged(c, u)
+	}
+	return u, nil
+}
@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "client"
+	testClientSecret = "client-secret"
+	testNonce        = "nonce"
+	testCode         = "code"
+)
+
+// fakeIssuer is OpenID Connect provider that returns idToken from its
+// token endpoint.
+type fakeIssuer struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	f := &fakeIssuer{key: newTestKey(t)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"userinfo_endpoint":      f.URL + "/userinfo",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "EC", "kid": "ec", "crv": "P-256"},
+				{
+					"kty": "RSA",
+					"kid": "k1",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != testCode || r.FormValue("client_id") != testClientID ||
+			r.FormValue("client_secret") != testClientSecret {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access-token",
+			"id_token":     f.idToken,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"sub":  "alice-id",
+			"name": "Alice",
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func (f *fakeIssuer) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   f.URL,
+		"sub":   "alice-id",
+		"aud":   testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": testNonce,
+		"email": "alice@example.com",
+	}
+}
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// signToken returns RS256 JWT signed with the key, or unsigned token
+// when key is nil.
+func signToken(t *testing.T, key *rsa.PrivateKey, header, claims map[string]interface{}) string {
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	if key == nil {
+		return signed + "."
+	}
+	hashed := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func rs256(kid string) map[string]interface{} {
+	return map[string]interface{}{"alg": "RS256", "kid": kid}
+}
+
+func newTestOIDCProvider(f *fakeIssuer) *OIDCProvider {
+	return NewOIDCProvider("fake", "Fake", f.URL+"/", testClientID, testClientSecret)
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newTestOIDCProvider(f)
+	s, err := p.AuthCodeURL(newTestContext(newTestBackend()), "http://blog/callback/", "state", testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != f.URL+"/authorize" {
+		t.Errorf("got endpoint %q, want %q", got, f.URL+"/authorize")
+	}
+	want := url.Values{
+		"response_type": {"code"},
+		"client_id":     {testClientID},
+		"redirect_uri":  {"http://blog/callback/"},
+		"scope":         {"openid email profile"},
+		"state":         {"state"},
+		"nonce":         {testNonce},
+	}
+	if got := u.Query(); got.Encode() != want.Encode() {
+		t.Errorf("got query %v, want %v", got, want)
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newTestOIDCProvider(f)
+	c := newTestContext(newTestBackend())
+
+	f.idToken = signToken(t, f.key, rs256("k1"), f.claims())
+	u, err := p.Exchange(c, testCode, "http://blog/callback/", testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Key() == nil || u.UserId != "fake:alice-id" || u.Name != "Alice" || u.Email != "alice@example.com" {
+		t.Errorf("got user %+v", u)
+	}
+
+	again, err := p.Exchange(c, testCode, "http://blog/callback/", testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Key().Equal(u.Key()) {
+		t.Errorf("second login created user %v, want %v", again.Key(), u.Key())
+	}
+
+	if _, err := p.Exchange(c, "wrong", "http://blog/callback/", testNonce); err == nil {
+		t.Errorf("Exchange of invalid code did not fail")
+	}
+}
+
+func TestOIDCIDTokenRejected(t *testing.T) {
+	f := newFakeIssuer(t)
+	other := newFakeIssuer(t)
+	p := newTestOIDCProvider(f)
+	c := newTestContext(newTestBackend())
+
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := f.claims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	otherClaims := other.claims()
+
+	tests := []struct {
+		name    string
+		idToken string
+		ok      bool
+	}{
+		{"valid", signToken(t, f.key, rs256("k1"), f.claims()), true},
+		{"audience list", signToken(t, f.key, rs256("k1"), with("aud", []string{"x", testClientID})), true},
+		{"only key without kid", signToken(t, f.key, map[string]interface{}{"alg": "RS256"}, f.claims()), true},
+		{"wrong nonce", signToken(t, f.key, rs256("k1"), with("nonce", "other")), false},
+		{"no nonce", signToken(t, f.key, rs256("k1"), with("nonce", nil)), false},
+		{"wrong issuer", signToken(t, f.key, rs256("k1"), with("iss", other.URL)), false},
+		{"wrong audience", signToken(t, f.key, rs256("k1"), with("aud", "other")), false},
+		{"audience list without client", signToken(t, f.key, rs256("k1"), with("aud", []string{"x"})), false},
+		{"expired", signToken(t, f.key, rs256("k1"), with("exp", time.Now().Add(-time.Minute).Unix())), false},
+		{"no expiry", signToken(t, f.key, rs256("k1"), with("exp", nil)), false},
+		{"no subject", signToken(t, f.key, rs256("k1"), with("sub", nil)), false},
+		{"other issuer token", signToken(t, other.key, rs256("k1"), otherClaims), false},
+		{"forged signature", signToken(t, other.key, rs256("k1"), f.claims()), false},
+		{"unknown key", signToken(t, f.key, rs256("k2"), f.claims()), false},
+		{"unsigned", signToken(t, nil, map[string]interface{}{"alg": "none"}, f.claims()), false},
+		{"HS256", signToken(t, f.key, map[string]interface{}{"alg": "HS256", "kid": "k1"}, f.claims()), false},
+		{"malformed", "not a token", false},
+	}
+	for _, test := range tests {
+		f.idToken = test.idToken
+		u, err := p.Exchange(c, testCode, "http://blog/callback/", testNonce)
+		if test.ok {
+			if err != nil || u == nil {
+				t.Errorf("%s: got %v, %v", test.name, u, err)
+			}
+			continue
+		}
+		if err != ErrInvalidIDToken {
+			t.Errorf("%s: got %v, %v, want ErrInvalidIDToken", test.name, u, err)
+		}
+	}
+
+	// Tampered payload invalidates signature.
+	parts := strings.Split(signToken(t, f.key, rs256("k1"), f.claims()), ".")
+	parts[1] = encodeSegment(t, with("sub", "mallory"))
+	f.idToken = strings.Join(parts, ".")
+	if _, err := p.Exchange(c, testCode, "http://blog/callback/", testNonce); err != ErrInvalidIDToken {
+		t.Errorf("tampered payload: got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestOIDCLoginState(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newTestOIDCProvider(f)
+	other := NewOIDCProvider("other", "Other", f.URL, testClientID, testClientSecret)
+	b := newTestBackend()
+
+	start := func(p *OIDCProvider) (*http.Cookie, url.Values) {
+		w := httptest.NewRecorder()
+		authURL, err := p.StartLogin(newTestContext(b), w, "http://blog/callback/", "/after/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cookie := responseCookie(w, OIDC_COOKIE)
+		if cookie == nil {
+			t.Fatal("StartLogin did not set cookie")
+		}
+		return cookie, u.Query()
+	}
+	cookie, params := start(p)
+	otherCookie, otherParams := start(other)
+	state := params.Get("state")
+
+	claims := f.claims()
+	claims["nonce"] = params.Get("nonce")
+	validToken := signToken(t, f.key, rs256("k1"), claims)
+	claims["nonce"] = otherParams.Get("nonce")
+	otherNonceToken := signToken(t, f.key, rs256("k1"), claims)
+
+	tests := []struct {
+		name    string
+		query   string
+		cookie  *http.Cookie
+		idToken string
+		err     error
+	}{
+		{"valid", "code=code&state=" + state, cookie, validToken, nil},
+		{"no cookie", "code=code&state=" + state, nil, validToken, ErrOIDCState},
+		{"wrong state", "code=code&state=" + otherParams.Get("state"), cookie, validToken, ErrOIDCState},
+		{"no state", "code=code", cookie, validToken, ErrOIDCState},
+		{"other provider", "code=code&state=" + otherParams.Get("state"), otherCookie, validToken, ErrOIDCState},
+		{"tampered cookie", "code=code&state=" + state, tamper(cookie, len(cookie.Value)/2), validToken, ErrOIDCState},
+		{"nonce of other login", "code=code&state=" + state, cookie, otherNonceToken, ErrInvalidIDToken},
+		{"issuer error", "error=access_denied&state=" + state, cookie, validToken, &OIDCError{"Fake", "access_denied"}},
+	}
+	for _, test := range tests {
+		f.idToken = test.idToken
+		r := httptest.NewRequest("GET", "/login/fake/callback/?"+test.query, nil)
+		if test.cookie != nil {
+			r.AddCookie(test.cookie)
+		}
+		w := httptest.NewRecorder()
+		u, next, err := p.FinishLogin(b.NewContext(r), w, "http://blog/callback/")
+
+		if deleted := responseCookie(w, OIDC_COOKIE); deleted == nil || deleted.MaxAge >= 0 {
+			t.Errorf("%s: login cookie is not deleted", test.name)
+		}
+		if want, ok := test.err.(*OIDCError); ok {
+			if got, ok := err.(*OIDCError); !ok || *got != *want {
+				t.Errorf("%s: got error %v, want %v", test.name, err, want)
+			}
+			continue
+		}
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && (u == nil || u.UserId != "fake:alice-id" || next != "/after/") {
+			t.Errorf("%s: got user %v and next %q", test.name, u, next)
+		}
+	}
+}
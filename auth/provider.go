@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"net/url"
+
+	"core/store"
+)
+
+// Login and logout pages of providers that have no pages of their own.
+// The handlers are registered by the account package.
+const (
+	LOGIN_PATH  = "/login/"
+	LOGOUT_PATH = "/logout/"
+)
+
+// Provider authenticates users, e.g. with App Engine users service,
+// local passwords or OpenID Connect.
+type Provider interface {
+	// Name identifies the provider in URLs and sessions.
+	Name() string
+	// Title is shown on the login page.
+	Title() string
+	// CurrentUser returns user logged in with the provider or nil.
+	CurrentUser(c store.Context) (*User, error)
+	LoginURL(c store.Context, redirectTo string) (string, error)
+	LogoutURL(c store.Context, redirectTo string) (string, error)
+}
+
+var providers []Provider
+
+// RegisterProvider makes provider available for login. Providers are
+// asked for the current user in order of registration.
+func RegisterProvider(p Provider) {
+	providers = append(providers, p)
+}
+
+func Providers() []Provider {
+	return providers
+}
+
+func GetProvider(name string) Provider {
+	for _, p := range providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// CurrentUser returns user authenticated by API token or any of
+// the registered providers, Anonymous otherwise.
+func CurrentUser(c store.Context) *User {
+	if u := requestUser(c.Request()); u != nil {
+		return u
+	}
+
+	for _, p := range providers {
+		u, err := p.CurrentUser(c)
+		if err != nil {
+			c.Errorf("%s auth failed: %v", p.Name(), err)
+			continue
+		}
+		if u != nil {
+			u.provider = p
+			return u
+		}
+	}
+	return Anonymous
+}
+
+// Provider returns provider the user is logged in with or nil.
+func (u *User) Provider() Provider {
+	return u.provider
+}
+
+// getOrCreateUser returns user with the given UserId, creating it
+// from the template if it doesn't exist yet.
+func getOrCreateUser(c store.Context, tmpl *User) (*User, error) {
+	u, err := GetUserByUserId(c, tmpl.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if u != nil {
+		return u, nil
+	}
+
+	initUser(tmpl)
+	if err := Users.Put(c, tmpl); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// loginPageURL returns URL of the provider login page that redirects
+// back to redirectTo.
+func loginPageURL(provider, redirectTo string) (string, error) {
+	return LOGIN_PATH + provider + "/?" + url.Values{"next": {redirectTo}}.Encode(), nil
+}
+
+func logoutPageURL(redirectTo string) (string, error) {
+	return LOGOUT_PATH + "?" + url.Values{"next": {redirectTo}}.Encode(), nil
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+
+	"core/store"
+)
+
+const (
+	ROLE_ADMIN     = "admin"
+	ROLE_EDITOR    = "editor"
+	ROLE_AUTHOR    = "author"
+	ROLE_COMMENTER = "commenter"
+
+	// Permissions with OWN_SUFFIX allow the action only on objects
+	// owned by the user.
+	OWN_SUFFIX = ".own"
+
+	PERM_ARTICLE_CREATE      = "article.create"
+	PERM_ARTICLE_UPDATE      = "article.update"
+	PERM_ARTICLE_UPDATE_OWN  = PERM_ARTICLE_UPDATE + OWN_SUFFIX
+	PERM_ARTICLE_PUBLISH     = "article.publish"
+	PERM_ARTICLE_PUBLISH_OWN = PERM_ARTICLE_PUBLISH + OWN_SUFFIX
+	PERM_ARTICLE_DELETE      = "article.delete"
+	PERM_ARTICLE_DELETE_OWN  = PERM_ARTICLE_DELETE + OWN_SUFFIX
+	PERM_COMMENT_CREATE      = "comment.create"
+	PERM_COMMENT_MODERATE    = "comment.moderate"
+	PERM_SEARCH_REINDEX      = "search.reindex"
+	PERM_USER_MANAGE         = "user.manage"
+)
+
+var ErrInvalidRole = errors.New("Invalid role.")
+
+// Roles are listed from the most to the least privileged.
+var Roles = []string{ROLE_ADMIN, ROLE_EDITOR, ROLE_AUTHOR, ROLE_COMMENTER}
+
+var rolePermissions = map[string][]string{
+	ROLE_ADMIN: {
+		PERM_ARTICLE_CREATE,
+		PERM_ARTICLE_UPDATE,
+		PERM_ARTICLE_PUBLISH,
+		PERM_ARTICLE_DELETE,
+		PERM_COMMENT_CREATE,
+		PERM_COMMENT_MODERATE,
+		PERM_SEARCH_REINDEX,
+		PERM_USER_MANAGE,
+	},
+	ROLE_EDITOR: {
+		PERM_ARTICLE_CREATE,
+		PERM_ARTICLE_UPDATE,
+		PERM_ARTICLE_PUBLISH,
+		PERM_ARTICLE_DELETE,
+		PERM_COMMENT_CREATE,
+		PERM_COMMENT_MODERATE,
+	},
+	ROLE_AUTHOR: {
+		PERM_ARTICLE_CREATE,
+		PERM_ARTICLE_UPDATE_OWN,
+		PERM_ARTICLE_PUBLISH_OWN,
+		PERM_ARTICLE_DELETE_OWN,
+		PERM_COMMENT_CREATE,
+	},
+	ROLE_COMMENTER: {
+		PERM_COMMENT_CREATE,
+	},
+}
+
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RolePermissions returns permissions granted by the role.
+func RolePermissions(role string) []string {
+	return rolePermissions[role]
+}
+
+// GetRole returns role of the user. Users without role are commenters,
+// IsAdmin users are always admins.
+func (u *User) GetRole() string {
+	switch {
+	case u.IsAnonymous():
+		return ""
+	case u.IsAdmin:
+		return ROLE_ADMIN
+	case IsRole(u.Role):
+		return u.Role
+	}
+	return ROLE_COMMENTER
+}
+
+// Can reports whether the user has the permission.
+func (u *User) Can(perm string) bool {
+	for _, p := range rolePermissions[u.GetRole()] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanOwn reports whether the user has the permission on object owned
+// by owner: either the permission itself or its own variant.
+func (u *User) CanOwn(perm string, owner *store.Key) bool {
+	if u.Can(perm) {
+		return true
+	}
+	return owner != nil && u.IsAuth() && owner.Equal(u.Key()) && u.Can(perm+OWN_SUFFIX)
+}
+
+// SetRole changes role of the user.
+func SetRole(c store.Context, u *User, role string) error {
+	if !IsRole(role) {
+		return ErrInvalidRole
+	}
+	u.Role = role
+	u.IsAdmin = role == ROLE_ADMIN
+	return Users.Put(c, u)
+}
+
+// GetUsers returns all users ordered by name.
+func GetUsers(c store.Context) ([]*User, error) {
+	return Users.GetAll(c, GetUserQuery().Order("Name"))
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"code.google.com/p/gorilla/securecookie"
+
+	"core/store"
+)
+
+const (
+	SESSION_COOKIE  = "session"
+	SESSION_MAX_AGE = 30 * 24 * time.Hour
+
+	AUTH_SECRET_KIND = "authSecret"
+)
+
+// authSecret holds keys of signed cookies. It is generated on first use
+// and kept in the store, so sessions survive restarts.
+type authSecret struct {
+	HashKey  []byte `datastore:",noindex"`
+	BlockKey []byte `datastore:",noindex"`
+}
+
+var (
+	codecMu sync.Mutex
+	codecs  = make(map[string]*securecookie.SecureCookie)
+)
+
+// cookieCodec returns codec of signed and encrypted cookies; each name
+// has its own keys.
+func cookieCodec(c store.Context, name string) (*securecookie.SecureCookie, error) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+
+	if codec, ok := codecs[name]; ok {
+		return codec, nil
+	}
+
+	secret := &authSecret{}
+	key := store.NewKey(AUTH_SECRET_KIND, name, 0, nil)
+	err := store.RunInTransaction(c, func(c store.Context) error {
+		err := store.Get(c, key, secret)
+		if err != store.ErrNoSuchEntity {
+			return err
+		}
+		secret.HashKey = securecookie.GenerateRandomKey(64)
+		secret.BlockKey = securecookie.GenerateRandomKey(32)
+		_, err = store.Put(c, key, secret)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	codec := securecookie.New(secret.HashKey, secret.BlockKey)
+	codec.MaxAge(int(SESSION_MAX_AGE / time.Second))
+	codecs[name] = codec
+	return codec, nil
+}
+
+// SetSignedCookie sets cookie with value that can't be read or forged
+// by the client. maxAge must not exceed SESSION_MAX_AGE.
+func SetSignedCookie(c store.Context, w http.ResponseWriter, name string, value interface{}, maxAge time.Duration) error {
+	codec, err := cookieCodec(c, name)
+	if err != nil {
+		return err
+	}
+	encoded, err := codec.Encode(name, value)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    encoded,
+		Path:     "/",
+		Expires:  time.Now().Add(maxAge),
+		HttpOnly: true,
+		Secure:   c.Request().TLS != nil,
+	})
+	return nil
+}
+
+// GetSignedCookie decodes cookie set by SetSignedCookie into dst.
+func GetSignedCookie(c store.Context, name string, dst interface{}) error {
+	cookie, err := c.Request().Cookie(name)
+	if err != nil {
+		return err
+	}
+	codec, err := cookieCodec(c, name)
+	if err != nil {
+		return err
+	}
+	return codec.Decode(name, cookie.Value, dst)
+}
+
+func DeleteCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:    name,
+		Value:   "",
+		Path:    "/",
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	})
+}
+
+type session struct {
+	UserKey  string
+	Provider string
+	// Generation must match SessionGeneration of the user, so Logout
+	// revokes the session even if the cookie is kept.
+	Generation int
+}
+
+// Login starts session of the user logged in with the provider.
+func Login(c store.Context, w http.ResponseWriter, user *User, provider Provider) error {
+	s := &session{
+		UserKey:    user.Key().Encode(),
+		Provider:   provider.Name(),
+		Generation: user.SessionGeneration,
+	}
+	return SetSignedCookie(c, w, SESSION_COOKIE, s, SESSION_MAX_AGE)
+}
+
+// Logout ends the session of the request. Other sessions of the user are
+// revoked too, because they can't be told apart from the copies of the
+// cookie.
+func Logout(c store.Context, w http.ResponseWriter) error {
+	DeleteCookie(w, SESSION_COOKIE)
+
+	s, u, err := currentSession(c)
+	if err != nil || u == nil {
+		return err
+	}
+	return store.RunInTransaction(c, func(c store.Context) error {
+		u, err := Users.Load(c, u.Key())
+		if err != nil {
+			return err
+		}
+		if u.SessionGeneration != s.Generation {
+			return nil
+		}
+		u.SessionGeneration++
+		return Users.Put(c, u)
+	})
+}
+
+// currentSession returns valid session of the request and its user.
+func currentSession(c store.Context) (*session, *User, error) {
+	s := &session{}
+	if err := GetSignedCookie(c, SESSION_COOKIE, s); err != nil {
+		// no session, it has expired or was signed with other keys
+		return nil, nil, nil
+	}
+
+	key, err := store.DecodeKey(s.UserKey)
+	if err != nil {
+		return nil, nil, nil
+	}
+	u, err := GetUser(c, key)
+	if err == store.ErrNoSuchEntity {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if s.Generation != u.SessionGeneration {
+		return nil, nil, nil
+	}
+	return s, u, nil
+}
+
+// sessionUser returns user of the session started with the provider.
+func sessionUser(c store.Context, provider Provider) (*User, error) {
+	s, u, err := currentSession(c)
+	if err != nil || u == nil || s.Provider != provider.Name() {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"code.google.com/p/gorilla/securecookie"
+
+	"core/store"
+	"core/store/memory"
+)
+
+// newTestBackend returns empty backend and forgets cookie keys of the
+// previous one.
+func newTestBackend() *memory.Backend {
+	codecMu.Lock()
+	codecs = make(map[string]*securecookie.SecureCookie)
+	codecMu.Unlock()
+	return memory.NewBackend()
+}
+
+func newTestContext(b *memory.Backend, cookies ...*http.Cookie) store.Context {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	return b.NewContext(r)
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// login starts session of the user and returns its cookie.
+func login(t *testing.T, b *memory.Backend, u *User, p Provider) *http.Cookie {
+	w := httptest.NewRecorder()
+	if err := Login(newTestContext(b), w, u, p); err != nil {
+		t.Fatal(err)
+	}
+	cookie := responseCookie(w, SESSION_COOKIE)
+	if cookie == nil {
+		t.Fatal("Login did not set session cookie")
+	}
+	return cookie
+}
+
+// backdateCookie returns copy of the signed cookie that was issued age ago.
+func backdateCookie(t *testing.T, b *memory.Backend, cookie *http.Cookie, age time.Duration) *http.Cookie {
+	secret := &authSecret{}
+	key := store.NewKey(AUTH_SECRET_KIND, cookie.Name, 0, nil)
+	if err := store.Get(newTestContext(b), key, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := base64.URLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := bytes.SplitN(raw, []byte("|"), 3)
+	issued, err := strconv.ParseInt(string(parts[0]), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := strconv.FormatInt(issued-int64(age/time.Second), 10)
+
+	h := hmac.New(sha256.New, secret.HashKey)
+	h.Write([]byte(cookie.Name + "|" + date + "|" + string(parts[1])))
+	value := date + "|" + string(parts[1]) + "|" + string(h.Sum(nil))
+	return &http.Cookie{Name: cookie.Name, Value: base64.URLEncoding.EncodeToString([]byte(value))}
+}
+
+func tamper(cookie *http.Cookie, i int) *http.Cookie {
+	value := []byte(cookie.Value)
+	if value[i] == 'A' {
+		value[i] = 'B'
+	} else {
+		value[i] = 'A'
+	}
+	return &http.Cookie{Name: cookie.Name, Value: string(value)}
+}
+
+func TestSession(t *testing.T) {
+	b := newTestBackend()
+	p := NewLocalProvider()
+	u, err := CreateLocalUser(newTestContext(b), "alice", "password1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := CreateLocalUser(newTestContext(b), "bob", "password2", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := login(t, b, u, p)
+	deletedCookie := login(t, b, deleted, p)
+	if err := Users.Delete(newTestContext(b), deleted.Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		ok     bool
+	}{
+		{"valid", cookie, true},
+		{"recent", backdateCookie(t, b, cookie, time.Hour), true},
+		{"no cookie", nil, false},
+		{"expired", backdateCookie(t, b, cookie, SESSION_MAX_AGE+time.Minute), false},
+		{"tampered start", tamper(cookie, 0), false},
+		{"tampered middle", tamper(cookie, len(cookie.Value)/2), false},
+		{"tampered end", tamper(cookie, len(cookie.Value)-3), false},
+		{"other cookie name", &http.Cookie{Name: SESSION_COOKIE, Value: "x" + cookie.Value}, false},
+		{"deleted user", deletedCookie, false},
+	}
+	for _, test := range tests {
+		var c store.Context
+		if test.cookie != nil {
+			c = newTestContext(b, test.cookie)
+		} else {
+			c = newTestContext(b)
+		}
+		got, err := p.CurrentUser(c)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if test.ok && (got == nil || !got.Key().Equal(u.Key())) {
+			t.Errorf("%s: got user %v, want %v", test.name, got, u.Key())
+		}
+		if !test.ok && got != nil {
+			t.Errorf("%s: got user %v, want none", test.name, got.Key())
+		}
+	}
+
+	other := NewOIDCProvider("other", "Other", "https://issuer.example.com", "id", "secret")
+	if got, err := other.CurrentUser(newTestContext(b, cookie)); err != nil || got != nil {
+		t.Errorf("session of %s provider accepted by %s: %v, %v", p.Name(), other.Name(), got, err)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	b := newTestBackend()
+	p := NewLocalProvider()
+	u, err := CreateLocalUser(newTestContext(b), "alice", "password1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := login(t, b, u, p)
+	otherCookie := login(t, b, u, p)
+
+	w := httptest.NewRecorder()
+	if err := Logout(newTestContext(b, cookie), w); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := responseCookie(w, SESSION_COOKIE); deleted == nil || deleted.MaxAge >= 0 {
+		t.Errorf("Logout did not delete session cookie: %v", deleted)
+	}
+
+	for _, c := range []*http.Cookie{cookie, otherCookie} {
+		if got, err := p.CurrentUser(newTestContext(b, c)); err != nil || got != nil {
+			t.Errorf("session is valid after logout: %v, %v", got, err)
+		}
+	}
+
+	// Logout with revoked session does nothing.
+	if err := Logout(newTestContext(b, cookie), httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+	u, err = p.Authenticate(newTestContext(b), "alice", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCookie := login(t, b, u, p)
+	if got, err := p.CurrentUser(newTestContext(b, newCookie)); err != nil || got == nil {
+		t.Errorf("new session is not valid: %v, %v", got, err)
+	}
+}
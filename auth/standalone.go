@@ -0,0 +1,14 @@
+//go:build !appengine
+// +build !appengine
+
+package auth
+
+import (
+	"net/http"
+
+	"core/store"
+)
+
+func newHTTPClient(c store.Context) *http.Client {
+	return http.DefaultClient
+}
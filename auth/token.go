@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.google.com/p/gorilla/context"
+
+	"core/entity"
+	"core/store"
+)
+
+const (
+	API_TOKEN_KIND = "apiToken"
+
+	API_TOKEN_SECRET_SIZE = 32
+
+	// API_PATH_PREFIX is the only path tokens authenticate requests to,
+	// so they can't be used to manage tokens, sessions or users.
+	API_PATH_PREFIX = "/api/v1/"
+
+	// LastUsedOn is updated at most once per interval to save writes.
+	API_TOKEN_TOUCH_INTERVAL = time.Minute
+
+	// SCOPE_READ allows safe (GET, HEAD) requests, SCOPE_WRITE all others.
+	SCOPE_READ  = "read"
+	SCOPE_WRITE = "write"
+)
+
+var (
+	ErrInvalidAPIToken = errors.New("Invalid API token.")
+	ErrExpiredAPIToken = errors.New("API token has expired.")
+	ErrAPITokenScope   = errors.New("API token does not allow this request.")
+)
+
+type requestKey int
+
+const (
+	requestUserKey requestKey = iota
+	requestTokenKey
+)
+
+// APIToken authenticates scripts as its owner. Only hash of the secret
+// is stored, the secret itself is shown once on creation.
+type APIToken struct {
+	*entity.Entity `datastore:"-"`
+
+	UserKey    *store.Key
+	Name       string
+	Hash       string
+	Scopes     []string
+	CreatedOn  time.Time
+	LastUsedOn time.Time
+	// Zero ExpiresOn means that token never expires.
+	ExpiresOn time.Time
+}
+
+func NewAPIToken() *APIToken {
+	return &APIToken{
+		Entity: entity.NewEntity(API_TOKEN_KIND),
+	}
+}
+
+func (t *APIToken) SetKey(key *store.Key) {
+	if t.Entity == nil {
+		t.Entity = entity.NewEntity(API_TOKEN_KIND)
+	}
+	t.Entity.SetKey(key)
+}
+
+func (t *APIToken) IsExpired() bool {
+	return !t.ExpiresOn.IsZero() && t.ExpiresOn.Before(time.Now())
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether the token may be used for request with
+// the given method.
+func (t *APIToken) allows(method string) bool {
+	if method == "GET" || method == "HEAD" {
+		return t.HasScope(SCOPE_READ) || t.HasScope(SCOPE_WRITE)
+	}
+	return t.HasScope(SCOPE_WRITE)
+}
+
+func hashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken creates token owned by the user and returns it with
+// the secret. Zero ttl means that token never expires.
+func CreateAPIToken(c store.Context, user *User, name string, scopes []string, ttl time.Duration) (*APIToken, string, error) {
+	secret, err := RandomString(API_TOKEN_SECRET_SIZE)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := NewAPIToken()
+	token.UserKey = user.Key()
+	token.Name = name
+	token.Hash = hashAPITokenSecret(secret)
+	token.Scopes = scopes
+	token.CreatedOn = time.Now()
+	if ttl > 0 {
+		token.ExpiresOn = token.CreatedOn.Add(ttl)
+	}
+	if err := entity.Put(c, token); err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+func GetAPITokenBySecret(c store.Context, secret string) (*APIToken, error) {
+	q := store.NewQuery(API_TOKEN_KIND).Filter("Hash =", hashAPITokenSecret(secret)).Limit(1)
+	tokens := make([]*APIToken, 0, 1)
+	keys, err := q.GetAll(c, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, store.ErrNoSuchEntity
+	}
+	tokens[0].SetKey(keys[0])
+	return tokens[0], nil
+}
+
+// GetUserAPITokens returns tokens of the user, newest first.
+func GetUserAPITokens(c store.Context, user *User) ([]*APIToken, error) {
+	q := store.NewQuery(API_TOKEN_KIND).Filter("UserKey =", user.Key()).Order("-CreatedOn")
+	tokens := make([]*APIToken, 0)
+	keys, err := q.GetAll(c, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		tokens[i].SetKey(key)
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken deletes token of the user.
+func RevokeAPIToken(c store.Context, user *User, id int64) error {
+	key := store.NewKey(API_TOKEN_KIND, "", id, nil)
+	token := NewAPIToken()
+	if err := store.Get(c, key, token); err != nil {
+		return err
+	}
+	if !token.UserKey.Equal(user.Key()) {
+		return store.ErrNoSuchEntity
+	}
+	return store.Delete(c, key)
+}
+
+// BearerToken returns secret from "Authorization: Bearer <secret>" header.
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// authenticateAPIToken returns token with the given secret and its owner
+// if the token may be used for request with the method.
+func authenticateAPIToken(c store.Context, secret, method string) (*APIToken, *User, error) {
+	token, err := GetAPITokenBySecret(c, secret)
+	if err == store.ErrNoSuchEntity {
+		return nil, nil, ErrInvalidAPIToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if token.IsExpired() {
+		return nil, nil, ErrExpiredAPIToken
+	}
+	if !token.allows(method) {
+		return nil, nil, ErrAPITokenScope
+	}
+
+	user, err := GetUser(c, token.UserKey)
+	if err == store.ErrNoSuchEntity {
+		return nil, nil, ErrInvalidAPIToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if time.Since(token.LastUsedOn) > API_TOKEN_TOUCH_INTERVAL {
+		token.LastUsedOn = time.Now()
+		if err := entity.Put(c, token); err != nil {
+			c.Errorf("error updating token: %v", err)
+		}
+	}
+
+	return token, user, nil
+}
+
+// requestUser returns user authenticated by TokenHandler.
+func requestUser(r *http.Request) *User {
+	if r == nil {
+		return nil
+	}
+	if u, ok := context.Get(r, requestUserKey).(*User); ok {
+		return u
+	}
+	return nil
+}
+
+// RequestAPIToken returns token the request is authenticated with.
+func RequestAPIToken(r *http.Request) *APIToken {
+	if t, ok := context.Get(r, requestTokenKey).(*APIToken); ok {
+		return t
+	}
+	return nil
+}
+
+// TokenHandler authenticates API requests with "Authorization: Bearer"
+// header, so CurrentUser returns owner of the token. The header is
+// ignored outside of API_PATH_PREFIX.
+type TokenHandler struct {
+	handler http.Handler
+}
+
+func NewTokenHandler(handler http.Handler) *TokenHandler {
+	return &TokenHandler{handler}
+}
+
+func (h *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	secret, ok := BearerToken(r)
+	if !ok || !strings.HasPrefix(r.URL.Path, API_PATH_PREFIX) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	c := store.NewContext(r)
+	token, user, err := authenticateAPIToken(c, secret, r.Method)
+	if err != nil {
+		status := http.StatusUnauthorized
+		switch err {
+		case ErrInvalidAPIToken, ErrExpiredAPIToken:
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		case ErrAPITokenScope:
+			status = http.StatusForbidden
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		default:
+			c.Errorf("error authenticating token: %v", err)
+			status = http.StatusInternalServerError
+		}
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	context.Set(r, requestUserKey, user)
+	context.Set(r, requestTokenKey, token)
+	defer context.Clear(r)
+
+	h.handler.ServeHTTP(w, r)
+}
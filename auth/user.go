@@ -1,21 +1,20 @@
 package auth
 
 import (
-	"errors"
-
-	"appengine"
-	"appengine/datastore"
-	"appengine/user"
+	"time"
 
 	"core/entity"
+	"core/store"
 )
 
 const (
 	USER_KIND = "user"
 )
 
-func GetUserQuery() *datastore.Query {
-	return datastore.NewQuery(USER_KIND)
+var Users = entity.NewRepository(USER_KIND, NewUser, time.Hour)
+
+func GetUserQuery() *store.Query {
+	return store.NewQuery(USER_KIND)
 }
 
 func NewUser() *User {
@@ -28,69 +27,16 @@ func initUser(user *User) {
 	user.Entity = entity.NewEntity(USER_KIND)
 }
 
-func GetUserByUserId(c appengine.Context, userId string) (*User, error) {
-	q := GetUserQuery().Filter("UserId =", userId).Limit(2)
-	users := make([]User, 0, 2)
-	keys, err := q.GetAll(c, &users)
-	if err != nil {
-		return nil, err
-	}
-	switch len(keys) {
-	case 0:
-		return nil, nil
-	case 1:
-		u := &users[0]
-		initUser(u)
-		u.SetKey(keys[0])
-		return u, nil
-	}
-	return nil, errors.New("Got multiple results for unique field.")
-}
-
-func CreateUserFromAppengine(c appengine.Context, appengineUser *user.User) (*User, error) {
-	u := &User{
-		UserId: appengineUser.ID,
-
-		Name:       appengineUser.String(),
-		Email:      appengineUser.Email,
-		AuthDomain: appengineUser.AuthDomain,
-		IsAdmin:    user.IsAdmin(c),
-
-		FederatedIdentity: appengineUser.FederatedIdentity,
-		FederatedProvider: appengineUser.FederatedProvider,
-	}
-	initUser(u)
-	if err := entity.Put(c, u); err != nil {
-		return nil, err
-	}
-	return u, nil
+func GetUser(c store.Context, key *store.Key) (*User, error) {
+	return Users.Get(c, key)
 }
 
-func CurrentUser(c appengine.Context) *User {
-	appengineUser := user.Current(c)
-	if appengineUser == nil {
-		return Anonymous
-	}
-
-	u, err := GetUserByUserId(c, appengineUser.ID)
-	if err != nil {
-		return Anonymous
-	}
-
-	if u == nil {
-		u, err = CreateUserFromAppengine(c, appengineUser)
-		if err != nil {
-			return Anonymous
-		}
-	}
-
-	if user.IsAdmin(c) && !u.IsAdmin {
-		u.IsAdmin = true
-		// ignore error
-		entity.Put(c, u)
+func GetUserByUserId(c store.Context, userId string) (*User, error) {
+	u, err := Users.GetUnique(c, GetUserQuery().Filter("UserId =", userId))
+	if err == store.ErrNoSuchEntity {
+		return nil, nil
 	}
-
-	return u
+	return u, err
 }
 
 type User struct {
@@ -103,18 +49,52 @@ type User struct {
 	Email      string
 	AuthDomain string
 	IsAdmin    bool
+	// Role is one of Roles; empty for users created before roles.
+	Role string
 
 	FederatedIdentity string
 	FederatedProvider string
+
+	// PasswordHash is bcrypt hash of the local password.
+	PasswordHash []byte `datastore:",noindex"`
+	// SessionGeneration is incremented on logout to revoke sessions.
+	SessionGeneration int `datastore:",noindex"`
+
+	// Public profile. Bio is markdown rendered to BioHTMLBytes on save.
+	DisplayName   string
+	BioBytes      []byte   `datastore:",noindex"`
+	BioHTMLBytes  []byte   `datastore:",noindex"`
+	AvatarURL     string   `datastore:",noindex"`
+	AvatarBlobKey string   `datastore:",noindex"`
+	Website       string   `datastore:",noindex"`
+	Links         []string `datastore:",noindex"`
+
+	provider Provider
 }
 
-func (u *User) SetKey(key *datastore.Key) {
+func (u *User) SetKey(key *store.Key) {
 	if u.Entity == nil {
 		u.Entity = entity.NewEntity(USER_KIND)
 	}
 	u.Entity.SetKey(key)
 }
 
+// PublicName returns name shown to other users.
+func (u *User) PublicName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Name
+}
+
+func (u *User) Bio() string {
+	return string(u.BioBytes)
+}
+
+func (u *User) BioHTML() string {
+	return string(u.BioHTMLBytes)
+}
+
 func (u *User) IsAuth() bool {
 	return u != Anonymous
 }
@@ -124,3 +104,24 @@ func (u *User) IsAnonymous() bool {
 }
 
 var Anonymous = &User{}
+
+// ProfileHook is called after the user's name or email shown next to
+// the user's articles is changed.
+type ProfileHook func(c store.Context, u *User)
+
+var profileHooks []ProfileHook
+
+// AddProfileHook registers hook called by ProfileChanged. Hooks are
+// meant to be added during initialization.
+func AddProfileHook(hook ProfileHook) {
+	profileHooks = append(profileHooks, hook)
+}
+
+// ProfileChanged runs profile hooks. It must be called after saving the
+// user whose PublicName or Email changed; other changes of users, e.g.
+// of roles or sessions, don't run hooks.
+func ProfileChanged(c store.Context, u *User) {
+	for _, hook := range profileHooks {
+		hook(c, u)
+	}
+}
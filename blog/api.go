@@ -0,0 +1,386 @@
+package blog
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"code.google.com/p/gorilla/mux"
+
+	"auth"
+	"core"
+	"core/store"
+)
+
+const (
+	API_PAGE_SIZE     = 20
+	API_MAX_PAGE_SIZE = 100
+	API_MAX_BODY_SIZE = 1 << 20
+)
+
+var (
+	errAPIAuthRequired     = errors.New("Authentication required.")
+	errAPIForbidden        = errors.New("Permission denied.")
+	errAPINotFound         = errors.New("Article not found.")
+	errAPIMethodNotAllowed = errors.New("Method not allowed.")
+	errAPIInvalidCursor    = errors.New("Invalid cursor.")
+	errAPIInvalidLimit     = errors.New("Invalid limit.")
+	errAPITitleRequired    = errors.New("Title and text are required.")
+)
+
+type articleJSON struct {
+	Id          int64      `json:"id"`
+	Title       string     `json:"title"`
+	Text        string     `json:"text"`
+	HTML        string     `json:"html"`
+	Tags        []string   `json:"tags"`
+	IsPublic    bool       `json:"isPublic"`
+	IsScheduled bool       `json:"isScheduled"`
+	PublishAt   *time.Time `json:"publishAt,omitempty"`
+	ShowTOC     bool       `json:"showTOC"`
+	CreatedOn   time.Time  `json:"createdOn"`
+	URL         string     `json:"url"`
+}
+
+func newArticleJSON(a *Article) *articleJSON {
+	j := &articleJSON{
+		Id:          a.Key().IntID(),
+		Title:       a.Title,
+		Text:        a.Text(),
+		HTML:        a.HTML(),
+		Tags:        a.Tags,
+		IsPublic:    a.IsPublic,
+		IsScheduled: a.IsScheduled,
+		ShowTOC:     a.ShowTOC,
+		CreatedOn:   a.CreatedOn,
+	}
+	if j.Tags == nil {
+		j.Tags = []string{}
+	}
+	if !a.PublishAt.IsZero() {
+		publishAt := a.PublishAt
+		j.PublishAt = &publishAt
+	}
+	if u, err := a.URL(); err == nil {
+		j.URL = u.String()
+	}
+	return j
+}
+
+// articleInput is request body of create and update. Omitted fields
+// are left unchanged on update.
+type articleInput struct {
+	Title     *string    `json:"title"`
+	Text      *string    `json:"text"`
+	Tags      []string   `json:"tags"`
+	IsPublic  *bool      `json:"isPublic"`
+	PublishAt *time.Time `json:"publishAt"`
+	ShowTOC   *bool      `json:"showTOC"`
+}
+
+// apiUser returns authenticated user or writes error response and returns
+// nil. Requests authenticated by API token are resolved by
+// auth.TokenHandler.
+func apiUser(c store.Context, w http.ResponseWriter) *auth.User {
+	user := auth.CurrentUser(c)
+	if !user.IsAuth() {
+		core.HandleJSONError(c, w, http.StatusUnauthorized, errAPIAuthRequired)
+		return nil
+	}
+	return user
+}
+
+// apiPermission returns authenticated user that has the permission on
+// object owned by owner or writes error response and returns nil.
+func apiPermission(c store.Context, w http.ResponseWriter, perm string, owner *store.Key) *auth.User {
+	user := apiUser(c, w)
+	if user == nil {
+		return nil
+	}
+	if !user.CanOwn(perm, owner) {
+		core.HandleJSONError(c, w, http.StatusForbidden, errAPIForbidden)
+		return nil
+	}
+	return user
+}
+
+// writeJSON writes value with ETag header or responds 304 if client
+// already has it.
+func writeJSON(c store.Context, w http.ResponseWriter, r *http.Request, status int, value interface{}) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	sum := sha1.Sum(b)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	w.Header().Set("ETag", etag)
+	if status == http.StatusOK && core.ETagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func decodeArticleInput(w http.ResponseWriter, r *http.Request) (*articleInput, error) {
+	input := &articleInput{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, API_MAX_BODY_SIZE))
+	if err := dec.Decode(input); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+func APIArticlesHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	switch r.Method {
+	case "GET", "HEAD":
+		apiListArticles(c, w, r)
+	case "POST":
+		apiCreateArticle(c, w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		core.HandleJSONError(c, w, http.StatusMethodNotAllowed, errAPIMethodNotAllowed)
+	}
+}
+
+func apiListArticles(c store.Context, w http.ResponseWriter, r *http.Request) {
+	user := auth.CurrentUser(c)
+
+	if err := PublishScheduledArticles(c); err != nil {
+		core.HandleJSONError(c, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	limit := API_PAGE_SIZE
+	if s := r.FormValue("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > API_MAX_PAGE_SIZE {
+			core.HandleJSONError(c, w, http.StatusBadRequest, errAPIInvalidLimit)
+			return
+		}
+		limit = n
+	}
+
+	q, _ := listingQuery(user)
+	if s := r.FormValue("cursor"); s != "" {
+		cursor, err := store.DecodeCursor(s)
+		if err != nil {
+			core.HandleJSONError(c, w, http.StatusBadRequest, errAPIInvalidCursor)
+			return
+		}
+		q = q.Start(cursor)
+	}
+
+	articles, p, err := Articles.GetPage(c, q, limit)
+	if err == store.ErrInvalidCursor {
+		core.HandleJSONError(c, w, http.StatusBadRequest, errAPIInvalidCursor)
+		return
+	}
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]*articleJSON, len(articles))
+	for i, article := range articles {
+		items[i] = newArticleJSON(article)
+	}
+
+	result := map[string]interface{}{
+		"articles": items,
+		"more":     p.More,
+	}
+	if p.More {
+		result["cursor"] = p.Start.String()
+	}
+	writeJSON(c, w, r, http.StatusOK, result)
+}
+
+func apiCreateArticle(c store.Context, w http.ResponseWriter, r *http.Request) {
+	user := apiPermission(c, w, auth.PERM_ARTICLE_CREATE, nil)
+	if user == nil {
+		return
+	}
+
+	input, err := decodeArticleInput(w, r)
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusBadRequest, err)
+		return
+	}
+	if input.Title == nil || *input.Title == "" || input.Text == nil || *input.Text == "" {
+		core.HandleJSONError(c, w, http.StatusBadRequest, errAPITitleRequired)
+		return
+	}
+
+	var publishAt time.Time
+	if input.PublishAt != nil {
+		publishAt = *input.PublishAt
+	}
+	isPublic := input.IsPublic != nil && *input.IsPublic
+	showTOC := input.ShowTOC == nil || *input.ShowTOC
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusBadRequest, err)
+		return
+	}
+	if isPublic && !user.CanOwn(auth.PERM_ARTICLE_PUBLISH, user.Key()) {
+		core.HandleJSONError(c, w, http.StatusForbidden, errPublishForbidden)
+		return
+	}
+	article, err := CreateArticle(c, user,
+		*input.Title,
+		*input.Text,
+		tags,
+		isPublic,
+		publishAt,
+		showTOC,
+	)
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if u, err := Router.GetRoute("apiArticle").URL("id", strconv.FormatInt(article.Key().IntID(), 10)); err == nil {
+		w.Header().Set("Location", u.String())
+	}
+	writeJSON(c, w, r, http.StatusCreated, newArticleJSON(article))
+}
+
+func APIArticleHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusNotFound, errAPINotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		apiGetArticle(c, w, r, id)
+	case "PUT":
+		apiUpdateArticle(c, w, r, id)
+	case "DELETE":
+		apiDeleteArticle(c, w, r, id)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		core.HandleJSONError(c, w, http.StatusMethodNotAllowed, errAPIMethodNotAllowed)
+	}
+}
+
+func apiGetArticle(c store.Context, w http.ResponseWriter, r *http.Request, id int64) {
+	user := auth.CurrentUser(c)
+
+	if err := PublishScheduledArticles(c); err != nil {
+		core.HandleJSONError(c, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	article, err := GetArticleById(c, id, !user.Can(auth.PERM_ARTICLE_UPDATE))
+	if err != nil || !article.IsVisibleTo(user) {
+		core.HandleJSONError(c, w, http.StatusNotFound, errAPINotFound)
+		return
+	}
+
+	writeJSON(c, w, r, http.StatusOK, newArticleJSON(article))
+}
+
+func apiUpdateArticle(c store.Context, w http.ResponseWriter, r *http.Request, id int64) {
+	user := apiUser(c, w)
+	if user == nil {
+		return
+	}
+
+	article, err := GetArticleById(c, id, false)
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusNotFound, errAPINotFound)
+		return
+	}
+	if !user.CanOwn(auth.PERM_ARTICLE_UPDATE, article.AuthorKey) {
+		core.HandleJSONError(c, w, http.StatusForbidden, errAPIForbidden)
+		return
+	}
+
+	input, err := decodeArticleInput(w, r)
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusBadRequest, err)
+		return
+	}
+
+	title, text, tags := article.Title, article.Text(), article.Tags
+	isPublic, publishAt := article.IsPublic || article.IsScheduled, article.PublishAt
+	showTOC := article.ShowTOC
+	if input.Title != nil {
+		title = *input.Title
+	}
+	if input.Text != nil {
+		text = *input.Text
+	}
+	if input.Tags != nil {
+		tags, err = normalizeTags(input.Tags)
+		if err != nil {
+			core.HandleJSONError(c, w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if input.IsPublic != nil {
+		isPublic = *input.IsPublic
+	}
+	if input.PublishAt != nil {
+		publishAt = *input.PublishAt
+	}
+	if input.ShowTOC != nil {
+		showTOC = *input.ShowTOC
+	}
+	if title == "" || text == "" {
+		core.HandleJSONError(c, w, http.StatusBadRequest, errAPITitleRequired)
+		return
+	}
+	if isPublic && !(article.IsPublic || article.IsScheduled) &&
+		!user.CanOwn(auth.PERM_ARTICLE_PUBLISH, article.AuthorKey) {
+		core.HandleJSONError(c, w, http.StatusForbidden, errPublishForbidden)
+		return
+	}
+
+	err = UpdateArticle(c, article, user, title, text, tags, isPublic, publishAt, showTOC)
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(c, w, r, http.StatusOK, newArticleJSON(article))
+}
+
+func apiDeleteArticle(c store.Context, w http.ResponseWriter, r *http.Request, id int64) {
+	user := apiUser(c, w)
+	if user == nil {
+		return
+	}
+
+	article, err := GetArticleById(c, id, false)
+	if err != nil {
+		core.HandleJSONError(c, w, http.StatusNotFound, errAPINotFound)
+		return
+	}
+	if !user.CanOwn(auth.PERM_ARTICLE_DELETE, article.AuthorKey) {
+		core.HandleJSONError(c, w, http.StatusForbidden, errAPIForbidden)
+		return
+	}
+
+	if err := DeleteArticle(c, article); err != nil {
+		core.HandleJSONError(c, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,106 @@
+//go:build appengine
+// +build appengine
+
+package blog
+
+import (
+	"net/http"
+
+	"appengine"
+	"appengine/blobstore"
+	"github.com/vmihailenco/gforms/gaeforms"
+
+	"auth"
+	"core"
+	"core/store"
+	"core/store/gae"
+)
+
+// isArticleFormValid validates form posted through blobstore upload URL.
+func isArticleFormValid(r *http.Request, form *ArticleForm) (bool, error) {
+	blobs, values, err := blobstore.ParseUpload(r)
+	if err != nil {
+		return false, err
+	}
+	return gaeforms.IsBlobstoreFormValid(form, blobs, values), nil
+}
+
+func ImageUploadURLHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	imageUploadURL, err := Router.GetRoute("imageUpload").URL()
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	uploadURL, err := blobstore.UploadURL(gae.AppengineContext(c), imageUploadURL.Path, nil)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	core.HandleJSON(c, w, map[string]string{"url": uploadURL.Path})
+}
+
+func deleteBlobs(c appengine.Context, blobs map[string][]*blobstore.BlobInfo) {
+	for _, blobInfos := range blobs {
+		for _, blobInfo := range blobInfos {
+			if err := blobstore.Delete(c, blobInfo.BlobKey); err != nil {
+				c.Errorf("error deleting blob: %v", err)
+			}
+		}
+	}
+}
+
+func ImageUploadHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+	ac := gae.AppengineContext(c)
+
+	blobs, _, err := blobstore.ParseUpload(r)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	user := core.RequirePermission(c, w, auth.PERM_ARTICLE_CREATE, nil)
+	if user == nil {
+		deleteBlobs(ac, blobs)
+		return
+	}
+
+	blobInfos := blobs["Image"]
+	if len(blobInfos) != 1 {
+		deleteBlobs(ac, blobs)
+		core.HandleJSONError(c, w, http.StatusBadRequest, errNoImage)
+		return
+	}
+	blobInfo := blobInfos[0]
+
+	config, err := decodeImageConfig(c, blobInfo)
+	if err != nil {
+		deleteBlobs(ac, blobs)
+		core.HandleJSONError(c, w, http.StatusBadRequest, err)
+		return
+	}
+
+	image, err := CreateImage(c, blobInfo, config, user)
+	if err != nil {
+		deleteBlobs(ac, blobs)
+		core.HandleError(c, w, err)
+		return
+	}
+
+	servingURL, err := image.ServingURL(c)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	core.HandleJSON(c, w, map[string]interface{}{
+		"url":      servingURL.String(),
+		"filename": image.Filename,
+		"width":    image.Width,
+		"height":   image.Height,
+	})
+}
@@ -1,7 +1,10 @@
 package blog
 
 import (
+	"auth"
 	"core"
+	"core/entity"
+	"core/store"
 )
 
 const (
@@ -13,16 +16,42 @@ var (
 )
 
 func init() {
+	core.RegisterTemplateFunc("tagCloud", tagCloud)
+
+	entity.AddHook(ARTICLE_KIND, bumpArticleListings)
+	entity.AddHook(TAG_KIND, bumpArticleListings)
+	auth.AddProfileHook(func(c store.Context, u *auth.User) {
+		ArticleListings.Bump(c)
+	})
+	entity.AddHook(COMMENT_KIND, bumpCommentListings)
+
 	Router.HandleFunc("/article/create/", ArticleCreateHandler).Name("articleCreate")
 	Router.HandleFunc("/article/update/{id:[0-9]+}/", ArticleUpdateHandler).Name("articleUpdate")
 	Router.HandleFunc("/article/delete/{id:[0-9]+}/", ArticleDeleteHandler).Name("articleDelete")
-	Router.HandleFunc("/article/page/{page:[0-9]+}/", ArticlePageHandler).Name("articlePage")
+	Router.HandleFunc("/article/history/{id:[0-9]+}/", ArticleHistoryHandler).Name("articleHistory")
+	Router.HandleFunc("/article/diff/{id:[0-9]+}/", ArticleDiffHandler).Name("articleDiff")
+	Router.HandleFunc("/article/restore/{id:[0-9]+}/{revision:[0-9]+}/", ArticleRestoreHandler).Name("articleRestore")
+	Router.HandleFunc("/article/page/{page:[0-9]+}/", listingResponses.HandlerFunc(ArticlePageHandler)).Name("articlePage")
 	Router.HandleFunc("/articles/{id:[0-9]+}/", ArticlePermaLinkHandler).Name("articlePermaLink")
 	Router.HandleFunc("/articles/{id:[0-9]+}/{slug:[0-9A-Za-z_-]+}/", ArticleHandler).Name("article")
-	Router.HandleFunc("/feed/", ArticleFeedHandler).Name("articleFeed")
+	Router.HandleFunc("/articles/{id:[0-9]+}/comments/", CommentCreateHandler).Name("commentCreate")
+	Router.HandleFunc("/feed/", listingResponses.HandlerFunc(ArticleFeedHandler)).Name("articleFeed")
+	Router.HandleFunc("/tags/{tag:[\\pL\\pN_-]+}/", listingResponses.HandlerFunc(TagHandler)).Name("tag")
+	Router.HandleFunc("/tags/{tag:[\\pL\\pN_-]+}/page/{page:[0-9]+}/", listingResponses.HandlerFunc(TagHandler)).Name("tagPage")
+	Router.HandleFunc("/tags/{tag:[\\pL\\pN_-]+}/feed/", listingResponses.HandlerFunc(TagFeedHandler)).Name("tagFeed")
+	Router.HandleFunc("/authors/{id:[0-9]+}/", listingResponses.HandlerFunc(AuthorHandler)).Name("author")
+	Router.HandleFunc("/authors/{id:[0-9]+}/page/{page:[0-9]+}/", listingResponses.HandlerFunc(AuthorHandler)).Name("authorPage")
+	Router.HandleFunc("/authors/{id:[0-9]+}/feed/", listingResponses.HandlerFunc(AuthorFeedHandler)).Name("authorFeed")
+	Router.HandleFunc("/admin/comments/", CommentModerationHandler).Name("commentModeration")
+	Router.HandleFunc("/admin/comments/{status:[a-z]+}/", CommentModerationHandler).Name("commentModerationStatus")
+	Router.HandleFunc("/admin/comments/{status:[a-z]+}/page/{page:[0-9]+}/", CommentModerationHandler).Name("commentModerationPage")
+	Router.HandleFunc("/search/", SearchHandler).Name("search")
+	Router.HandleFunc("/admin/search/reindex/", SearchReindexHandler).Name("searchReindex")
+	Router.HandleFunc("/api/v1/articles", APIArticlesHandler).Name("apiArticles")
+	Router.HandleFunc("/api/v1/articles/{id:[0-9]+}", APIArticleHandler).Name("apiArticle")
 	Router.HandleFunc("/markdown-preview/", MarkdownPreviewHandler).Name("markdownPreview")
 	Router.HandleFunc("/about/", core.TemplateHandler("templates/layout.html", "templates/about.html")).Name("about")
-	Router.HandleFunc("/", ArticlePageHandler).Name("home")
+	Router.HandleFunc("/", listingResponses.HandlerFunc(ArticlePageHandler)).Name("home")
 
 	Router.HandleFunc("/image-upload/url/", ImageUploadURLHandler).Name("imageUploadURL")
 	Router.HandleFunc("/image-upload/", ImageUploadHandler).Name("imageUpload")
@@ -0,0 +1,238 @@
+package blog
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"time"
+
+	"auth"
+	"blog/render"
+	"core/cache"
+	"core/entity"
+	"core/pager"
+	"core/store"
+)
+
+const (
+	COMMENT_KIND = "comment"
+
+	COMMENT_PENDING  = "pending"
+	COMMENT_APPROVED = "approved"
+	COMMENT_SPAM     = "spam"
+)
+
+var (
+	Comments = entity.NewRepository(COMMENT_KIND, NewComment, 0)
+
+	// CommentRenderer renders comments and user bios.
+	CommentRenderer render.Renderer = render.NewPipeline(render.Options{
+		Tables:      true,
+		Smartypants: true,
+		Highlight:   true,
+		Safe:        true,
+		Policy:      render.CommentPolicy,
+	})
+
+	// commentListings versions cached cursors of the moderation queues.
+	commentListings = cache.NewNamespace(COMMENT_KIND + "-listings")
+)
+
+func bumpCommentListings(c store.Context, key *store.Key) {
+	commentListings.Bump(c)
+}
+
+var commentStatuses = []string{COMMENT_PENDING, COMMENT_APPROVED, COMMENT_SPAM}
+
+func isCommentStatus(status string) bool {
+	for _, s := range commentStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCommentPager returns pager for the moderation queue of the given status.
+func NewCommentPager(c store.Context, status string, page int) *pager.Pager {
+	q := NewCommentQuery().Filter("Status =", status).Order("-CreatedOn")
+	return pager.NewPager(c, commentListings.Key(c, status), q, page, PAGE_SIZE)
+}
+
+type Comment struct {
+	*entity.Entity `datastore:"-"`
+
+	AuthorKey  *store.Key
+	AuthorName string
+	TextBytes  []byte `datastore:",noindex"`
+	HTMLBytes  []byte `datastore:",noindex"`
+	Status     string
+	CreatedOn  time.Time
+}
+
+func NewComment() *Comment {
+	return &Comment{
+		Entity: entity.NewEntity(COMMENT_KIND),
+	}
+}
+
+func NewCommentQuery() *store.Query {
+	return store.NewQuery(COMMENT_KIND)
+}
+
+func (c *Comment) SetKey(key *store.Key) {
+	if c.Entity == nil {
+		c.Entity = entity.NewEntity(COMMENT_KIND)
+	}
+	c.Entity.SetKey(key)
+}
+
+func (c *Comment) Text() string {
+	return string(c.TextBytes)
+}
+
+func (c *Comment) HTML() string {
+	return string(c.HTMLBytes)
+}
+
+func (c *Comment) IsApproved() bool {
+	return c.Status == COMMENT_APPROVED
+}
+
+func (c *Comment) ArticleURL() (*url.URL, error) {
+	return Router.GetRoute("articlePermaLink").URL(
+		"id",
+		strconv.FormatInt(c.Key().Parent().IntID(), 10),
+	)
+}
+
+// RenderCommentMarkdown renders comment text like article text, but
+// comments come from untrusted users, so raw HTML is skipped.
+func RenderCommentMarkdown(text []byte) []byte {
+	return CommentRenderer.Render(text).HTML
+}
+
+// RerenderComments renders text of all comments again and returns
+// number of changed comments.
+func RerenderComments(c store.Context) (int, error) {
+	comments, err := Comments.GetAll(c, NewCommentQuery())
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, comment := range comments {
+		html := RenderCommentMarkdown(comment.TextBytes)
+		if bytes.Equal(html, comment.HTMLBytes) {
+			continue
+		}
+		comment.HTMLBytes = html
+		if err := Comments.Put(c, comment); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// CreateComment adds comment to the article. Comments of users who may
+// moderate comments are approved immediately, all others wait in the
+// moderation queue.
+func CreateComment(c store.Context, article *Article, user *auth.User, text string) (*Comment, error) {
+	textBytes := []byte(text)
+
+	comment := &Comment{
+		AuthorKey:  user.Key(),
+		AuthorName: user.PublicName(),
+		TextBytes:  textBytes,
+		HTMLBytes:  RenderCommentMarkdown(textBytes),
+		Status:     COMMENT_PENDING,
+		CreatedOn:  time.Now(),
+	}
+	if user.Can(auth.PERM_COMMENT_MODERATE) {
+		comment.Status = COMMENT_APPROVED
+	}
+
+	key := store.NewIncompleteKey(COMMENT_KIND, article.Key())
+	key, err := store.Put(c, key, comment)
+	if err != nil {
+		return nil, err
+	}
+	comment.SetKey(key)
+	entity.Changed(c, key)
+
+	return comment, nil
+}
+
+func GetComment(c store.Context, key *store.Key) (*Comment, error) {
+	return Comments.Get(c, key)
+}
+
+// GetArticleComments returns approved comments of the article.
+func GetArticleComments(c store.Context, article *Article) ([]*Comment, error) {
+	q := NewCommentQuery().
+		Ancestor(article.Key()).
+		Filter("Status =", COMMENT_APPROVED).
+		Order("CreatedOn")
+	return Comments.GetAll(c, q)
+}
+
+// GetUserComments returns latest approved comments of the user
+// on public articles.
+func GetUserComments(c store.Context, user *auth.User, limit int) ([]*Comment, error) {
+	q := NewCommentQuery().
+		Filter("AuthorKey =", user.Key()).
+		Filter("Status =", COMMENT_APPROVED).
+		Order("-CreatedOn").
+		Limit(limit)
+
+	comments, err := Comments.GetAll(c, q)
+	if err != nil {
+		return nil, err
+	}
+
+	public := comments[:0]
+	for _, comment := range comments {
+		article, err := GetArticleById(c, comment.Key().Parent().IntID(), true)
+		if err == store.ErrNoSuchEntity {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if article.IsPublic {
+			public = append(public, comment)
+		}
+	}
+	return public, nil
+}
+
+func GetComments(c store.Context, p *pager.Pager) ([]*Comment, error) {
+	return Comments.GetPager(c, p)
+}
+
+func SetCommentsStatus(c store.Context, keys []*store.Key, status string) error {
+	for _, key := range keys {
+		comment := NewComment()
+		err := store.RunInTransaction(c, func(c store.Context) error {
+			if err := store.Get(c, key, comment); err != nil {
+				return err
+			}
+			comment.Status = status
+			_, err := store.Put(c, key, comment)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		entity.Changed(c, key)
+	}
+	return nil
+}
+
+func DeleteComments(c store.Context, keys []*store.Key) error {
+	for _, key := range keys {
+		if err := Comments.Delete(c, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,14 +1,44 @@
 package blog
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/vmihailenco/gforms"
 )
 
 type ArticleForm struct {
 	*gforms.BaseForm
-	Title    *gforms.StringField
-	Text     *gforms.StringField
-	IsPublic *gforms.BoolField
+	Title     *gforms.StringField
+	Text      *gforms.StringField
+	Tags      *gforms.StringField
+	IsPublic  *gforms.BoolField
+	PublishAt *gforms.StringField
+	ShowTOC   *gforms.BoolField
+}
+
+// PUBLISH_AT_LAYOUT is the format of datetime-local input value.
+const PUBLISH_AT_LAYOUT = "2006-01-02T15:04"
+
+var (
+	errInvalidPublishAt = errors.New("Enter date and time as YYYY-MM-DD HH:MM.")
+	errPublishForbidden = errors.New("You are not allowed to publish this article.")
+)
+
+// parsePublishAt parses publication time entered in UTC. Empty value
+// means "now" and is returned as zero time.
+func parsePublishAt(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{PUBLISH_AT_LAYOUT, "2006-01-02 15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errInvalidPublishAt
 }
 
 func NewArticleForm(article *Article) *ArticleForm {
@@ -19,21 +49,62 @@ func NewArticleForm(article *Article) *ArticleForm {
 	text := gforms.NewTextareaStringField()
 	text.MinLen = 1
 
+	tags := gforms.NewStringField()
+	tags.IsRequired = false
+	tags.Label = "Tags (comma separated)"
+
 	isPublic := gforms.NewBoolField()
 	isPublic.IsRequired = false
 	isPublic.Label = "Is public?"
 
+	publishAt := gforms.NewStringField()
+	publishAt.IsRequired = false
+	publishAt.Label = "Publish at (UTC, empty for now)"
+
+	showTOC := gforms.NewBoolField()
+	showTOC.IsRequired = false
+	showTOC.Label = "Show table of contents?"
+	showTOC.SetInitial(true)
+
 	if article != nil {
+		showTOC.SetInitial(article.ShowTOC)
 		title.SetInitial(article.Title)
 		text.SetInitial(article.Text())
-		isPublic.SetInitial(article.IsPublic)
+		tags.SetInitial(strings.Join(article.Tags, ", "))
+		isPublic.SetInitial(article.IsPublic || article.IsScheduled)
+		if article.IsPublic || !article.PublishAt.IsZero() {
+			publishAt.SetInitial(article.PublishedOn().UTC().Format(PUBLISH_AT_LAYOUT))
+		}
 	}
 
 	f := &ArticleForm{
+		BaseForm:  &gforms.BaseForm{},
+		Title:     title,
+		Text:      text,
+		Tags:      tags,
+		IsPublic:  isPublic,
+		PublishAt: publishAt,
+		ShowTOC:   showTOC,
+	}
+	gforms.InitForm(f)
+
+	return f
+}
+
+type CommentForm struct {
+	*gforms.BaseForm
+	Text *gforms.StringField
+}
+
+func NewCommentForm() *CommentForm {
+	text := gforms.NewTextareaStringField()
+	text.MinLen = 1
+	text.MaxLen = 5000
+	text.Label = "Comment"
+
+	f := &CommentForm{
 		BaseForm: &gforms.BaseForm{},
-		Title:    title,
 		Text:     text,
-		IsPublic: isPublic,
 	}
 	gforms.InitForm(f)
 
@@ -1,27 +1,52 @@
 package blog
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
-	"appengine"
-	"appengine/blobstore"
 	"code.google.com/p/gorilla/mux"
-	"github.com/russross/blackfriday"
 	"github.com/vmihailenco/gforms"
-	"github.com/vmihailenco/gforms/gaeforms"
 
 	"auth"
 	"core"
+	"core/diff"
+	"core/pager"
+	"core/store"
 	"tmplt"
 )
 
 const (
 	PAGE_SIZE = 20
+
+	LISTING_CACHE_EXPIRATION = 24 * time.Hour
 )
 
+// listingResponses caches listing pages and feeds served to anonymous
+// users until articles change. Listings don't depend on query, and
+// scheduled articles are published before cached pages are served.
+var listingResponses = core.NewResponseCache("blog-listing", core.ResponseCacheOptions{
+	Namespace:  ArticleListings,
+	Expiration: LISTING_CACHE_EXPIRATION,
+	Prepare:    PublishScheduledArticles,
+})
+
+// setLastModified sets Last-Modified header of the listing response.
+func setLastModified(w http.ResponseWriter, articles []*Article) {
+	var lastModified time.Time
+	for _, a := range articles {
+		if t := a.ModifiedOn(); t.After(lastModified) {
+			lastModified = t
+		}
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
 func isViewedArticle(viewedArticles []string, id string) bool {
 	for _, viewedId := range viewedArticles {
 		if viewedId == id {
@@ -31,30 +56,8 @@ func isViewedArticle(viewedArticles []string, id string) bool {
 	return false
 }
 
-func ImageUploadURLHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
-
-	imageUploadURL, err := Router.GetRoute("imageUpload").URL()
-	if err != nil {
-		core.HandleError(c, w, err)
-		return
-	}
-
-	uploadURL, err := blobstore.UploadURL(c, imageUploadURL.Path, nil)
-	if err != nil {
-		core.HandleError(c, w, err)
-		return
-	}
-
-	core.HandleJSON(c, w, map[string]string{"url": uploadURL.Path})
-}
-
-func ImageUploadHandler(w http.ResponseWriter, r *http.Request) {
-
-}
-
 func ArticleHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+	c := store.NewContext(r)
 	user := auth.CurrentUser(c)
 
 	vars := mux.Vars(r)
@@ -64,13 +67,18 @@ func ArticleHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	article, err := GetArticleById(c, id, !user.IsAdmin)
+	if err := PublishScheduledArticles(c); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	article, err := GetArticleById(c, id, !user.Can(auth.PERM_ARTICLE_UPDATE))
 	if err != nil {
 		core.HandleNotFound(c, w)
 		return
 	}
 
-	if !article.IsPublic && !user.IsAdmin {
+	if !article.IsVisibleTo(user) {
 		core.HandleAuthRequired(c, w)
 		return
 	}
@@ -96,12 +104,31 @@ func ArticleHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	context := tmplt.Context{"article": article}
+	renderArticle(c, w, article, NewCommentForm())
+}
+
+func renderArticle(c store.Context, w http.ResponseWriter, article *Article, form *CommentForm) {
+	if err := LoadAuthors(c, article); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	comments, err := GetArticleComments(c, article)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	context := tmplt.Context{
+		"article":     article,
+		"comments":    comments,
+		"commentForm": form,
+	}
 	core.RenderTemplate(c, w, context, "templates/blog/article.html", LAYOUT)
 }
 
 func ArticlePermaLinkHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+	c := store.NewContext(r)
 
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
@@ -116,12 +143,9 @@ func ArticlePermaLinkHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !article.IsPublic {
-		user := auth.CurrentUser(c)
-		if !user.IsAdmin {
-			core.HandleAuthRequired(c, w)
-			return
-		}
+	if !article.IsVisibleTo(auth.CurrentUser(c)) {
+		core.HandleAuthRequired(c, w)
+		return
 	}
 
 	redirectTo, err := article.URL()
@@ -132,22 +156,77 @@ func ArticlePermaLinkHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, redirectTo.Path, 302)
 }
 
+// pageURLFunc returns function that builds URLs of the paginated route.
+func pageURLFunc(routeName string, pairs ...string) func(int) string {
+	return func(page int) string {
+		url, err := Router.GetRoute(routeName).URL(
+			append(pairs, "page", strconv.Itoa(page))...)
+		if err != nil {
+			return ""
+		}
+		return url.String()
+	}
+}
+
+func pageNumber(r *http.Request) int {
+	page, err := strconv.ParseInt(mux.Vars(r)["page"], 10, 32)
+	if err != nil {
+		return 1
+	}
+	return int(page)
+}
+
+// listingQuery returns query of the articles visible to the user, latest
+// published first. Drafts have no publication time and go last.
+func listingQuery(user *auth.User) (*store.Query, string) {
+	q := NewArticleQuery().Order("-PublishAt")
+	if user.Can(auth.PERM_ARTICLE_UPDATE) {
+		return q, "all"
+	}
+	return q.Filter("IsPublic=", true), "public"
+}
+
 func ArticlePageHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+	c := store.NewContext(r)
 	user := auth.CurrentUser(c)
 
-	vars := mux.Vars(r)
-	page, err := strconv.ParseInt(vars["page"], 10, 32)
+	if err := PublishScheduledArticles(c); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	q, listing := listingQuery(user)
+	p := NewArticlePager(c, listing, q, pageNumber(r))
+	p.PageURL = pageURLFunc("articlePage")
+	articles, err := GetArticles(c, p)
 	if err != nil {
-		page = 1
+		core.HandleError(c, w, err)
+		return
+	}
+
+	context := tmplt.Context{
+		"articles": articles,
+		"pager":    p,
 	}
+	setLastModified(w, articles)
+	core.RenderTemplate(c, w, context,
+		"templates/blog/articleList.html", "templates/pager.html", LAYOUT)
+}
+
+func TagHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+	user := auth.CurrentUser(c)
+	tag := mux.Vars(r)["tag"]
 
-	q := NewArticleQuery().Order("-CreatedOn")
-	if !user.IsAdmin {
-		q = q.Filter("IsPublic=", true)
+	if err := PublishScheduledArticles(c); err != nil {
+		core.HandleError(c, w, err)
+		return
 	}
 
-	p := NewArticlePager(c, q, int(page))
+	q, listing := listingQuery(user)
+	q = q.Filter("Tags =", tag)
+	p := NewArticlePager(c, listing+"-tag-"+tag, q, pageNumber(r))
+	p.PageURL = pageURLFunc("tagPage", "tag", tag)
 	articles, err := GetArticles(c, p)
 	if err != nil {
 		core.HandleError(c, w, err)
@@ -157,58 +236,172 @@ func ArticlePageHandler(w http.ResponseWriter, r *http.Request) {
 	context := tmplt.Context{
 		"articles": articles,
 		"pager":    p,
+		"tag":      tag,
 	}
+	setLastModified(w, articles)
 	core.RenderTemplate(c, w, context,
 		"templates/blog/articleList.html", "templates/pager.html", LAYOUT)
 }
 
-func ArticleFeedHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
-	w.Header().Add("content-type", "application/xml")
+func AuthorHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+	user := auth.CurrentUser(c)
 
-	q := NewArticleQuery().Filter("IsPublic=", true).Order("-CreatedOn")
+	author, ok := getAuthor(c, mux.Vars(r)["id"])
+	if !ok {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	if err := PublishScheduledArticles(c); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
 
-	p := NewArticlePager(c, q, 1)
+	id := strconv.FormatInt(author.Key().IntID(), 10)
+	q, listing := listingQuery(user)
+	q = q.Filter("AuthorKey =", author.Key())
+	p := NewArticlePager(c, listing+"-author-"+id, q, pageNumber(r))
+	p.PageURL = pageURLFunc("authorPage", "id", id)
 	articles, err := GetArticles(c, p)
 	if err != nil {
 		core.HandleError(c, w, err)
 		return
 	}
 
-	var updatedOn time.Time
-	if len(articles) > 0 {
-		updatedOn = articles[0].CreatedOn
+	context := tmplt.Context{
+		"articles": articles,
+		"pager":    p,
+		"author":   author,
 	}
+	setLastModified(w, articles)
+	core.RenderTemplate(c, w, context,
+		"templates/blog/articleList.html", "templates/pager.html", LAYOUT)
+}
 
-	context := tmplt.Context{
-		"articles":  articles,
-		"updatedOn": updatedOn,
+// getAuthor returns user with the id from URL.
+func getAuthor(c store.Context, id string) (*auth.User, bool) {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	author, err := auth.GetUser(c, store.NewKey(auth.USER_KIND, "", intID, nil))
+	if err != nil {
+		if err != store.ErrNoSuchEntity {
+			c.Errorf("error getting author: %v", err)
+		}
+		return nil, false
 	}
+	return author, true
+}
+
+func renderArticleFeed(c store.Context, w http.ResponseWriter, listing string, q *store.Query, context tmplt.Context) {
+	if err := PublishScheduledArticles(c); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	p := NewArticlePager(c, listing, q, 1)
+	articles, err := GetArticles(c, p)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	var updatedOn time.Time
+	for _, article := range articles {
+		if t := article.ModifiedOn(); t.After(updatedOn) {
+			updatedOn = t
+		}
+	}
+
+	context["articles"] = articles
+	context["updatedOn"] = updatedOn
+	w.Header().Add("content-type", "application/xml")
+	setLastModified(w, articles)
 	core.RenderTemplate(c, w, context, "templates/blog/articleFeed.xml")
 }
 
+func ArticleFeedHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	q := NewArticleQuery().Filter("IsPublic=", true).Order("-PublishAt")
+	renderArticleFeed(c, w, "public", q, tmplt.Context{"feedPath": "/feed/"})
+}
+
+func TagFeedHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+	tag := mux.Vars(r)["tag"]
+
+	feedURL, err := Router.GetRoute("tagFeed").URL("tag", tag)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	q := NewArticleQuery().Filter("IsPublic=", true).Filter("Tags =", tag).Order("-PublishAt")
+	renderArticleFeed(c, w, "public-tag-"+tag, q, tmplt.Context{
+		"feedPath": feedURL.Path,
+		"tag":      tag,
+	})
+}
+
+func AuthorFeedHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	author, ok := getAuthor(c, mux.Vars(r)["id"])
+	if !ok {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	id := strconv.FormatInt(author.Key().IntID(), 10)
+	feedURL, err := Router.GetRoute("authorFeed").URL("id", id)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	q := NewArticleQuery().Filter("IsPublic=", true).Filter("AuthorKey =", author.Key()).Order("-PublishAt")
+	renderArticleFeed(c, w, "public-author-"+id, q, tmplt.Context{
+		"feedPath": feedURL.Path,
+		"author":   author,
+	})
+}
+
 func ArticleCreateHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+	c := store.NewContext(r)
 
-	user := core.AdminUser(c, w)
+	user := core.RequirePermission(c, w, auth.PERM_ARTICLE_CREATE, nil)
 	if user == nil {
 		return
 	}
 
 	form := NewArticleForm(nil)
+	var publishAtErr, tagsErr error
 
 	if r.Method == "POST" {
-		blobs, values, err := blobstore.ParseUpload(r)
+		isValid, err := isArticleFormValid(r, form)
 		if err != nil {
 			core.HandleError(c, w, err)
 			return
 		}
 
-		if gaeforms.IsBlobstoreFormValid(form, blobs, values) {
-			article, err := CreateArticle(c,
+		var publishAt time.Time
+		publishAt, publishAtErr = parsePublishAt(form.PublishAt.Value())
+		if publishAtErr == nil && form.IsPublic.Value() && !user.CanOwn(auth.PERM_ARTICLE_PUBLISH, user.Key()) {
+			publishAtErr = errPublishForbidden
+		}
+		var tags []string
+		tags, tagsErr = ParseTags(form.Tags.Value())
+		if isValid && publishAtErr == nil && tagsErr == nil {
+			article, err := CreateArticle(c, user,
 				form.Title.Value(),
 				form.Text.Value(),
+				tags,
 				form.IsPublic.Value(),
+				publishAt,
+				form.ShowTOC.Value(),
 			)
 			if err != nil {
 				core.HandleError(c, w, err)
@@ -221,23 +414,21 @@ func ArticleCreateHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			http.Redirect(w, r, redirectTo.Path, 302)
+			return
 		}
 	}
 
 	context := map[string]interface{}{
-		"form": form,
+		"form":           form,
+		"publishAtError": publishAtErr,
+		"tagsError":      tagsErr,
 	}
 	core.RenderTemplate(c, w, context,
 		"templates/blog/articleCreate.html", "templates/blog/articleForm.html", LAYOUT)
 }
 
 func ArticleUpdateHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
-
-	user := core.AdminUser(c, w)
-	if user == nil {
-		return
-	}
+	c := store.NewContext(r)
 
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
@@ -252,7 +443,13 @@ func ArticleUpdateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := core.RequirePermission(c, w, auth.PERM_ARTICLE_UPDATE, article.AuthorKey)
+	if user == nil {
+		return
+	}
+
 	form := NewArticleForm(article)
+	var publishAtErr, tagsErr error
 
 	if r.Method == "POST" {
 		if err := r.ParseForm(); err != nil {
@@ -260,11 +457,23 @@ func ArticleUpdateHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if gforms.IsFormValid(form, r.Form) {
-			err := UpdateArticle(c, article,
+		isValid := gforms.IsFormValid(form, r.Form)
+		var publishAt time.Time
+		publishAt, publishAtErr = parsePublishAt(form.PublishAt.Value())
+		if publishAtErr == nil && form.IsPublic.Value() && !(article.IsPublic || article.IsScheduled) &&
+			!user.CanOwn(auth.PERM_ARTICLE_PUBLISH, article.AuthorKey) {
+			publishAtErr = errPublishForbidden
+		}
+		var tags []string
+		tags, tagsErr = ParseTags(form.Tags.Value())
+		if isValid && publishAtErr == nil && tagsErr == nil {
+			err := UpdateArticle(c, article, user,
 				form.Title.Value(),
 				form.Text.Value(),
+				tags,
 				form.IsPublic.Value(),
+				publishAt,
+				form.ShowTOC.Value(),
 			)
 			if err != nil {
 				core.HandleError(c, w, err)
@@ -277,24 +486,22 @@ func ArticleUpdateHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			http.Redirect(w, r, redirectTo.Path, 302)
+			return
 		}
 	}
 
 	context := map[string]interface{}{
-		"article": article,
-		"form":    form,
+		"article":        article,
+		"form":           form,
+		"publishAtError": publishAtErr,
+		"tagsError":      tagsErr,
 	}
 	core.RenderTemplate(c, w, context,
 		"templates/blog/articleUpdate.html", "templates/blog/articleForm.html", LAYOUT)
 }
 
 func ArticleDeleteHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
-
-	user := core.AdminUser(c, w)
-	if user == nil {
-		return
-	}
+	c := store.NewContext(r)
 
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
@@ -309,6 +516,17 @@ func ArticleDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := core.RequirePermission(c, w, auth.PERM_ARTICLE_DELETE, article.AuthorKey)
+	if user == nil {
+		return
+	}
+
+	if r.Method != "POST" {
+		context := tmplt.Context{"article": article}
+		core.RenderTemplate(c, w, context, "templates/blog/articleDelete.html", LAYOUT)
+		return
+	}
+
 	err = DeleteArticle(c, article)
 	if err != nil {
 		core.HandleError(c, w, err)
@@ -319,13 +537,347 @@ func ArticleDeleteHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func MarkdownPreviewHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+	c := store.NewContext(r)
 
-	user := core.AdminUser(c, w)
+	user := core.RequirePermission(c, w, auth.PERM_ARTICLE_CREATE, nil)
 	if user == nil {
 		return
 	}
 
-	html := string(blackfriday.MarkdownCommon([]byte(r.FormValue("text"))))
+	html := string(ArticleRenderer.Render([]byte(r.FormValue("text"))).HTML)
 	core.HandleJSON(c, w, map[string]string{"html": html})
 }
+
+func CommentCreateHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	user := core.RequirePermission(c, w, auth.PERM_COMMENT_CREATE, nil)
+	if user == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	article, err := GetArticleById(c, id, !user.Can(auth.PERM_ARTICLE_UPDATE))
+	if err != nil {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	if !article.IsVisibleTo(user) {
+		core.HandleAuthRequired(c, w)
+		return
+	}
+
+	form := NewCommentForm()
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+		if gforms.IsFormValid(form, r.Form) {
+			comment, err := CreateComment(c, article, user, form.Text.Value())
+			if err != nil {
+				core.HandleError(c, w, err)
+				return
+			}
+
+			redirectTo, err := article.URL()
+			if err != nil {
+				core.HandleError(c, w, err)
+				return
+			}
+			redirectTo.Fragment = "comments"
+			if !comment.IsApproved() {
+				redirectTo.Fragment = "comment-form"
+			}
+			http.Redirect(w, r, redirectTo.String(), 302)
+			return
+		}
+	}
+
+	renderArticle(c, w, article, form)
+}
+
+// parseCommentKeys decodes keys of the selected comments.
+func parseCommentKeys(values []string) ([]*store.Key, error) {
+	keys := make([]*store.Key, 0, len(values))
+	for _, value := range values {
+		key, err := store.DecodeKey(value)
+		if err != nil {
+			return nil, err
+		}
+		if key.Kind() != COMMENT_KIND {
+			return nil, store.ErrInvalidEntityType
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func moderateComments(c store.Context, action string, keys []*store.Key) error {
+	switch action {
+	case "approve":
+		return SetCommentsStatus(c, keys, COMMENT_APPROVED)
+	case "reject":
+		return SetCommentsStatus(c, keys, COMMENT_SPAM)
+	case "delete":
+		return DeleteComments(c, keys)
+	}
+	return fmt.Errorf("unknown moderation action: %q", action)
+}
+
+func CommentModerationHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	user := core.RequirePermission(c, w, auth.PERM_COMMENT_MODERATE, nil)
+	if user == nil {
+		return
+	}
+
+	status := mux.Vars(r)["status"]
+	if status == "" {
+		status = COMMENT_PENDING
+	}
+	if !isCommentStatus(status) {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+
+		// Row buttons submit "action:key", bulk buttons submit the action
+		// and checked keys.
+		action, values := r.FormValue("action"), r.Form["keys"]
+		if parts := strings.SplitN(action, ":", 2); len(parts) == 2 {
+			action, values = parts[0], parts[1:]
+		}
+
+		keys, err := parseCommentKeys(values)
+		if err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+		if err := moderateComments(c, action, keys); err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+
+		http.Redirect(w, r, r.URL.Path, 302)
+		return
+	}
+
+	p := NewCommentPager(c, status, pageNumber(r))
+	p.PageURL = pageURLFunc("commentModerationPage", "status", status)
+	comments, err := GetComments(c, p)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	context := tmplt.Context{
+		"comments": comments,
+		"pager":    p,
+		"status":   status,
+		"statuses": commentStatuses,
+	}
+	core.RenderTemplate(c, w, context,
+		"templates/blog/commentModeration.html", "templates/pager.html", LAYOUT)
+}
+
+func ArticleHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	article, err := GetArticleById(c, id, false)
+	if err != nil {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	user := core.RequirePermission(c, w, auth.PERM_ARTICLE_UPDATE, article.AuthorKey)
+	if user == nil {
+		return
+	}
+
+	revisions, err := GetArticleRevisions(c, article)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	context := tmplt.Context{
+		"article":   article,
+		"revisions": revisions,
+	}
+	core.RenderTemplate(c, w, context, "templates/blog/articleHistory.html", LAYOUT)
+}
+
+func ArticleDiffHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	article, err := GetArticleById(c, id, false)
+	if err != nil {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	user := core.RequirePermission(c, w, auth.PERM_ARTICLE_UPDATE, article.AuthorKey)
+	if user == nil {
+		return
+	}
+
+	revisions := make([]*ArticleRevision, 2)
+	for i, name := range []string{"a", "b"} {
+		revisionId, err := strconv.ParseInt(r.FormValue(name), 10, 64)
+		if err != nil {
+			core.HandleNotFound(c, w)
+			return
+		}
+		revisions[i], err = GetArticleRevision(c, article, revisionId)
+		if err != nil {
+			core.HandleNotFound(c, w)
+			return
+		}
+	}
+	a, b := revisions[0], revisions[1]
+	if b.CreatedOn.Before(a.CreatedOn) {
+		a, b = b, a
+	}
+
+	lines := diff.Lines(a.Title+"\n\n"+a.Text(), b.Title+"\n\n"+b.Text())
+	context := tmplt.Context{
+		"article": article,
+		"a":       a,
+		"b":       b,
+		"split":   r.FormValue("mode") == "split",
+	}
+	if context["split"].(bool) {
+		context["rows"] = diff.SideBySide(lines)
+	} else {
+		context["hunks"] = diff.Unified(lines, 3)
+	}
+	core.RenderTemplate(c, w, context, "templates/blog/articleDiff.html", LAYOUT)
+}
+
+func ArticleRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	if r.Method != "POST" {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	revisionId, err := strconv.ParseInt(vars["revision"], 10, 64)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	article, err := GetArticleById(c, id, false)
+	if err != nil {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	user := core.RequirePermission(c, w, auth.PERM_ARTICLE_UPDATE, article.AuthorKey)
+	if user == nil {
+		return
+	}
+
+	revision, err := GetArticleRevision(c, article, revisionId)
+	if err != nil {
+		core.HandleNotFound(c, w)
+		return
+	}
+
+	if err := RestoreArticleRevision(c, article, revision, user); err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	redirectTo, err := article.HistoryURL()
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+	http.Redirect(w, r, redirectTo.Path, 302)
+}
+
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+	user := auth.CurrentUser(c)
+	query := strings.TrimSpace(r.FormValue("q"))
+
+	page, err := strconv.ParseInt(r.FormValue("page"), 10, 32)
+	if err != nil {
+		page = 1
+	}
+
+	p := pager.NewPager(c, "", nil, int(page), PAGE_SIZE)
+	p.PageURL = func(page int) string {
+		values := url.Values{"q": {query}, "page": {strconv.Itoa(page)}}
+		return "?" + values.Encode()
+	}
+	results, err := SearchArticles(c, query, user.Can(auth.PERM_ARTICLE_UPDATE), p)
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	context := tmplt.Context{
+		"query":   query,
+		"results": results,
+		"pager":   p,
+	}
+	core.RenderTemplate(c, w, context,
+		"templates/blog/search.html", "templates/pager.html", LAYOUT)
+}
+
+func SearchReindexHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	user := core.RequirePermission(c, w, auth.PERM_SEARCH_REINDEX, nil)
+	if user == nil {
+		return
+	}
+
+	context := tmplt.Context{}
+	if r.Method == "POST" {
+		n, err := ReindexArticles(c)
+		if err != nil {
+			core.HandleError(c, w, err)
+			return
+		}
+		context["indexed"] = n
+	}
+	core.RenderTemplate(c, w, context, "templates/blog/searchReindex.html", LAYOUT)
+}
@@ -0,0 +1,100 @@
+//go:build appengine
+// +build appengine
+
+package blog
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"time"
+
+	"appengine"
+	"appengine/blobstore"
+	gaeimage "appengine/image"
+
+	"auth"
+	"core/entity"
+	"core/store"
+	"core/store/gae"
+)
+
+const (
+	IMAGE_KIND     = "image"
+	MAX_IMAGE_SIZE = 5 << 20
+)
+
+var (
+	imageContentTypes = map[string]bool{
+		"image/gif":  true,
+		"image/jpeg": true,
+		"image/png":  true,
+	}
+
+	errNoImage = errors.New("No image was uploaded.")
+)
+
+type Image struct {
+	*entity.Entity `datastore:"-"`
+
+	BlobKey  appengine.BlobKey
+	Filename string
+	Width    int
+	Height   int
+
+	UploaderKey *store.Key
+	CreatedOn   time.Time
+}
+
+func NewImage() *Image {
+	return &Image{
+		Entity: entity.NewEntity(IMAGE_KIND),
+	}
+}
+
+func (i *Image) SetKey(key *store.Key) {
+	if i.Entity == nil {
+		i.Entity = entity.NewEntity(IMAGE_KIND)
+	}
+	i.Entity.SetKey(key)
+}
+
+func (i *Image) ServingURL(c store.Context) (*url.URL, error) {
+	return gaeimage.ServingURL(gae.AppengineContext(c), i.BlobKey, nil)
+}
+
+// decodeImageConfig validates uploaded blob and reads image dimensions.
+func decodeImageConfig(c store.Context, blobInfo *blobstore.BlobInfo) (image.Config, error) {
+	if !imageContentTypes[blobInfo.ContentType] {
+		return image.Config{}, fmt.Errorf("Unsupported image type %q.", blobInfo.ContentType)
+	}
+	if blobInfo.Size > MAX_IMAGE_SIZE {
+		return image.Config{}, fmt.Errorf(
+			"Image is too big (%d bytes, max is %d).", blobInfo.Size, MAX_IMAGE_SIZE)
+	}
+
+	config, _, err := image.DecodeConfig(blobstore.NewReader(gae.AppengineContext(c), blobInfo.BlobKey))
+	if err != nil {
+		return image.Config{}, fmt.Errorf("Can't decode image: %v.", err)
+	}
+	return config, nil
+}
+
+func CreateImage(c store.Context, blobInfo *blobstore.BlobInfo, config image.Config, uploader *auth.User) (*Image, error) {
+	i := NewImage()
+	i.BlobKey = blobInfo.BlobKey
+	i.Filename = blobInfo.Filename
+	i.Width = config.Width
+	i.Height = config.Height
+	i.UploaderKey = uploader.Key()
+	i.CreatedOn = time.Now()
+
+	if err := entity.Put(c, i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
@@ -2,46 +2,89 @@ package blog
 
 import (
 	"bytes"
-	"encoding/gob"
-	"fmt"
+	"encoding/json"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	"appengine"
-	"appengine/datastore"
-	"appengine/memcache"
-	"github.com/russross/blackfriday"
-
+	"auth"
+	"blog/render"
+	"core/cache"
 	"core/entity"
-	"core/page"
 	"core/pager"
+	"core/store"
 )
 
 const (
 	ARTICLE_KIND = "article"
+
+	// EXCERPT_WORDS is length of excerpts of articles without
+	// render.MORE_MARKER.
+	EXCERPT_WORDS = 100
+)
+
+var (
+	Articles = entity.NewRepository(ARTICLE_KIND, NewArticle, 24*time.Hour)
+
+	// ArticleRenderer renders article text on save and in preview.
+	ArticleRenderer render.Renderer = render.NewPipeline(render.Options{
+		Tables:         true,
+		Footnotes:      true,
+		TaskLists:      true,
+		Smartypants:    true,
+		Highlight:      true,
+		HeadingAnchors: true,
+		TOC:            true,
+		Policy:         render.ArticlePolicy,
+	})
+
+	// ArticleListings versions cached cursors, pages and feeds of article
+	// listings. It is bumped whenever an article or a tag is saved and when
+	// name or email of a user changes.
+	ArticleListings = cache.NewNamespace(ARTICLE_KIND + "-listings")
 )
 
-func articleCacheKey(id int64) string {
-	return fmt.Sprintf("blog-article-%v", id)
+func bumpArticleListings(c store.Context, key *store.Key) {
+	ArticleListings.Bump(c)
 }
 
-func NewArticlePager(c appengine.Context, q *datastore.Query, page int) *pager.Pager {
-	return pager.NewPager(c, ARTICLE_KIND, q, page, 10)
+// NewArticlePager returns pager for the article listing. Each listing
+// must have its own name, because cached cursors are only valid for
+// the query they were returned by.
+func NewArticlePager(c store.Context, listing string, q *store.Query, page int) *pager.Pager {
+	return pager.NewPager(c, ArticleListings.Key(c, listing), q, page, 10)
 }
 
 type Article struct {
 	*entity.Entity `datastore:"-"`
 
+	AuthorKey *store.Key
+
 	Title     string
 	TextBytes []byte
 	HTMLBytes []byte
+	// TOCBytes is JSON of the table of contents tree of HTMLBytes.
+	TOCBytes []byte
+	ShowTOC  bool
+	Tags     []string
+
+	// Excerpt is shown in listings and feeds instead of whole text.
+	ExcerptHTMLBytes []byte
+	ExcerptText      string `datastore:",noindex"`
+	HasMore          bool
 
 	ViewsCount int
 	IsPublic   bool
 	CreatedOn  time.Time
+	UpdatedOn  time.Time
+
+	// Scheduled articles are not public until PublishAt.
+	IsScheduled bool
+	PublishAt   time.Time
+
+	author *auth.User
 }
 
 func NewArticle() *Article {
@@ -50,65 +93,69 @@ func NewArticle() *Article {
 	}
 }
 
-func NewArticleQuery() *datastore.Query {
-	return datastore.NewQuery(ARTICLE_KIND)
+// IsVisibleTo reports whether the user may read the article.
+func (a *Article) IsVisibleTo(user *auth.User) bool {
+	return a.IsPublic || user.CanOwn(auth.PERM_ARTICLE_UPDATE, a.AuthorKey)
 }
 
-func GetArticleById(c appengine.Context, id int64, useCache bool) (*Article, error) {
-	article := NewArticle()
-	articleCacheKey := articleCacheKey(id)
+func NewArticleQuery() *store.Query {
+	return store.NewQuery(ARTICLE_KIND)
+}
 
+func GetArticleById(c store.Context, id int64, useCache bool) (*Article, error) {
+	key := Articles.NewKey(id, nil)
 	if useCache {
-		if item, err := memcache.Get(c, articleCacheKey); err == nil {
-			dec := gob.NewDecoder(bytes.NewBuffer(item.Value))
-			err = dec.Decode(article)
-			if err == nil {
-				return article, nil
-			} else {
-				c.Errorf("error decoding article: %v", err)
-			}
-		} else if err != memcache.ErrCacheMiss {
-			c.Errorf("error getting item: %v", err)
-		}
+		return Articles.Get(c, key)
 	}
+	return Articles.Load(c, key)
+}
 
-	key := datastore.NewKey(c, "article", "", id, nil)
-	if err := datastore.Get(c, key, article); err != nil {
+func GetArticles(c store.Context, p *pager.Pager) ([]*Article, error) {
+	articles, err := Articles.GetPager(c, p)
+	if err != nil {
 		return nil, err
 	}
-	article.SetKey(key)
-
-	buf := &bytes.Buffer{}
-	enc := gob.NewEncoder(buf)
-	if err := enc.Encode(article); err == nil {
-		item := &memcache.Item{
-			Key:        articleCacheKey,
-			Value:      buf.Bytes(),
-			Expiration: time.Duration(24) * time.Hour,
-		}
-		if err := memcache.Set(c, item); err != nil {
-			c.Errorf("error setting item: %v", err)
-		}
-	} else {
-		c.Errorf("error encoding article: %v", err)
+	if err := LoadAuthors(c, articles...); err != nil {
+		return nil, err
 	}
+	return articles, nil
+}
+
+// GetAuthorArticles returns latest public articles of the author.
+func GetAuthorArticles(c store.Context, author *auth.User, limit int) ([]*Article, error) {
+	q := NewArticleQuery().
+		Filter("IsPublic=", true).
+		Filter("AuthorKey =", author.Key()).
+		Order("-PublishAt").
+		Limit(limit)
 
-	return article, nil
+	return Articles.GetAll(c, q)
 }
 
-func GetArticles(c appengine.Context, p *pager.Pager) ([]*Article, error) {
-	q := p.Query()
+// LoadAuthors loads authors of the articles, so Author can be used.
+func LoadAuthors(c store.Context, articles ...*Article) error {
+	keys := make([]*store.Key, 0, len(articles))
+	withAuthor := make([]*Article, 0, len(articles))
+	for _, a := range articles {
+		if a.AuthorKey != nil {
+			keys = append(keys, a.AuthorKey)
+			withAuthor = append(withAuthor, a)
+		}
+	}
 
-	articles := make([]*Article, 0, p.PageSize)
-	page, err := page.GetPage(c, q, p.PageSize, false, &articles)
+	authors, err := auth.Users.GetMulti(c, keys)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	for i, key := range page.Keys {
-		articles[i].SetKey(key)
+	for i, a := range withAuthor {
+		a.author = authors[i]
 	}
-	p.Update(page.Start, page.More)
-	return articles, nil
+	return nil
+}
+
+// Author returns author loaded by LoadAuthors or nil.
+func (a *Article) Author() *auth.User {
+	return a.author
 }
 
 func (a *Article) Text() string {
@@ -119,7 +166,50 @@ func (a *Article) HTML() string {
 	return string(a.HTMLBytes)
 }
 
-func (a *Article) SetKey(key *datastore.Key) {
+// ExcerptHTML returns excerpt of the article or whole HTML of articles
+// rendered before excerpts were added.
+func (a *Article) ExcerptHTML() string {
+	if len(a.ExcerptHTMLBytes) == 0 {
+		return a.HTML()
+	}
+	return string(a.ExcerptHTMLBytes)
+}
+
+// TOC returns table of contents of the article.
+func (a *Article) TOC() []*render.TOCEntry {
+	var toc []*render.TOCEntry
+	if len(a.TOCBytes) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(a.TOCBytes, &toc); err != nil {
+		return nil
+	}
+	return toc
+}
+
+// FeedHTML returns HTML with inline styles of highlighted code, because
+// feed readers don't load stylesheets of the blog.
+func (a *Article) FeedHTML() string {
+	return string(render.InlineStyles(a.HTMLBytes))
+}
+
+// ModifiedOn returns time the article was last saved or published.
+func (a *Article) ModifiedOn() time.Time {
+	if a.UpdatedOn.After(a.PublishedOn()) {
+		return a.UpdatedOn
+	}
+	return a.PublishedOn()
+}
+
+// PublishedOn returns time the article became (or becomes) public.
+func (a *Article) PublishedOn() time.Time {
+	if a.PublishAt.IsZero() {
+		return a.CreatedOn
+	}
+	return a.PublishAt
+}
+
+func (a *Article) SetKey(key *store.Key) {
 	if a.Entity == nil {
 		a.Entity = entity.NewEntity(ARTICLE_KIND)
 	}
@@ -162,56 +252,165 @@ func (a *Article) DeleteURL() (*url.URL, error) {
 	)
 }
 
-func ChangeArticleViewsCount(c appengine.Context, key *datastore.Key, delta int) error {
+func (a *Article) HistoryURL() (*url.URL, error) {
+	return Router.GetRoute("articleHistory").URL(
+		"id",
+		strconv.FormatInt(a.Key().IntID(), 10),
+	)
+}
+
+func ChangeArticleViewsCount(c store.Context, key *store.Key, delta int) error {
 	article := NewArticle()
-	return datastore.RunInTransaction(c, func(c appengine.Context) error {
-		if err := datastore.Get(c, key, article); err != nil {
+	return store.RunInTransaction(c, func(c store.Context) error {
+		if err := store.Get(c, key, article); err != nil {
 			return err
 		}
 		article.ViewsCount += delta
-		if _, err := datastore.Put(c, key, article); err != nil {
+		if _, err := store.Put(c, key, article); err != nil {
 			return err
 		}
 		return nil
-	}, nil)
+	})
 }
 
-func CreateArticle(c appengine.Context, title string, text string, isPublic bool) (*Article, error) {
-	a := &Article{
-		Entity:    entity.NewEntity(ARTICLE_KIND),
-		CreatedOn: time.Now(),
+// publicTags returns tags counted in the tag cloud.
+func (a *Article) publicTags() []string {
+	if !a.IsPublic {
+		return nil
 	}
-	if err := UpdateArticle(c, a, title, text, isPublic); err != nil {
+	return a.Tags
+}
+
+func CreateArticle(c store.Context, user *auth.User, title string, text string, tags []string, isPublic bool, publishAt time.Time, showTOC bool) (*Article, error) {
+	a := NewArticle()
+	a.AuthorKey = user.Key()
+	a.CreatedOn = time.Now()
+	if err := UpdateArticle(c, a, user, title, text, tags, isPublic, publishAt, showTOC); err != nil {
 		return nil, err
 	}
 	return a, nil
 }
 
-func UpdateArticle(c appengine.Context, article *Article, title string, text string, isPublic bool) error {
-	textBytes := []byte(text)
+// UpdateArticle saves the article and its new revision made by the user.
+// Article without revisions gets one with its saved text first, so the
+// text is not lost. Public article with PublishAt in the future is
+// scheduled instead.
+func UpdateArticle(c store.Context, article *Article, user *auth.User, title string, text string, tags []string, isPublic bool, publishAt time.Time, showTOC bool) error {
+	oldTags := article.publicTags()
+	initial, err := initialArticleRevision(c, article)
+	if err != nil {
+		return err
+	}
 
 	article.Title = title
-	article.TextBytes = textBytes
-	article.HTMLBytes = blackfriday.MarkdownCommon(textBytes)
-	article.IsPublic = isPublic
+	article.TextBytes = []byte(text)
+	if err := renderArticleText(article); err != nil {
+		return err
+	}
+	article.ShowTOC = showTOC
+	article.Tags = tags
+	article.IsScheduled = isPublic && publishAt.After(time.Now())
+	article.IsPublic = isPublic && !article.IsScheduled
+	article.PublishAt = publishAt
+	article.UpdatedOn = time.Now()
+	if article.IsPublic && article.PublishAt.IsZero() {
+		article.PublishAt = article.UpdatedOn
+	}
 
-	if err := entity.Put(c, article); err != nil {
+	err = store.RunInTransaction(c, func(c store.Context) error {
+		if initial != nil {
+			if err := putArticleRevision(c, article, initial); err != nil {
+				return err
+			}
+		}
+		if err := Articles.Put(c, article); err != nil {
+			return err
+		}
+		return createArticleRevision(c, article, user)
+	})
+	if err != nil {
+		return err
+	}
+
+	if article.IsScheduled {
+		resetSchedule(c)
+	}
+
+	if err := indexArticle(c, article); err != nil {
 		return err
 	}
 
-	memcache.Delete(c, articleCacheKey(article.Key().IntID()))
+	return changeTagCounts(c, oldTags, article.publicTags())
+}
+
+// renderArticleText renders text of the article to HTML, excerpt and
+// table of contents.
+func renderArticleText(article *Article) error {
+	doc := ArticleRenderer.Render(article.TextBytes)
+	article.HTMLBytes = doc.HTML
 
+	excerpt := render.NewExcerpt(doc.HTML, EXCERPT_WORDS)
+	article.ExcerptHTMLBytes = excerpt.HTML
+	article.ExcerptText = excerpt.Text
+	article.HasMore = excerpt.IsTruncated
+
+	article.TOCBytes = nil
+	if len(doc.TOC) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(render.Tree(doc.TOC))
+	if err != nil {
+		return err
+	}
+	article.TOCBytes = b
 	return nil
 }
 
-func DeleteArticle(c appengine.Context, article *Article) error {
-	err := datastore.Delete(c, article.Key())
+// RerenderArticles renders text of all articles again, e.g. after
+// ArticleRenderer is changed, and returns number of changed articles.
+func RerenderArticles(c store.Context) (int, error) {
+	articles, err := Articles.GetAll(c, NewArticleQuery())
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, article := range articles {
+		html, toc, excerpt := article.HTMLBytes, article.TOCBytes, article.ExcerptHTMLBytes
+		if err := renderArticleText(article); err != nil {
+			return n, err
+		}
+		if bytes.Equal(html, article.HTMLBytes) && bytes.Equal(toc, article.TOCBytes) &&
+			bytes.Equal(excerpt, article.ExcerptHTMLBytes) {
+			continue
+		}
+		if err := Articles.Put(c, article); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func DeleteArticle(c store.Context, article *Article) error {
+	commentKeys, err := NewCommentQuery().Ancestor(article.Key()).KeysOnly().GetAll(c, nil)
 	if err != nil {
 		return err
 	}
-	err = memcache.Delete(c, articleCacheKey(article.Key().IntID()))
+	err = DeleteComments(c, commentKeys)
 	if err != nil {
 		return err
 	}
-	return nil
+	err = deleteArticleRevisions(c, article)
+	if err != nil {
+		return err
+	}
+	err = unindexArticle(c, article)
+	if err != nil {
+		return err
+	}
+	err = Articles.Delete(c, article.Key())
+	if err != nil {
+		return err
+	}
+	return changeTagCounts(c, article.publicTags(), nil)
 }
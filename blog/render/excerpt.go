@@ -0,0 +1,166 @@
+package render
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// MORE_MARKER separates excerpt from the rest of the text. Sanitize
+// keeps it in rendered HTML.
+const MORE_MARKER = "<!--more-->"
+
+var (
+	anchorRe = regexp.MustCompile(`<a class="header-anchor"[^>]*>[^<]*</a>`)
+	endTagRe = regexp.MustCompile(`</[^>]*>`)
+)
+
+// Excerpt is beginning of the text shown in listings.
+type Excerpt struct {
+	HTML []byte
+	Text string
+	// IsTruncated is true when there is more text than the excerpt.
+	IsTruncated bool
+}
+
+// NewExcerpt returns HTML before MORE_MARKER comment or, without the
+// marker, the first words of rendered HTML. Heading anchors are dropped,
+// because excerpts of several articles share the page.
+func NewExcerpt(b []byte, words int) *Excerpt {
+	b = anchorRe.ReplaceAll(b, nil)
+	if excerpt, rest, ok := cutMore(b); ok {
+		return &Excerpt{
+			HTML:        excerpt,
+			Text:        PlainText(excerpt),
+			IsTruncated: strings.TrimSpace(endTagRe.ReplaceAllString(rest, "")) != "",
+		}
+	}
+
+	b, isTruncated := Truncate(b, words)
+	return &Excerpt{
+		HTML:        b,
+		Text:        PlainText(b),
+		IsTruncated: isTruncated,
+	}
+}
+
+// cutMore cuts HTML at MORE_MARKER comment, closing tags left open, and
+// returns the rest. Markers in code are escaped text, so they don't cut.
+func cutMore(b []byte) ([]byte, string, bool) {
+	var open []string
+	s := string(b)
+	for i := 0; i < len(s); {
+		if s[i] != '<' {
+			i++
+			continue
+		}
+		t, n := parseTag(s[i:])
+		if n == 0 {
+			i++
+			continue
+		}
+		raw := s[i : i+n]
+		if raw == MORE_MARKER {
+			var out bytes.Buffer
+			out.WriteString(s[:i])
+			for k := len(open) - 1; k >= 0; k-- {
+				out.WriteString("</" + open[k] + ">")
+			}
+			return out.Bytes(), s[i+n:], true
+		}
+		open = openTags(open, t, raw)
+		i += n
+	}
+	return nil, "", false
+}
+
+// openTags returns tags left open after the tag.
+func openTags(open []string, t *tag, raw string) []string {
+	if t.name == "" || voidTags[t.name] || strings.HasSuffix(raw, "/>") {
+		return open
+	}
+	if !t.isEnd {
+		return append(open, t.name)
+	}
+	for j := len(open) - 1; j >= 0; j-- {
+		if open[j] == t.name {
+			return open[:j]
+		}
+	}
+	return open
+}
+
+// PlainText strips tags from HTML and collapses whitespace.
+func PlainText(b []byte) string {
+	s := html.UnescapeString(tagRe.ReplaceAllString(string(b), " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Truncate cuts HTML after the given number of words, closing tags left
+// open. It reports whether anything was cut.
+func Truncate(b []byte, words int) ([]byte, bool) {
+	var out bytes.Buffer
+	var open []string
+	s := string(b)
+	for len(s) > 0 {
+		if s[0] != '<' {
+			i := strings.IndexByte(s, '<')
+			if i == -1 {
+				i = len(s)
+			}
+			text, rest := s[:i], s[i:]
+			n, ok := cutWords(text, words)
+			if ok {
+				out.WriteString(strings.TrimRight(text[:n], " \t\n") + "&hellip;")
+				for k := len(open) - 1; k >= 0; k-- {
+					out.WriteString("</" + open[k] + ">")
+				}
+				return out.Bytes(), true
+			}
+			words -= n
+			out.WriteString(text)
+			s = rest
+			continue
+		}
+
+		t, n := parseTag(s)
+		if n == 0 {
+			out.WriteByte('<')
+			s = s[1:]
+			continue
+		}
+		raw := s[:n]
+		out.WriteString(raw)
+		s = s[n:]
+		open = openTags(open, t, raw)
+	}
+	return b, false
+}
+
+// cutWords returns length of the text prefix holding the given number
+// of words and true if there is more text after it. Otherwise it returns
+// number of words in the text and false.
+func cutWords(text string, words int) (int, bool) {
+	count := 0
+	inWord := false
+	for i := 0; i < len(text); i++ {
+		if isSpace(text[i]) {
+			if inWord && count == words {
+				if strings.TrimSpace(text[i:]) != "" {
+					return i, true
+				}
+			}
+			inWord = false
+			continue
+		}
+		if !inWord {
+			if count == words {
+				return i, true
+			}
+			count++
+			inWord = true
+		}
+	}
+	return count, false
+}
@@ -0,0 +1,98 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestCutWords(t *testing.T) {
+	tests := []struct {
+		text  string
+		words int
+		n     int
+		more  bool
+	}{
+		{"one two three", 2, 7, true},
+		{"one two three", 3, 3, false},
+		{"one two ", 2, 2, false},
+		{"  one  two", 1, 5, true},
+		{"one", 0, 0, true},
+		{"", 2, 0, false},
+	}
+	for _, test := range tests {
+		n, more := cutWords(test.text, test.words)
+		if n != test.n || more != test.more {
+			t.Errorf("cutWords(%q, %d) = %d, %v, want %d, %v", test.text, test.words, n, more, test.n, test.more)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in    string
+		words int
+		want  string
+		isCut bool
+	}{
+		{`<p>one two</p>`, 2, `<p>one two</p>`, false},
+		{`<p>one two three</p>`, 2, `<p>one two&hellip;</p>`, true},
+		{`<p>one <em>two three</em> four</p>`, 2, `<p>one <em>two&hellip;</em></p>`, true},
+		{`<p>one</p><p>two</p><p>three</p>`, 2, `<p>one</p><p>two</p><p>&hellip;</p>`, true},
+		{`<ul><li>a <a href="/x">b c</a></li></ul>`, 2, `<ul><li>a <a href="/x">b&hellip;</a></li></ul>`, true},
+		{`<p>one<br />two<img src="x" /> three</p>`, 2, `<p>one<br />two<img src="x" />&hellip;</p>`, true},
+		{`<p>one <!-- c --> two three</p>`, 2, `<p>one <!-- c --> two&hellip;</p>`, true},
+		{`<p>1 < 2 3</p>`, 2, `<p>1 < 2&hellip;</p>`, true},
+	}
+	for _, test := range tests {
+		got, isCut := Truncate([]byte(test.in), test.words)
+		if string(got) != test.want || isCut != test.isCut {
+			t.Errorf("Truncate(%q, %d) = %q, %v, want %q, %v", test.in, test.words, got, isCut, test.want, test.isCut)
+		}
+	}
+}
+
+func TestCutMore(t *testing.T) {
+	tests := []struct {
+		in      string
+		excerpt string
+		rest    string
+		ok      bool
+	}{
+		{`<p>a</p><!--more--><p>b</p>`, `<p>a</p>`, `<p>b</p>`, true},
+		{`<div><p>a <em>b<!--more-->c</em></p></div>`, `<div><p>a <em>b</em></p></div>`, `c</em></p></div>`, true},
+		{`<p>a<br />b</p><!--more-->`, `<p>a<br />b</p>`, ``, true},
+		{`<pre><code>&lt;!--more--&gt;</code></pre>`, ``, ``, false},
+		{`<p>a</p><!-- more -->`, ``, ``, false},
+	}
+	for _, test := range tests {
+		excerpt, rest, ok := cutMore([]byte(test.in))
+		if string(excerpt) != test.excerpt || rest != test.rest || ok != test.ok {
+			t.Errorf("cutMore(%q) = %q, %q, %v, want %q, %q, %v",
+				test.in, excerpt, rest, ok, test.excerpt, test.rest, test.ok)
+		}
+	}
+}
+
+func TestNewExcerpt(t *testing.T) {
+	tests := []struct {
+		in          string
+		html        string
+		text        string
+		isTruncated bool
+	}{
+		{
+			`<h1 id="t">T <a class="header-anchor" href="#t">&para;</a></h1><p>a &amp; b</p><!--more--><p>c</p>`,
+			`<h1 id="t">T </h1><p>a &amp; b</p>`, "T a & b", true,
+		},
+		{`<p>a</p><!--more-->` + "\n</div>", `<p>a</p>`, "a", false},
+		{`<p>a</p><!--more--><img src="x" />`, `<p>a</p>`, "a", true},
+		{`<p>one two three four</p>`, `<p>one two&hellip;</p>`, "one two…", true},
+		{`<p>one two</p>`, `<p>one two</p>`, "one two", false},
+	}
+	for _, test := range tests {
+		e := NewExcerpt([]byte(test.in), 2)
+		if string(e.HTML) != test.html || e.Text != test.text || e.IsTruncated != test.isTruncated {
+			t.Errorf("NewExcerpt(%q) = %q, %q, %v, want %q, %q, %v",
+				test.in, e.HTML, e.Text, e.IsTruncated, test.html, test.text, test.isTruncated)
+		}
+	}
+}
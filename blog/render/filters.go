@@ -0,0 +1,124 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	taskRe    = regexp.MustCompile(`<li>(<p>)?\[([ xX])\]\s`)
+	headingRe = regexp.MustCompile(`(?s)<h([1-6])(\s[^>]*)?>(.*?)</h[1-6]>`)
+	tagRe     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// TaskLists turns list items starting with "[ ]" or "[x]" into
+// disabled checkboxes.
+func TaskLists(doc *Document) {
+	doc.HTML = taskRe.ReplaceAllFunc(doc.HTML, func(m []byte) []byte {
+		sub := taskRe.FindSubmatch(m)
+		input := `<input type="checkbox" disabled="disabled" /> `
+		if sub[2][0] != ' ' {
+			input = `<input type="checkbox" checked="checked" disabled="disabled" /> `
+		}
+		return []byte(`<li class="task-list-item">` + string(sub[1]) + input)
+	})
+}
+
+// Slug returns heading id made of lowercased letters and digits
+// of the text separated by dashes.
+func Slug(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// Headings gives every heading unique id, optionally adding anchor link
+// to it and collecting table of contents. Ids set with {#id} are kept,
+// generated ids get numeric suffix when they are taken.
+type Headings struct {
+	Anchors bool
+	TOC     bool
+}
+
+// headingAttrs returns id and other attributes of the heading match.
+// Attribute values are unescaped.
+func headingAttrs(sub [][]byte) (string, [][2]string) {
+	t, _ := parseTag("<h" + string(sub[1]) + string(sub[2]) + ">")
+	id := ""
+	var attrs [][2]string
+	for _, attr := range t.attrs {
+		if attr[0] == "id" {
+			id = attr[1]
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	return id, attrs
+}
+
+// uniqueID returns id or id with the smallest suffix that is not taken.
+func uniqueID(id string, taken func(string) bool) string {
+	if !taken(id) {
+		return id
+	}
+	for n := 1; ; n++ {
+		if s := id + "-" + strconv.Itoa(n); !taken(s) {
+			return s
+		}
+	}
+}
+
+func (h *Headings) Filter(doc *Document) {
+	// explicit ids are reserved, so generated ids don't take them
+	explicit := make(map[string]bool)
+	for _, sub := range headingRe.FindAllSubmatch(doc.HTML, -1) {
+		if id, _ := headingAttrs(sub); id != "" {
+			explicit[id] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	doc.HTML = headingRe.ReplaceAllFunc(doc.HTML, func(m []byte) []byte {
+		sub := headingRe.FindSubmatch(m)
+		level, _ := strconv.Atoi(string(sub[1]))
+		content := string(sub[3])
+		text := strings.TrimSpace(html.UnescapeString(tagRe.ReplaceAllString(content, "")))
+
+		id, attrs := headingAttrs(sub)
+		own := id
+		if id == "" {
+			id = Slug(text)
+		}
+		id = uniqueID(id, func(s string) bool { return seen[s] || explicit[s] && s != own })
+		seen[id] = true
+
+		if h.TOC {
+			doc.TOC = append(doc.TOC, Heading{Level: level, ID: id, Text: text})
+		}
+		if h.Anchors {
+			content += ` <a class="header-anchor" href="#` + html.EscapeString(id) + `">&para;</a>`
+		}
+		b := "<h" + string(sub[1]) + ` id="` + html.EscapeString(id) + `"`
+		for _, attr := range attrs {
+			b += " " + attr[0] + `="` + html.EscapeString(attr[1]) + `"`
+		}
+		return []byte(b + ">" + content + "</h" + string(sub[1]) + ">")
+	})
+}
@@ -0,0 +1,105 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSlug(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Go 1.2  ", "go-1-2"},
+		{"Привет мир", "привет-мир"},
+		{"C++ & C#", "c-c"},
+		{"---", "section"},
+		{"", "section"},
+	}
+	for _, test := range tests {
+		if got := Slug(test.text); got != test.want {
+			t.Errorf("Slug(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestHeadings(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ids  []string
+	}{
+		{
+			`<h2>A</h2><h2>A</h2><h2>A</h2>`,
+			`<h2 id="a">A</h2><h2 id="a-1">A</h2><h2 id="a-2">A</h2>`,
+			[]string{"a", "a-1", "a-2"},
+		},
+		{
+			// explicit id is kept, generated ids skip it
+			`<h2>A</h2><h2>A</h2><h2 id="a-1">B</h2>`,
+			`<h2 id="a">A</h2><h2 id="a-2">A</h2><h2 id="a-1">B</h2>`,
+			[]string{"a", "a-2", "a-1"},
+		},
+		{
+			`<h2 id="a-1">B</h2><h2>A</h2><h2>A</h2>`,
+			`<h2 id="a-1">B</h2><h2 id="a">A</h2><h2 id="a-2">A</h2>`,
+			[]string{"a-1", "a", "a-2"},
+		},
+		{
+			`<h2 id="x">A</h2><h3 id="x">B</h3>`,
+			`<h2 id="x">A</h2><h3 id="x-1">B</h3>`,
+			[]string{"x", "x-1"},
+		},
+		{
+			`<h1 class="title" id="a&amp;b">A <em>&amp;</em> B</h1>`,
+			`<h1 id="a&amp;b" class="title">A <em>&amp;</em> B</h1>`,
+			[]string{"a&b"},
+		},
+		{`<hr /><header>x</header>`, `<hr /><header>x</header>`, nil},
+	}
+	for _, test := range tests {
+		doc := &Document{HTML: []byte(test.in)}
+		(&Headings{TOC: true}).Filter(doc)
+		if got := string(doc.HTML); got != test.want {
+			t.Errorf("Headings(%q) = %q, want %q", test.in, got, test.want)
+		}
+		var ids []string
+		for _, h := range doc.TOC {
+			ids = append(ids, h.ID)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("Headings(%q) TOC ids = %q, want %q", test.in, ids, test.ids)
+		}
+	}
+
+	doc := &Document{HTML: []byte(`<h2>A &amp; B</h2>`)}
+	(&Headings{Anchors: true}).Filter(doc)
+	want := `<h2 id="a-b">A &amp; B <a class="header-anchor" href="#a-b">&para;</a></h2>`
+	if got := string(doc.HTML); got != want {
+		t.Errorf("Headings with anchors = %q, want %q", got, want)
+	}
+	if doc.TOC != nil {
+		t.Errorf("TOC is collected without TOC option")
+	}
+}
+
+func TestTaskLists(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`<li>[ ] todo</li>`, `<li class="task-list-item"><input type="checkbox" disabled="disabled" /> todo</li>`},
+		{`<li>[x] done</li>`, `<li class="task-list-item"><input type="checkbox" checked="checked" disabled="disabled" /> done</li>`},
+		{`<li>[X] done</li>`, `<li class="task-list-item"><input type="checkbox" checked="checked" disabled="disabled" /> done</li>`},
+		{`<li><p>[ ] loose</p></li>`, `<li class="task-list-item"><p><input type="checkbox" disabled="disabled" /> loose</p></li>`},
+		{`<li>[] no</li><li>[y] no</li><li>plain [ ] </li>`, `<li>[] no</li><li>[y] no</li><li>plain [ ] </li>`},
+	}
+	for _, test := range tests {
+		doc := &Document{HTML: []byte(test.in)}
+		TaskLists(doc)
+		if got := string(doc.HTML); got != test.want {
+			t.Errorf("TaskLists(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	codeRe        = regexp.MustCompile(`(?s)<pre><code class="(?:language-)?([^"]+)">(.*?)</code></pre>`)
+	highlightedRe = regexp.MustCompile(`(?s)<pre><code class="no-highlight ([^"]+)">(.*?)</code></pre>`)
+	spanRe        = regexp.MustCompile(`<span class="([a-z_]+)">`)
+	identRe       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+	numberRe      = regexp.MustCompile(`^(?:0[xX][0-9a-fA-F_]+|[0-9][0-9_]*(?:\.[0-9_]+)?(?:[eE][+-]?[0-9]+)?)`)
+	variableRe    = regexp.MustCompile(`^\$(?:\{[^}\n]*\}|[A-Za-z0-9_@#?*!$-])[A-Za-z0-9_]*`)
+	annotationRe  = regexp.MustCompile(`^@[A-Za-z_][A-Za-z0-9_.]*`)
+)
+
+// Highlight colors fenced code blocks of known languages with spans
+// using highlight.js classes. Highlighted blocks are marked with
+// no-highlight class, so highlight.js leaves them alone and only
+// handles blocks without language.
+func Highlight(doc *Document) {
+	doc.HTML = codeRe.ReplaceAllFunc(doc.HTML, func(m []byte) []byte {
+		sub := codeRe.FindSubmatch(m)
+		name, lang := lookupLanguage(string(sub[1]))
+		if lang == nil {
+			return m
+		}
+		code := lang.highlight(html.UnescapeString(string(sub[2])))
+		return []byte(`<pre><code class="no-highlight ` + name + `">` + code + "</code></pre>")
+	})
+}
+
+func (l *language) highlight(code string) string {
+	var b strings.Builder
+	lineStart := true
+	for len(code) > 0 {
+		n, class := l.token(code, lineStart)
+		text := html.EscapeString(code[:n])
+		if class == "" {
+			b.WriteString(text)
+		} else {
+			b.WriteString(`<span class="` + class + `">` + text + "</span>")
+		}
+		for _, c := range code[:n] {
+			if c == '\n' {
+				lineStart = true
+			} else if c != ' ' && c != '\t' {
+				lineStart = false
+			}
+		}
+		code = code[n:]
+	}
+	return b.String()
+}
+
+// token returns length and class of the token code starts with. Text
+// outside of tokens is returned one byte at a time with empty class.
+func (l *language) token(code string, lineStart bool) (int, string) {
+	if l.preprocessor && lineStart && code[0] == '#' {
+		return lineEnd(code), "preprocessor"
+	}
+	if start := l.blockComment[0]; start != "" && strings.HasPrefix(code, start) {
+		end := strings.Index(code[len(start):], l.blockComment[1])
+		if end == -1 {
+			return len(code), "comment"
+		}
+		return len(start) + end + len(l.blockComment[1]), "comment"
+	}
+	for _, prefix := range l.lineComments {
+		if strings.HasPrefix(code, prefix) {
+			return lineEnd(code), "comment"
+		}
+	}
+
+	q := code[0]
+	if l.tripleQuotes && len(code) >= 3 && (q == '"' || q == '\'') && code[1] == q && code[2] == q {
+		end := strings.Index(code[3:], code[:3])
+		if end == -1 {
+			return len(code), "string"
+		}
+		return 3 + end + 3, "string"
+	}
+	if strings.IndexByte(l.quotes, q) != -1 {
+		return scanString(code, true, l.multilineStrings), "string"
+	}
+	if strings.IndexByte(l.rawQuotes, q) != -1 {
+		return scanString(code, false, true), "string"
+	}
+
+	if l.variables {
+		if m := variableRe.FindString(code); m != "" {
+			return len(m), "variable"
+		}
+	}
+	if l.annotations != "" {
+		if m := annotationRe.FindString(code); m != "" {
+			return len(m), l.annotations
+		}
+	}
+	if m := numberRe.FindString(code); m != "" {
+		return len(m), "number"
+	}
+	if m := identRe.FindString(code); m != "" {
+		word := m
+		if l.ignoreCase {
+			word = strings.ToLower(word)
+		}
+		return len(m), l.words[word]
+	}
+	return 1, ""
+}
+
+func lineEnd(code string) int {
+	if i := strings.IndexByte(code, '\n'); i != -1 {
+		return i
+	}
+	return len(code)
+}
+
+// scanString returns length of the string literal code starts with.
+// Unterminated strings end with the line or the code.
+func scanString(code string, escapes, multiline bool) int {
+	for i := 1; i < len(code); i++ {
+		switch {
+		case code[i] == '\\' && escapes:
+			i++
+		case code[i] == code[0]:
+			return i + 1
+		case code[i] == '\n' && !multiline:
+			return i
+		}
+	}
+	return len(code)
+}
+
+// Styles of the default highlight.js theme. Keys prefixed with language
+// override styles of that language only.
+var inlineStyles = map[string]string{
+	"code":          "display: block; padding: 0.5em; background: #f0f0f0; color: black",
+	"string":        "color: #800",
+	"constant":      "color: #800",
+	"preprocessor":  "color: #800",
+	"comment":       "color: #888",
+	"annotation":    "color: #888",
+	"number":        "color: #080",
+	"literal":       "color: #080",
+	"decorator":     "color: #88f",
+	"keyword":       "font-weight: bold",
+	"built_in":      "font-weight: bold",
+	"aggregate":     "font-weight: bold",
+	"go constant":   "color: #080",
+	"go typename":   "font-weight: bold",
+	"bash variable": "color: #800; font-weight: bold",
+}
+
+func inlineStyle(lang, class string) string {
+	if style, ok := inlineStyles[lang+" "+class]; ok {
+		return style
+	}
+	return inlineStyles[class]
+}
+
+// InlineStyles replaces classes of highlighted code with inline styles,
+// so it is colored where stylesheets are not available, e.g. in feed
+// readers.
+func InlineStyles(b []byte) []byte {
+	return highlightedRe.ReplaceAllFunc(b, func(m []byte) []byte {
+		sub := highlightedRe.FindSubmatch(m)
+		lang := string(sub[1])
+		code := spanRe.ReplaceAllFunc(sub[2], func(span []byte) []byte {
+			class := string(spanRe.FindSubmatch(span)[1])
+			return []byte(`<span style="` + inlineStyle(lang, class) + `">`)
+		})
+		return []byte(`<pre><code style="` + inlineStyle(lang, "code") + `">` + string(code) + "</code></pre>")
+	})
+}
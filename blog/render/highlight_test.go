@@ -0,0 +1,88 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			`<pre><code class="language-go">func f() { return nil } // done` + "\n" + `</code></pre>`,
+			`<pre><code class="no-highlight go"><span class="keyword">func</span> f() { <span class="keyword">return</span> ` +
+				`<span class="constant">nil</span> } <span class="comment">// done</span>` + "\n" + `</code></pre>`,
+		},
+		{
+			`<pre><code class="golang">s := "a\"b" + ` + "`raw`" + `</code></pre>`,
+			`<pre><code class="no-highlight go">s := <span class="string">&#34;a\&#34;b&#34;</span> + ` +
+				"<span class=\"string\">`raw`</span></code></pre>",
+		},
+		{
+			`<pre><code class="language-python">@dec` + "\n" + `def f(): return &quot;&quot;&quot;x&quot;&quot;&quot;</code></pre>`,
+			`<pre><code class="no-highlight python"><span class="decorator">@dec</span>` + "\n" +
+				`<span class="keyword">def</span> f(): <span class="keyword">return</span> ` +
+				`<span class="string">&#34;&#34;&#34;x&#34;&#34;&#34;</span></code></pre>`,
+		},
+		{
+			`<pre><code class="language-sh">echo $HOME 'a'</code></pre>`,
+			`<pre><code class="no-highlight bash"><span class="keyword">echo</span> <span class="variable">$HOME</span> ` +
+				`<span class="string">&#39;a&#39;</span></code></pre>`,
+		},
+		{
+			`<pre><code class="language-sql">select COUNT(*) from t -- c</code></pre>`,
+			`<pre><code class="no-highlight sql"><span class="keyword">select</span> <span class="aggregate">COUNT</span>(*) ` +
+				`<span class="keyword">from</span> t <span class="comment">-- c</span></code></pre>`,
+		},
+		{
+			`<pre><code class="language-cpp">#include &lt;x&gt;` + "\n" + `int a = 0x1F;</code></pre>`,
+			`<pre><code class="no-highlight cpp"><span class="preprocessor">#include &lt;x&gt;</span>` + "\n" +
+				`<span class="keyword">int</span> a = <span class="number">0x1F</span>;</code></pre>`,
+		},
+		{
+			`<pre><code class="language-js">/* unterminated</code></pre>`,
+			`<pre><code class="no-highlight javascript"><span class="comment">/* unterminated</span></code></pre>`,
+		},
+		{
+			`<pre><code class="language-unknown">foo</code></pre>`,
+			`<pre><code class="language-unknown">foo</code></pre>`,
+		},
+		{`<pre><code>plain</code></pre>`, `<pre><code>plain</code></pre>`},
+	}
+	for _, test := range tests {
+		doc := &Document{HTML: []byte(test.in)}
+		Highlight(doc)
+		if got := string(doc.HTML); got != test.want {
+			t.Errorf("Highlight(%q) =\n%q\nwant\n%q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestInlineStyles(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			`<pre><code class="no-highlight go"><span class="keyword">func</span> <span class="constant">nil</span></code></pre>`,
+			`<pre><code style="display: block; padding: 0.5em; background: #f0f0f0; color: black">` +
+				`<span style="font-weight: bold">func</span> <span style="color: #080">nil</span></code></pre>`,
+		},
+		{
+			// language specific style
+			`<pre><code class="no-highlight bash"><span class="variable">$A</span></code></pre>`,
+			`<pre><code style="display: block; padding: 0.5em; background: #f0f0f0; color: black">` +
+				`<span style="color: #800; font-weight: bold">$A</span></code></pre>`,
+		},
+		{
+			`<p class="keyword">x</p><pre><code class="language-unknown">foo</code></pre>`,
+			`<p class="keyword">x</p><pre><code class="language-unknown">foo</code></pre>`,
+		},
+	}
+	for _, test := range tests {
+		if got := string(InlineStyles([]byte(test.in))); got != test.want {
+			t.Errorf("InlineStyles(%q) =\n%q\nwant\n%q", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package render
+
+import (
+	"strings"
+)
+
+// language describes lexical syntax of the language well enough to
+// color keywords, strings, comments and numbers.
+type language struct {
+	// words maps keywords and other reserved words to their classes.
+	words      map[string]string
+	ignoreCase bool
+
+	lineComments []string
+	blockComment [2]string
+
+	// quotes start strings with escapes, rawQuotes start strings
+	// without escapes that may span lines.
+	quotes           string
+	rawQuotes        string
+	tripleQuotes     bool
+	multilineStrings bool
+
+	// preprocessor colors lines starting with #.
+	preprocessor bool
+	// variables colors $name and ${name}.
+	variables bool
+	// annotations is class of @name, empty if there are none.
+	annotations string
+}
+
+func classWords(classes map[string]string) map[string]string {
+	words := make(map[string]string)
+	for class, list := range classes {
+		for _, word := range strings.Fields(list) {
+			words[word] = class
+		}
+	}
+	return words
+}
+
+// Languages are named like in highlight.js, so its styles apply.
+var languages = map[string]*language{
+	"go": {
+		words: classWords(map[string]string{
+			"keyword": "break case chan const continue default defer else fallthrough for func go goto " +
+				"if import interface map package range return select struct switch type var",
+			"constant": "true false iota nil",
+			"typename": "bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64 " +
+				"rune string uint uint8 uint16 uint32 uint64 uintptr",
+			"built_in": "append cap close complex copy delete imag len make new panic print println real recover",
+		}),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		rawQuotes:    "`",
+	},
+	"python": {
+		words: classWords(map[string]string{
+			"keyword": "and as assert break class continue def del elif else except exec finally for from " +
+				"global if import in is lambda nonlocal not or pass print raise return try while with yield",
+			"built_in": "None True False Ellipsis NotImplemented",
+		}),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		tripleQuotes: true,
+		annotations:  "decorator",
+	},
+	"javascript": {
+		words: classWords(map[string]string{
+			"keyword": "break case catch continue default delete do else finally for function if in " +
+				"instanceof new return switch this throw try typeof var void while with",
+			"literal": "true false null",
+		}),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+	},
+	"java": {
+		words: classWords(map[string]string{
+			"keyword": "abstract assert boolean break byte case catch char class const continue default do " +
+				"double else enum extends false final finally float for if implements import instanceof int " +
+				"interface long native new null package private protected public return short static " +
+				"strictfp super switch synchronized this throw throws transient true try void volatile while",
+		}),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		annotations:  "annotation",
+	},
+	"cpp": {
+		words: classWords(map[string]string{
+			"keyword": "false int float while private char catch export virtual operator sizeof dynamic_cast " +
+				"typedef const_cast const struct for static_cast union namespace unsigned long throw " +
+				"volatile static protected bool template mutable if public friend do return goto auto " +
+				"void enum else break new extern using true class asm case typeid short reinterpret_cast " +
+				"default double register explicit signed typename try this switch continue wchar_t inline " +
+				"delete alignof char16_t char32_t constexpr decltype noexcept nullptr static_assert " +
+				"thread_local restrict",
+			"built_in": "std string cin cout cerr clog stringstream istringstream ostringstream auto_ptr " +
+				"deque list queue stack vector map set bitset multiset multimap unordered_set " +
+				"unordered_map unordered_multiset unordered_multimap array shared_ptr",
+		}),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		preprocessor: true,
+	},
+	"bash": {
+		words: classWords(map[string]string{
+			"keyword": "if then else elif fi for break continue while in do done echo exit return set declare",
+			"literal": "true false",
+		}),
+		lineComments:     []string{"#"},
+		quotes:           `"`,
+		rawQuotes:        "'",
+		multilineStrings: true,
+		variables:        true,
+	},
+	"ruby": {
+		words: classWords(map[string]string{
+			"keyword": "and false then defined module in return redo if BEGIN retry end for true self when " +
+				"next until do begin unless END rescue nil else break undef not super class case require " +
+				"yield alias while ensure elsif or def",
+		}),
+		lineComments:     []string{"#"},
+		quotes:           `"'`,
+		multilineStrings: true,
+	},
+	"sql": {
+		words: classWords(map[string]string{
+			"keyword": "all alter and as asc between by case check column commit create cross database " +
+				"default delete desc distinct drop else end exists foreign from full group having if in " +
+				"index inner insert into is join key left like limit not null on or order outer primary " +
+				"references right rollback select set table then transaction union unique update values " +
+				"view when where with",
+			"aggregate": "count sum min max avg",
+		}),
+		ignoreCase:   true,
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `'"`,
+	},
+}
+
+var languageAliases = map[string]string{
+	"golang": "go",
+	"py":     "python",
+	"js":     "javascript",
+	"c":      "cpp",
+	"c++":    "cpp",
+	"cc":     "cpp",
+	"h":      "cpp",
+	"sh":     "bash",
+	"shell":  "bash",
+	"rb":     "ruby",
+}
+
+// lookupLanguage returns highlight.js name and syntax of the language
+// named by fenced code block.
+func lookupLanguage(name string) (string, *language) {
+	name = strings.ToLower(name)
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	return name, languages[name]
+}
@@ -0,0 +1,155 @@
+// Package render converts markdown to HTML. Article text, its preview
+// and comments all go through pipelines of this package, so they are
+// rendered the same way everywhere.
+package render
+
+import (
+	"github.com/russross/blackfriday"
+)
+
+// Heading is entry of the table of contents.
+type Heading struct {
+	Level int
+	ID    string
+	Text  string
+}
+
+// TOCEntry is heading together with headings nested in its section.
+type TOCEntry struct {
+	Heading
+	Children []*TOCEntry `json:",omitempty"`
+}
+
+// Tree nests headings by their levels. Heading that is not deeper than
+// the previous one closes its section.
+func Tree(headings []Heading) []*TOCEntry {
+	var toc []*TOCEntry
+	var stack []*TOCEntry
+	for _, h := range headings {
+		entry := &TOCEntry{Heading: h}
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc = append(toc, entry)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, entry)
+		}
+		stack = append(stack, entry)
+	}
+	return toc
+}
+
+// Document is result of rendering.
+type Document struct {
+	HTML []byte
+	// TOC lists headings in document order. It is only filled
+	// when the pipeline extracts table of contents.
+	TOC []Heading
+}
+
+type Renderer interface {
+	Render(text []byte) *Document
+}
+
+// Filter post-processes rendered document.
+type Filter interface {
+	Filter(doc *Document)
+}
+
+type FilterFunc func(doc *Document)
+
+func (f FilterFunc) Filter(doc *Document) {
+	f(doc)
+}
+
+type Options struct {
+	Tables      bool
+	Footnotes   bool
+	TaskLists   bool
+	Smartypants bool
+	// Highlight colors fenced code blocks with language.
+	Highlight bool
+	// HeadingAnchors gives headings ids and adds links to them.
+	HeadingAnchors bool
+	// TOC extracts table of contents into Document.TOC. Headings
+	// get ids even without HeadingAnchors.
+	TOC bool
+	// Safe skips raw HTML and unsafe links of untrusted text.
+	Safe bool
+	// Policy sanitizes HTML before other filters, so markup added by
+	// them doesn't have to be allowed.
+	Policy *Policy
+}
+
+// Pipeline renders markdown with blackfriday and passes result
+// through filters.
+type Pipeline struct {
+	Extensions int
+	HTMLFlags  int
+	Filters    []Filter
+}
+
+func NewPipeline(opt Options) *Pipeline {
+	p := &Pipeline{
+		Extensions: blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
+			blackfriday.EXTENSION_FENCED_CODE |
+			blackfriday.EXTENSION_AUTOLINK |
+			blackfriday.EXTENSION_STRIKETHROUGH |
+			blackfriday.EXTENSION_SPACE_HEADERS,
+		HTMLFlags: blackfriday.HTML_USE_XHTML,
+	}
+	if opt.Tables {
+		p.Extensions |= blackfriday.EXTENSION_TABLES
+	}
+	if opt.Footnotes {
+		p.Extensions |= blackfriday.EXTENSION_FOOTNOTES
+		p.HTMLFlags |= blackfriday.HTML_FOOTNOTE_RETURN_LINKS
+	}
+	if opt.Smartypants {
+		p.HTMLFlags |= blackfriday.HTML_USE_SMARTYPANTS |
+			blackfriday.HTML_SMARTYPANTS_FRACTIONS |
+			blackfriday.HTML_SMARTYPANTS_LATEX_DASHES
+	}
+	if opt.Safe {
+		p.HTMLFlags |= blackfriday.HTML_SKIP_HTML |
+			blackfriday.HTML_SKIP_STYLE |
+			blackfriday.HTML_SAFELINK |
+			blackfriday.HTML_NOFOLLOW_LINKS
+	} else {
+		// {#id} after heading text sets its id
+		p.Extensions |= blackfriday.EXTENSION_HEADER_IDS
+	}
+
+	if opt.Policy != nil {
+		p.Use(Sanitize(opt.Policy))
+	}
+	if opt.Highlight {
+		p.Use(FilterFunc(Highlight))
+	}
+	if opt.TaskLists {
+		p.Use(FilterFunc(TaskLists))
+	}
+	if opt.HeadingAnchors || opt.TOC {
+		p.Use(&Headings{Anchors: opt.HeadingAnchors, TOC: opt.TOC})
+	}
+	return p
+}
+
+// Use appends filters to the pipeline.
+func (p *Pipeline) Use(filters ...Filter) *Pipeline {
+	p.Filters = append(p.Filters, filters...)
+	return p
+}
+
+func (p *Pipeline) Render(text []byte) *Document {
+	renderer := blackfriday.HtmlRenderer(p.HTMLFlags, "", "")
+	doc := &Document{
+		HTML: blackfriday.Markdown(text, renderer, p.Extensions),
+	}
+	for _, f := range p.Filters {
+		f.Filter(doc)
+	}
+	return doc
+}
@@ -0,0 +1,66 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	headings := []Heading{
+		{Level: 2, ID: "a"},
+		{Level: 3, ID: "a1"},
+		{Level: 4, ID: "a1x"},
+		{Level: 3, ID: "a2"},
+		{Level: 2, ID: "b"},
+		{Level: 4, ID: "b1"},
+		{Level: 1, ID: "c"},
+	}
+
+	var format func(entries []*TOCEntry) string
+	format = func(entries []*TOCEntry) string {
+		s := make([]string, len(entries))
+		for i, e := range entries {
+			s[i] = e.ID
+			if len(e.Children) > 0 {
+				s[i] += "(" + format(e.Children) + ")"
+			}
+		}
+		return strings.Join(s, " ")
+	}
+
+	got := format(Tree(headings))
+	if want := "a(a1(a1x) a2) b(b1) c"; got != want {
+		t.Errorf("Tree = %s, want %s", got, want)
+	}
+	if toc := Tree(nil); toc != nil {
+		t.Errorf("Tree(nil) = %v, want nil", toc)
+	}
+}
+
+func TestPipelineHeadings(t *testing.T) {
+	p := NewPipeline(Options{HeadingAnchors: true, TOC: true, Policy: ArticlePolicy})
+	doc := p.Render([]byte("# A\n\n## A\n\n## A\n\n# B {#a-1}\n\n# C & D\n"))
+
+	want := []Heading{
+		{Level: 1, ID: "a", Text: "A"},
+		{Level: 2, ID: "a-2", Text: "A"},
+		{Level: 2, ID: "a-3", Text: "A"},
+		{Level: 1, ID: "a-1", Text: "B"},
+		{Level: 1, ID: "c-d", Text: "C & D"},
+	}
+	if !reflect.DeepEqual(doc.TOC, want) {
+		t.Errorf("TOC = %+v, want %+v", doc.TOC, want)
+	}
+	if s := `<h1 id="a-1">B <a class="header-anchor" href="#a-1">&para;</a></h1>`; !strings.Contains(string(doc.HTML), s) {
+		t.Errorf("HTML %s does not contain %s", doc.HTML, s)
+	}
+}
+
+func TestPipelineSafe(t *testing.T) {
+	p := NewPipeline(Options{Safe: true, Policy: CommentPolicy})
+	got := string(p.Render([]byte("hi <b onclick=\"x\">there</b> [x](javascript:alert(1))")).HTML)
+	if strings.Contains(got, "onclick") || strings.Contains(got, "javascript") {
+		t.Errorf("unsafe markup is rendered: %s", got)
+	}
+}
@@ -0,0 +1,320 @@
+package render
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// Policy lists tags and attributes allowed in rendered HTML. Everything
+// else is dropped by Sanitize; text of dropped tags is kept, except
+// contents of script and style.
+type Policy struct {
+	// Tags maps allowed tags to attributes allowed on them.
+	Tags map[string][]string
+	// Attributes are allowed on every allowed tag.
+	Attributes []string
+	// URLSchemes are allowed in href and src. Relative URLs are always
+	// allowed.
+	URLSchemes []string
+	// Nofollow sets rel="nofollow" on links to other sites.
+	Nofollow bool
+}
+
+func tagSet(tags string, attrs ...string) map[string][]string {
+	m := make(map[string][]string)
+	for _, tag := range strings.Fields(tags) {
+		m[tag] = attrs
+	}
+	return m
+}
+
+func mergeTags(sets ...map[string][]string) map[string][]string {
+	m := make(map[string][]string)
+	for _, set := range sets {
+		for tag, attrs := range set {
+			m[tag] = append(m[tag], attrs...)
+		}
+	}
+	return m
+}
+
+var (
+	// ArticlePolicy allows markup articles are written with, but nothing
+	// that runs scripts or loads foreign pages.
+	ArticlePolicy = &Policy{
+		Tags: mergeTags(
+			tagSet("p br hr blockquote pre code em strong b i u s del ins sub sup small mark "+
+				"abbr kbd samp var cite q ul ol li dl dt dd table thead tbody tfoot tr "+
+				"div span figure figcaption h1 h2 h3 h4 h5 h6"),
+			tagSet("th td", "align", "colspan", "rowspan"),
+			tagSet("a", "href", "name"),
+			tagSet("img", "src", "alt", "width", "height"),
+			tagSet("ol", "start"),
+		),
+		Attributes: []string{"id", "class", "title"},
+		URLSchemes: []string{"http", "https", "mailto"},
+		Nofollow:   true,
+	}
+
+	// CommentPolicy is stricter policy for text of untrusted users:
+	// no images, ids or classes except languages of code.
+	CommentPolicy = &Policy{
+		Tags: mergeTags(
+			tagSet("p br hr blockquote pre em strong del sup ul ol li table thead tbody tr th td "+
+				"h1 h2 h3 h4 h5 h6"),
+			tagSet("code", "class"),
+			tagSet("a", "href"),
+		),
+		URLSchemes: []string{"http", "https", "mailto"},
+		Nofollow:   true,
+	}
+)
+
+var (
+	voidTags = tagNames("br hr img input col wbr")
+	// blockTags close open paragraph like browsers do.
+	blockTags = tagNames("p div ul ol dl table pre blockquote hr figure h1 h2 h3 h4 h5 h6")
+)
+
+func tagNames(tags string) map[string]bool {
+	m := make(map[string]bool)
+	for _, tag := range strings.Fields(tags) {
+		m[tag] = true
+	}
+	return m
+}
+
+// closeTags closes open tags down to the last tag with the name and
+// returns the rest.
+func closeTags(out *bytes.Buffer, open []string, name string) []string {
+	for j := len(open) - 1; j >= 0; j-- {
+		if open[j] == name {
+			for k := len(open) - 1; k >= j; k-- {
+				out.WriteString("</" + open[k] + ">")
+			}
+			return open[:j]
+		}
+	}
+	return open
+}
+
+// Sanitize returns filter cleaning HTML by the policy.
+func Sanitize(policy *Policy) Filter {
+	return FilterFunc(func(doc *Document) {
+		doc.HTML = policy.Sanitize(doc.HTML)
+	})
+}
+
+// Sanitize parses HTML leniently and writes back only allowed tags and
+// attributes. Text is always escaped again and unclosed tags are closed,
+// so the result is well-formed whatever the input is.
+func (p *Policy) Sanitize(b []byte) []byte {
+	var out bytes.Buffer
+	var open []string
+	s := string(b)
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i == -1 {
+			i = len(s)
+		}
+		if i > 0 {
+			out.WriteString(html.EscapeString(html.UnescapeString(s[:i])))
+			s = s[i:]
+			continue
+		}
+
+		t, n := parseTag(s)
+		if n == 0 {
+			out.WriteString("&lt;")
+			s = s[1:]
+			continue
+		}
+		raw := s[:n]
+		s = s[n:]
+
+		switch {
+		case raw == MORE_MARKER:
+			out.WriteString(MORE_MARKER)
+		case t.name == "":
+			// comment or doctype
+		case t.isEnd:
+			open = closeTags(&out, open, t.name)
+		case t.name == "script" || t.name == "style":
+			if end := strings.Index(strings.ToLower(s), "</"+t.name); end != -1 {
+				s = s[end:]
+			} else {
+				s = ""
+			}
+		default:
+			if _, ok := p.Tags[t.name]; !ok {
+				continue
+			}
+			if blockTags[t.name] {
+				open = closeTags(&out, open, "p")
+			}
+			out.WriteString("<" + t.name)
+			for _, attr := range p.attrs(t) {
+				out.WriteString(" " + attr[0] + `="` + html.EscapeString(attr[1]) + `"`)
+			}
+			if voidTags[t.name] {
+				out.WriteString(" />")
+			} else {
+				out.WriteString(">")
+				open = append(open, t.name)
+			}
+		}
+	}
+	for k := len(open) - 1; k >= 0; k-- {
+		out.WriteString("</" + open[k] + ">")
+	}
+	return out.Bytes()
+}
+
+func (p *Policy) allowed(tag, attr string) bool {
+	for _, name := range p.Attributes {
+		if name == attr {
+			return true
+		}
+	}
+	for _, name := range p.Tags[tag] {
+		if name == attr {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) attrs(t *tag) [][2]string {
+	var attrs [][2]string
+	seen := make(map[string]bool)
+	isExternal := false
+	for _, attr := range t.attrs {
+		if seen[attr[0]] || !p.allowed(t.name, attr[0]) {
+			continue
+		}
+		seen[attr[0]] = true
+		if attr[0] == "href" || attr[0] == "src" {
+			u, ok := p.checkURL(attr[1])
+			if !ok {
+				continue
+			}
+			isExternal = u.Host != ""
+		}
+		attrs = append(attrs, attr)
+	}
+	if t.name == "a" && isExternal && p.Nofollow {
+		attrs = append(attrs, [2]string{"rel", "nofollow"})
+	}
+	return attrs
+}
+
+func (p *Policy) checkURL(s string) (*url.URL, bool) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, false
+	}
+	if u.Scheme == "" {
+		return u, true
+	}
+	for _, scheme := range p.URLSchemes {
+		if u.Scheme == scheme {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// ----------------------------------------------------------------------------
+
+type tag struct {
+	name  string
+	isEnd bool
+	attrs [][2]string
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == ':'
+}
+
+// parseTag parses tag, comment or doctype s starts with and returns its
+// length. Zero length means < is text. Comments and doctypes are returned
+// as tags without name.
+func parseTag(s string) (*tag, int) {
+	if strings.HasPrefix(s, "<!--") {
+		if end := strings.Index(s[4:], "-->"); end != -1 {
+			return &tag{}, 4 + end + 3
+		}
+		return &tag{}, len(s)
+	}
+	if strings.HasPrefix(s, "<!") || strings.HasPrefix(s, "<?") {
+		if end := strings.IndexByte(s, '>'); end != -1 {
+			return &tag{}, end + 1
+		}
+		return &tag{}, len(s)
+	}
+
+	t := &tag{}
+	i := 1
+	if i < len(s) && s[i] == '/' {
+		t.isEnd = true
+		i++
+	}
+	if i == len(s) || !(s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z') {
+		return nil, 0
+	}
+	start := i
+	for i < len(s) && isNameByte(s[i]) {
+		i++
+	}
+	t.name = strings.ToLower(s[start:i])
+
+	for {
+		for i < len(s) && (isSpace(s[i]) || s[i] == '/') {
+			i++
+		}
+		if i == len(s) {
+			return t, i
+		}
+		if s[i] == '>' {
+			return t, i + 1
+		}
+
+		start := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '>' && s[i] != '=' && s[i] != '/' {
+			i++
+		}
+		name := strings.ToLower(s[start:i])
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		value := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				q := s[i]
+				end := strings.IndexByte(s[i+1:], q)
+				if end == -1 {
+					return t, len(s)
+				}
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				value = s[start:i]
+			}
+		}
+		t.attrs = append(t.attrs, [2]string{name, html.UnescapeString(value)})
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
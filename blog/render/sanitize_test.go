@@ -0,0 +1,76 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		article string
+		comment string
+	}{
+		// URL schemes
+		{"javascript", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`, `<a>x</a>`},
+		{"javascript case", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a>x</a>`, `<a>x</a>`},
+		{"javascript entity", `<a href="&#106;avascript:alert(1)">x</a>`, `<a>x</a>`, `<a>x</a>`},
+		{"javascript hex entity", `<a href="&#x6A;avascript&colon;alert(1)">x</a>`, `<a>x</a>`, `<a>x</a>`},
+		{"javascript tab", "<a href=\"java\tscript:alert(1)\">x</a>", `<a>x</a>`, `<a>x</a>`},
+		{"javascript tab entity", `<a href="jav&#x09;ascript:alert(1)">x</a>`, `<a>x</a>`, `<a>x</a>`},
+		{"javascript control", "<a href=\"\x01javascript:alert(1)\">x</a>", `<a>x</a>`, `<a>x</a>`},
+		{"javascript space", `<a href=" javascript:alert(1)">x</a>`, `<a>x</a>`, `<a>x</a>`},
+		{"data", `<a href="data:text/html,<script>alert(1)</script>">x</a>`, `<a>x</a>`, `<a>x</a>`},
+		{"vbscript", `<a href="vbscript:x">x</a>`, `<a>x</a>`, `<a>x</a>`},
+		{"img javascript", `<img src="javascript:alert(1)">`, `<img />`, ``},
+		{"duplicate href", `<a href="x" href="javascript:alert(1)">x</a>`, `<a href="x">x</a>`, `<a href="x">x</a>`},
+		{"mailto", `<a href="mailto:a@b.c">x</a>`, `<a href="mailto:a@b.c">x</a>`, `<a href="mailto:a@b.c">x</a>`},
+
+		// attributes
+		{"onerror", `<img src="x.png" onerror="alert(1)">`, `<img src="x.png" />`, ``},
+		{"onclick", `<p onclick="alert(1)" class="c">x</p>`, `<p class="c">x</p>`, `<p>x</p>`},
+		{"unquoted on", `<p title="a" onmouseover=alert(1)>x</p>`, `<p title="a">x</p>`, `<p>x</p>`},
+		{"escaped value", `<a title='x>y'>z</a>`, `<a title="x&gt;y">z</a>`, `<a>z</a>`},
+		{"unknown attribute", `<p x="&quot;&gt;<script>">y</p>`, `<p>y</p>`, `<p>y</p>`},
+		{"unclosed quote", `<a href="http://x.com>text`, `<a></a>`, `<a></a>`},
+		{"ids and classes", `<code class="language-go">x</code><p id="x" class="y">z</p>`,
+			`<code class="language-go">x</code><p id="x" class="y">z</p>`,
+			`<code class="language-go">x</code><p>z</p>`},
+
+		// tags
+		{"script", `<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`, `<p>ab</p>`},
+		{"style", `<p>a<style>p{}</style>b</p>`, `<p>ab</p>`, `<p>ab</p>`},
+		{"unclosed script", `<script>alert(1)`, ``, ``},
+		{"script in svg", `<svg><script>alert(1)</script></svg>`, ``, ``},
+		{"iframe", `<iframe src="http://evil"></iframe>x`, `x`, `x`},
+		{"mismatched", `<b><i>x</b>y</i>`, `<b><i>x</i></b>y`, `xy`},
+		{"nested blocks", `<div><p>a<div>b</div>`, `<div><p>a</p><div>b</div></div>`, `<p>ab</p>`},
+		{"text", `<p>1 < 2 & 3 > 2</p>`, `<p>1 &lt; 2 &amp; 3 &gt; 2</p>`, `<p>1 &lt; 2 &amp; 3 &gt; 2</p>`},
+		{"comments", `<!--more-->x<!-- secret --><!doctype html>`, `<!--more-->x`, `<!--more-->x`},
+
+		// nofollow
+		{"external link", `<a href="http://ex.com/" rel="follow">x</a>`,
+			`<a href="http://ex.com/" rel="nofollow">x</a>`,
+			`<a href="http://ex.com/" rel="nofollow">x</a>`},
+		{"local link", `<a href="/local">x</a>`, `<a href="/local">x</a>`, `<a href="/local">x</a>`},
+	}
+	for _, test := range tests {
+		if got := string(ArticlePolicy.Sanitize([]byte(test.in))); got != test.article {
+			t.Errorf("%s: ArticlePolicy.Sanitize(%q) = %q, want %q", test.name, test.in, got, test.article)
+		}
+		if got := string(CommentPolicy.Sanitize([]byte(test.in))); got != test.comment {
+			t.Errorf("%s: CommentPolicy.Sanitize(%q) = %q, want %q", test.name, test.in, got, test.comment)
+		}
+	}
+}
+
+func TestSanitizeNofollow(t *testing.T) {
+	p := &Policy{
+		Tags:       tagSet("a", "href"),
+		URLSchemes: []string{"http"},
+	}
+	in := []byte(`<a href="http://ex.com/">x</a>`)
+	if got, want := string(p.Sanitize(in)), `<a href="http://ex.com/">x</a>`; got != want {
+		t.Errorf("without Nofollow got %q, want %q", got, want)
+	}
+}
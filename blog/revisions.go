@@ -0,0 +1,146 @@
+package blog
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"auth"
+	"core/entity"
+	"core/store"
+)
+
+const (
+	ARTICLE_REVISION_KIND = "articleRevision"
+)
+
+// ArticleRevision is a snapshot of the article saved on every update.
+// Its parent is the article.
+type ArticleRevision struct {
+	*entity.Entity `datastore:"-"`
+
+	Title      string
+	TextBytes  []byte `datastore:",noindex"`
+	AuthorKey  *store.Key
+	AuthorName string
+	CreatedOn  time.Time
+}
+
+func NewArticleRevision() *ArticleRevision {
+	return &ArticleRevision{
+		Entity: entity.NewEntity(ARTICLE_REVISION_KIND),
+	}
+}
+
+func NewArticleRevisionQuery(article *Article) *store.Query {
+	return store.NewQuery(ARTICLE_REVISION_KIND).Ancestor(article.Key())
+}
+
+func (r *ArticleRevision) SetKey(key *store.Key) {
+	if r.Entity == nil {
+		r.Entity = entity.NewEntity(ARTICLE_REVISION_KIND)
+	}
+	r.Entity.SetKey(key)
+}
+
+func (r *ArticleRevision) Text() string {
+	return string(r.TextBytes)
+}
+
+func (r *ArticleRevision) RestoreURL() (*url.URL, error) {
+	return Router.GetRoute("articleRestore").URL(
+		"id",
+		strconv.FormatInt(r.Key().Parent().IntID(), 10),
+		"revision",
+		strconv.FormatInt(r.Key().IntID(), 10),
+	)
+}
+
+func createArticleRevision(c store.Context, article *Article, user *auth.User) error {
+	return putArticleRevision(c, article, &ArticleRevision{
+		Title:      article.Title,
+		TextBytes:  article.TextBytes,
+		AuthorKey:  user.Key(),
+		AuthorName: user.PublicName(),
+		CreatedOn:  time.Now(),
+	})
+}
+
+func putArticleRevision(c store.Context, article *Article, revision *ArticleRevision) error {
+	key := store.NewIncompleteKey(ARTICLE_REVISION_KIND, article.Key())
+	_, err := store.Put(c, key, revision)
+	return err
+}
+
+// initialArticleRevision returns revision holding saved text of the
+// article if it has no revisions yet, i.e. it was created before
+// revisions were kept. Otherwise it returns nil.
+func initialArticleRevision(c store.Context, article *Article) (*ArticleRevision, error) {
+	if article.Key() == nil {
+		return nil, nil
+	}
+	keys, err := NewArticleRevisionQuery(article).KeysOnly().Limit(1).GetAll(c, nil)
+	if err != nil || len(keys) > 0 {
+		return nil, err
+	}
+	if err := LoadAuthors(c, article); err != nil {
+		return nil, err
+	}
+	revision := &ArticleRevision{
+		Title:     article.Title,
+		TextBytes: article.TextBytes,
+		AuthorKey: article.AuthorKey,
+		CreatedOn: article.UpdatedOn,
+	}
+	if author := article.Author(); author != nil {
+		revision.AuthorName = author.PublicName()
+	}
+	if revision.CreatedOn.IsZero() {
+		revision.CreatedOn = article.CreatedOn
+	}
+	return revision, nil
+}
+
+func GetArticleRevision(c store.Context, article *Article, id int64) (*ArticleRevision, error) {
+	key := store.NewKey(ARTICLE_REVISION_KIND, "", id, article.Key())
+	revision := NewArticleRevision()
+	if err := store.Get(c, key, revision); err != nil {
+		return nil, err
+	}
+	revision.SetKey(key)
+	return revision, nil
+}
+
+// GetArticleRevisions returns revisions of the article, newest first.
+func GetArticleRevisions(c store.Context, article *Article) ([]*ArticleRevision, error) {
+	q := NewArticleRevisionQuery(article).Order("-CreatedOn")
+
+	revisions := make([]*ArticleRevision, 0)
+	keys, err := q.GetAll(c, &revisions)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		revisions[i].SetKey(key)
+	}
+	return revisions, nil
+}
+
+func RestoreArticleRevision(c store.Context, article *Article, revision *ArticleRevision, user *auth.User) error {
+	return UpdateArticle(c, article, user,
+		revision.Title, revision.Text(), article.Tags,
+		article.IsPublic || article.IsScheduled, article.PublishAt, article.ShowTOC)
+}
+
+func deleteArticleRevisions(c store.Context, article *Article) error {
+	keys, err := NewArticleRevisionQuery(article).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := store.Delete(c, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package blog
+
+import (
+	"time"
+
+	"core/cache"
+	"core/store"
+)
+
+const (
+	NEXT_PUBLISH_CACHE_KEY = "next-publish"
+)
+
+var scheduleCache = cache.New[time.Time]("blog-schedule", cache.Options{
+	Codec:      cache.JSON,
+	Expiration: 24 * time.Hour,
+})
+
+// nextPublishAt returns cached time of the next scheduled publication.
+// Zero time means that nothing is scheduled.
+func nextPublishAt(c store.Context) (time.Time, bool) {
+	t, err := scheduleCache.Get(c, NEXT_PUBLISH_CACHE_KEY)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func setNextPublishAt(c store.Context, t time.Time) {
+	if err := scheduleCache.Set(c, NEXT_PUBLISH_CACHE_KEY, t); err != nil {
+		c.Errorf("error setting item: %v", err)
+	}
+}
+
+// resetSchedule makes next PublishScheduledArticles call check
+// scheduled articles in the store.
+func resetSchedule(c store.Context) {
+	if err := scheduleCache.Delete(c, NEXT_PUBLISH_CACHE_KEY); err != nil {
+		c.Errorf("error deleting item: %v", err)
+	}
+}
+
+// PublishScheduledArticles publishes articles whose PublishAt has passed;
+// saving them bumps ArticleListings, because pages contents change. It is
+// cheap to call on every request: store is only queried when the cached
+// time of the next publication has come or is unknown.
+func PublishScheduledArticles(c store.Context) error {
+	now := time.Now()
+	if next, ok := nextPublishAt(c); ok && (next.IsZero() || next.After(now)) {
+		return nil
+	}
+
+	q := NewArticleQuery().Filter("IsScheduled =", true).Order("PublishAt")
+	articles := make([]*Article, 0)
+	keys, err := q.GetAll(c, &articles)
+	if err != nil {
+		return err
+	}
+
+	var next time.Time
+	for i, article := range articles {
+		article.SetKey(keys[i])
+		if article.PublishAt.After(now) {
+			next = article.PublishAt
+			break
+		}
+		if err := publishArticle(c, article.Key()); err != nil {
+			return err
+		}
+	}
+
+	setNextPublishAt(c, next)
+	return nil
+}
+
+// publishArticle publishes the article if it is still scheduled. The
+// article is re-read in transaction, so concurrent requests publish it,
+// index it and count its tags only once.
+func publishArticle(c store.Context, key *store.Key) error {
+	var article *Article
+	err := store.RunInTransaction(c, func(c store.Context) error {
+		a, err := Articles.Load(c, key)
+		if err != nil {
+			return err
+		}
+		if !a.IsScheduled {
+			return nil
+		}
+		a.IsPublic = true
+		a.IsScheduled = false
+		a.UpdatedOn = time.Now()
+		if err := Articles.Put(c, a); err != nil {
+			return err
+		}
+		article = a
+		return nil
+	})
+	if err != nil || article == nil {
+		return err
+	}
+
+	if err := indexArticle(c, article); err != nil {
+		return err
+	}
+
+	return changeTagCounts(c, nil, article.publicTags())
+}
+
+// FillPublishAt sets PublishAt of public articles saved before it was
+// set on publication, so they are listed by publication time. It returns
+// number of changed articles.
+func FillPublishAt(c store.Context) (int, error) {
+	articles, err := Articles.GetAll(c, NewArticleQuery().Filter("IsPublic=", true))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, article := range articles {
+		if !article.PublishAt.IsZero() {
+			continue
+		}
+		article.PublishAt = article.CreatedOn
+		if err := Articles.Put(c, article); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
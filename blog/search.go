@@ -0,0 +1,281 @@
+package blog
+
+import (
+	"html/template"
+	"sort"
+	"time"
+
+	"core/pager"
+	"core/search"
+	"core/store"
+)
+
+const (
+	SEARCH_DOC_KIND   = "searchDoc"
+	SEARCH_STATS_KIND = "searchStats"
+
+	// Title terms weigh more than text terms.
+	SEARCH_TITLE_WEIGHT   = 3
+	SEARCH_SNIPPET_WIDTH  = 30
+	SEARCH_MAX_CANDIDATES = 1000
+)
+
+// SearchDocument is the inverted index entry of the article: store index
+// of the multi-valued Terms maps each term to documents containing it.
+// Freqs holds frequencies of Terms.
+type SearchDocument struct {
+	Terms     []string
+	Freqs     []int `datastore:",noindex"`
+	Length    int   `datastore:",noindex"`
+	IsPublic  bool
+	CreatedOn time.Time
+}
+
+// SearchStats holds collection statistics needed by BM25.
+type SearchStats struct {
+	DocCount    int
+	TotalLength int
+}
+
+type SearchResult struct {
+	Article *Article
+	Score   float64
+	Snippet template.HTML
+}
+
+func searchDocKey(articleKey *store.Key) *store.Key {
+	return store.NewKey(SEARCH_DOC_KIND, "", articleKey.IntID(), nil)
+}
+
+func searchStatsKey() *store.Key {
+	return store.NewKey(SEARCH_STATS_KIND, "all", 0, nil)
+}
+
+func newSearchDocument(article *Article) *SearchDocument {
+	freqs := search.Frequencies(search.Tokenize(search.PlainText(article.HTML())))
+	length := 0
+	for _, n := range freqs {
+		length += n
+	}
+	for _, term := range search.Tokenize(article.Title) {
+		freqs[term] += SEARCH_TITLE_WEIGHT
+		length += SEARCH_TITLE_WEIGHT
+	}
+
+	doc := &SearchDocument{
+		Terms:     make([]string, 0, len(freqs)),
+		Freqs:     make([]int, 0, len(freqs)),
+		Length:    length,
+		IsPublic:  article.IsPublic,
+		CreatedOn: article.CreatedOn,
+	}
+	for term, n := range freqs {
+		doc.Terms = append(doc.Terms, term)
+		doc.Freqs = append(doc.Freqs, n)
+	}
+	return doc
+}
+
+func (d *SearchDocument) freq(term string) int {
+	for i, t := range d.Terms {
+		if t == term {
+			return d.Freqs[i]
+		}
+	}
+	return 0
+}
+
+func getSearchStats(c store.Context) (*SearchStats, error) {
+	stats := &SearchStats{}
+	err := store.Get(c, searchStatsKey(), stats)
+	if err != nil && err != store.ErrNoSuchEntity {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func changeSearchStats(c store.Context, docCount, totalLength int) error {
+	return store.RunInTransaction(c, func(c store.Context) error {
+		stats, err := getSearchStats(c)
+		if err != nil {
+			return err
+		}
+		stats.DocCount += docCount
+		stats.TotalLength += totalLength
+		_, err = store.Put(c, searchStatsKey(), stats)
+		return err
+	})
+}
+
+// indexArticle adds the article to the search index or updates its entry.
+func indexArticle(c store.Context, article *Article) error {
+	key := searchDocKey(article.Key())
+
+	docCount, oldLength := 1, 0
+	old := &SearchDocument{}
+	switch err := store.Get(c, key, old); err {
+	case nil:
+		docCount, oldLength = 0, old.Length
+	case store.ErrNoSuchEntity:
+	default:
+		return err
+	}
+
+	doc := newSearchDocument(article)
+	if _, err := store.Put(c, key, doc); err != nil {
+		return err
+	}
+	return changeSearchStats(c, docCount, doc.Length-oldLength)
+}
+
+func unindexArticle(c store.Context, article *Article) error {
+	key := searchDocKey(article.Key())
+
+	doc := &SearchDocument{}
+	switch err := store.Get(c, key, doc); err {
+	case nil:
+	case store.ErrNoSuchEntity:
+		return nil
+	default:
+		return err
+	}
+
+	if err := store.Delete(c, key); err != nil {
+		return err
+	}
+	return changeSearchStats(c, -1, -doc.Length)
+}
+
+// ReindexArticles rebuilds search index of all articles and returns
+// number of indexed articles.
+func ReindexArticles(c store.Context) (int, error) {
+	keys, err := store.NewQuery(SEARCH_DOC_KIND).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := store.Delete(c, key); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := store.Put(c, searchStatsKey(), &SearchStats{}); err != nil {
+		return 0, err
+	}
+
+	articles := make([]*Article, 0)
+	keys, err = NewArticleQuery().GetAll(c, &articles)
+	if err != nil {
+		return 0, err
+	}
+	for i, article := range articles {
+		article.SetKey(keys[i])
+		if err := indexArticle(c, article); err != nil {
+			return i, err
+		}
+	}
+	return len(articles), nil
+}
+
+type searchCandidate struct {
+	key   *store.Key
+	doc   *SearchDocument
+	score float64
+}
+
+type byScore []*searchCandidate
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].score != s[j].score {
+		return s[i].score > s[j].score
+	}
+	return s[i].doc.CreatedOn.After(s[j].doc.CreatedOn)
+}
+
+// SearchArticles returns page of articles matching any of the query terms
+// ranked by BM25. Private articles are only searched if includePrivate.
+// At most SEARCH_MAX_CANDIDATES documents per term are ranked, so matches
+// of very common terms beyond that are not found unless other terms match.
+func SearchArticles(c store.Context, query string, includePrivate bool, p *pager.Pager) ([]*SearchResult, error) {
+	terms := search.Unique(search.Tokenize(query))
+	if len(terms) == 0 {
+		p.SetHasNext(false)
+		return nil, nil
+	}
+
+	stats, err := getSearchStats(c)
+	if err != nil {
+		return nil, err
+	}
+	avgDocLen := 0.0
+	if stats.DocCount > 0 {
+		avgDocLen = float64(stats.TotalLength) / float64(stats.DocCount)
+	}
+
+	candidates := make(map[int64]*searchCandidate)
+	for _, term := range terms {
+		q := store.NewQuery(SEARCH_DOC_KIND).Filter("Terms =", term)
+		if !includePrivate {
+			q = q.Filter("IsPublic =", true)
+		}
+		docs := make([]*SearchDocument, 0)
+		keys, err := q.Limit(SEARCH_MAX_CANDIDATES).GetAll(c, &docs)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only loaded documents are ranked, but IDF of a common term
+		// needs all of them.
+		docFreq := len(keys)
+		if docFreq == SEARCH_MAX_CANDIDATES {
+			allKeys, err := q.KeysOnly().GetAll(c, nil)
+			if err != nil {
+				return nil, err
+			}
+			docFreq = len(allKeys)
+		}
+
+		idf := search.IDF(stats.DocCount, docFreq)
+		for i, key := range keys {
+			cand, ok := candidates[key.IntID()]
+			if !ok {
+				cand = &searchCandidate{key: key, doc: docs[i]}
+				candidates[key.IntID()] = cand
+			}
+			cand.score += search.BM25(idf, docs[i].freq(term), docs[i].Length, avgDocLen)
+		}
+	}
+
+	ranked := make([]*searchCandidate, 0, len(candidates))
+	for _, cand := range candidates {
+		ranked = append(ranked, cand)
+	}
+	sort.Sort(byScore(ranked))
+
+	start := p.Offset()
+	if start > len(ranked) {
+		start = len(ranked)
+	}
+	end := start + p.PageSize
+	if end > len(ranked) {
+		end = len(ranked)
+	}
+	p.SetHasNext(end < len(ranked))
+
+	results := make([]*SearchResult, 0, end-start)
+	for _, cand := range ranked[start:end] {
+		article, err := GetArticleById(c, cand.key.IntID(), !includePrivate)
+		if err == store.ErrNoSuchEntity {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		results = append(results, &SearchResult{
+			Article: article,
+			Score:   cand.score,
+			Snippet: search.Highlight(search.PlainText(article.HTML()), terms, SEARCH_SNIPPET_WIDTH),
+		})
+	}
+	return results, nil
+}
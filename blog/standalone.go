@@ -0,0 +1,53 @@
+//go:build !appengine
+// +build !appengine
+
+package blog
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vmihailenco/gforms"
+
+	"auth"
+	"core"
+	"core/store"
+)
+
+const (
+	MAX_FORM_MEMORY = 32 << 20
+)
+
+var errNoBlobstore = errors.New("Image uploads require App Engine blobstore.")
+
+func isArticleFormValid(r *http.Request, form *ArticleForm) (bool, error) {
+	if err := r.ParseMultipartForm(MAX_FORM_MEMORY); err != nil && err != http.ErrNotMultipart {
+		return false, err
+	}
+	return gforms.IsFormValid(form, r.Form), nil
+}
+
+// ImageUploadURLHandler returns URL of the upload handler itself,
+// because there is no blobstore to upload to.
+func ImageUploadURLHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	imageUploadURL, err := Router.GetRoute("imageUpload").URL()
+	if err != nil {
+		core.HandleError(c, w, err)
+		return
+	}
+
+	core.HandleJSON(c, w, map[string]string{"url": imageUploadURL.Path})
+}
+
+func ImageUploadHandler(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	user := core.RequirePermission(c, w, auth.PERM_ARTICLE_CREATE, nil)
+	if user == nil {
+		return
+	}
+
+	core.HandleJSONError(c, w, http.StatusNotImplemented, errNoBlobstore)
+}
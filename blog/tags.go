@@ -0,0 +1,189 @@
+package blog
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+
+	"core/entity"
+	"core/store"
+	"tmplt"
+)
+
+const (
+	TAG_KIND = "tag"
+
+	TAG_CLOUD_WEIGHTS = 5
+)
+
+// Tag keeps number of public articles with the tag. Its key name
+// is the tag itself.
+type Tag struct {
+	*entity.Entity `datastore:"-"`
+
+	Name  string
+	Count int
+}
+
+func NewTag(name string) *Tag {
+	t := &Tag{Name: name}
+	t.SetKey(store.NewKey(TAG_KIND, name, 0, nil))
+	return t
+}
+
+func (t *Tag) SetKey(key *store.Key) {
+	if t.Entity == nil {
+		t.Entity = entity.NewEntity(TAG_KIND)
+	}
+	t.Entity.SetKey(key)
+}
+
+func (t *Tag) URL() (*url.URL, error) {
+	return Router.GetRoute("tag").URL("tag", t.Name)
+}
+
+var errInvalidTag = errors.New("Tags must contain letters or digits.")
+
+// tagSymbols are spelled out after words, so c++ and c# don't become c.
+var tagSymbols = map[rune]string{'+': "plus", '#': "sharp"}
+
+// normalizeTag returns lowercased letters, digits and underscores of the
+// tag, with words separated by dashes.
+func normalizeTag(tag string) string {
+	var b strings.Builder
+	dash, symbol := false, false
+	for _, r := range strings.ToLower(tag) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			if symbol || dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash, symbol = false, false
+		} else if name, ok := tagSymbols[r]; ok && b.Len() > 0 && !dash {
+			b.WriteString("-" + name)
+			symbol = true
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// ParseTags splits comma separated list of tags and normalizes them,
+// so they can be used in URLs. Tags without letters or digits are
+// skipped and errInvalidTag is returned with the rest.
+func ParseTags(s string) ([]string, error) {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	var err error
+	for _, tag := range strings.Split(s, ",") {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		tag = normalizeTag(tag)
+		if tag == "" {
+			err = errInvalidTag
+			continue
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags, err
+}
+
+// changeTagCounts updates article counters of tags, that were
+// removed from or added to public article.
+func changeTagCounts(c store.Context, oldTags, newTags []string) error {
+	deltas := make(map[string]int)
+	for _, tag := range oldTags {
+		deltas[tag]--
+	}
+	for _, tag := range newTags {
+		deltas[tag]++
+	}
+
+	for name, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		tag := NewTag(name)
+		err := store.RunInTransaction(c, func(c store.Context) error {
+			err := store.Get(c, tag.Key(), tag)
+			if err != nil && err != store.ErrNoSuchEntity {
+				return err
+			}
+			tag.Count += delta
+			if tag.Count < 0 {
+				tag.Count = 0
+			}
+			return entity.Put(c, tag)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeTags normalizes tags like ParseTags does.
+func normalizeTags(tags []string) ([]string, error) {
+	return ParseTags(strings.Join(tags, ","))
+}
+
+type TagCloudItem struct {
+	*Tag
+	// Weight is in range [1, TAG_CLOUD_WEIGHTS].
+	Weight int
+}
+
+func GetTagCloud(c store.Context) ([]*TagCloudItem, error) {
+	tags := make([]*Tag, 0)
+	keys, err := store.NewQuery(TAG_KIND).GetAll(c, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*TagCloudItem, 0, len(tags))
+	minCount, maxCount := math.MaxInt32, 0
+	for i, tag := range tags {
+		if tag.Count <= 0 {
+			continue
+		}
+		tag.SetKey(keys[i])
+		items = append(items, &TagCloudItem{Tag: tag})
+		if tag.Count < minCount {
+			minCount = tag.Count
+		}
+		if tag.Count > maxCount {
+			maxCount = tag.Count
+		}
+	}
+
+	spread := math.Log(float64(maxCount)) - math.Log(float64(minCount))
+	for _, item := range items {
+		item.Weight = 1
+		if spread > 0 {
+			w := (math.Log(float64(item.Count)) - math.Log(float64(minCount))) / spread
+			item.Weight += int(w * (TAG_CLOUD_WEIGHTS - 1))
+		}
+	}
+
+	sort.Sort(byTagName(items))
+	return items, nil
+}
+
+type byTagName []*TagCloudItem
+
+func (s byTagName) Len() int           { return len(s) }
+func (s byTagName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byTagName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+func tagCloud(context tmplt.Context) ([]*TagCloudItem, error) {
+	return GetTagCloud(context["requestContext"].(store.Context))
+}
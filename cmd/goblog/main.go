@@ -0,0 +1,182 @@
+//go:build !appengine
+// +build !appengine
+
+// Command goblog serves the blog with plain net/http server, without
+// App Engine SDK.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	_ "account"
+	"auth"
+	"blog"
+	"core"
+	"core/store"
+	"core/store/memory"
+	"core/store/sqlstore"
+)
+
+var (
+	addr            = flag.String("addr", ":8080", "address to listen on")
+	templateDir     = flag.String("templates", "templates", "templates directory")
+	staticDir       = flag.String("static", "static", "static files directory")
+	storeName       = flag.String("store", "memory", "storage backend: memory, sqlite3 or postgres")
+	dsn             = flag.String("dsn", "goblog.db", "data source name for sqlite3 and postgres backends")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for active requests on shutdown")
+
+	localAuth         = flag.Bool("local-auth", true, "allow login with username and password")
+	allowRegistration = flag.Bool("allow-registration", false, "let visitors create local accounts")
+	oidcName          = flag.String("oidc-name", "oidc", "OpenID Connect provider name used in URLs")
+	oidcTitle         = flag.String("oidc-title", "OpenID Connect", "OpenID Connect provider title shown on login page")
+	oidcIssuer        = flag.String("oidc-issuer", "", "OpenID Connect issuer URL; login with OpenID Connect is disabled when empty")
+	oidcClientID      = flag.String("oidc-client-id", "", "OpenID Connect client id")
+	oidcClientSecret  = flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	oidcRedirectURL   = flag.String("oidc-redirect-url", "", "OpenID Connect callback URL, derived from request when empty")
+
+	createUser = flag.String("create-user", "", "create local user with the username and -password, then exit")
+	password   = flag.String("password", "", "password of the created user")
+	isAdmin    = flag.Bool("admin", false, "make the created user admin")
+
+	rerender = flag.Bool("rerender", false, "render markdown of all articles and comments again and set missing publication times, then exit")
+)
+
+func registerProviders() {
+	if *localAuth {
+		p := auth.NewLocalProvider()
+		p.AllowRegistration = *allowRegistration
+		auth.RegisterProvider(p)
+	}
+	if *oidcIssuer != "" {
+		p := auth.NewOIDCProvider(*oidcName, *oidcTitle, *oidcIssuer, *oidcClientID, *oidcClientSecret)
+		p.RedirectURL = *oidcRedirectURL
+		auth.RegisterProvider(p)
+	}
+}
+
+func createLocalUser() error {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		return err
+	}
+	u, err := auth.CreateLocalUser(store.NewContext(r), *createUser, *password, *isAdmin)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created user %s (%s)\n", u.Name, u.Key().Encode())
+	return nil
+}
+
+func rerenderAll() error {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		return err
+	}
+	c := store.NewContext(r)
+	articles, err := blog.RerenderArticles(c)
+	if err != nil {
+		return err
+	}
+	comments, err := blog.RerenderComments(c)
+	if err != nil {
+		return err
+	}
+	filled, err := blog.FillPublishAt(c)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rerendered %d articles and %d comments, set publication time of %d articles\n",
+		articles, comments, filled)
+	return nil
+}
+
+func openBackend() (store.Backend, func() error, error) {
+	if *storeName == "memory" {
+		return memory.NewBackend(), func() error { return nil }, nil
+	}
+	backend, err := sqlstore.Open(*storeName, *dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return backend, backend.Close, nil
+}
+
+func serveFile(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(*staticDir, name))
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	backend, closeBackend, err := openBackend()
+	if err != nil {
+		log.Fatalf("can't open %s store: %v", *storeName, err)
+	}
+	store.Register(backend)
+	core.TemplateDir = *templateDir
+
+	if *createUser != "" {
+		err := createLocalUser()
+		closeBackend()
+		if err != nil {
+			log.Fatalf("can't create user: %v", err)
+		}
+		return
+	}
+	if *rerender {
+		err := rerenderAll()
+		closeBackend()
+		if err != nil {
+			log.Fatalf("can't rerender: %v", err)
+		}
+		return
+	}
+	registerProviders()
+
+	mux := http.NewServeMux()
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(*staticDir))))
+	mux.HandleFunc("/favicon.ico", serveFile("favicon.ico"))
+	mux.HandleFunc("/robots.txt", serveFile("robots.txt"))
+	mux.Handle("/", core.Handler())
+
+	srv := &http.Server{Addr: *addr, Handler: mux}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+		log.Printf("got %v, shutting down", <-sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("shutdown failed: %v", err)
+		}
+	}()
+
+	log.Printf("listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+
+	if err := closeBackend(); err != nil {
+		log.Printf("can't close store: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build appengine
+// +build appengine
+
+package core
+
+import (
+	"net/http"
+
+	"appengine/blobstore"
+
+	"core/store"
+	"core/store/gae"
+	"tmplt"
+)
+
+func init() {
+	store.Register(gae.Backend{})
+	http.Handle("/", Handler())
+}
+
+func blobstoreUploadURL(context tmplt.Context, url string) (string, error) {
+	c := gae.AppengineContext(context["requestContext"].(store.Context))
+	uploadURL, err := blobstore.UploadURL(c, url, nil)
+	if err != nil {
+		return "", err
+	}
+	return uploadURL.Path, nil
+}
@@ -0,0 +1,254 @@
+// Package cache implements typed read-through cache on top of
+// store.Cache backends, i.e. memcache or in-process LRU.
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"core/store"
+)
+
+const (
+	valueFlag    = 'v'
+	notFoundFlag = 'n'
+)
+
+// Backend returns storage of the cache for the request.
+type Backend func(c store.Context) store.Cache
+
+// Memcache is cache of the store context, i.e. memcache on App Engine.
+func Memcache(c store.Context) store.Cache {
+	return c.Cache()
+}
+
+// InProcess returns backend keeping items in the LRU of this process.
+// Items are not shared between instances, so it only suits data that
+// is invalidated by the same process or may be stale for a while.
+func InProcess(lru *LRU) Backend {
+	return func(c store.Context) store.Cache {
+		return lru
+	}
+}
+
+type Options struct {
+	// Codec is GOB when nil.
+	Codec Codec
+	// Backend is Memcache when nil.
+	Backend Backend
+	// New returns value to decode cached items into. Zero value
+	// is used when nil.
+	New func() interface{}
+	// Namespace versions keys of the cache when not nil. Its generation
+	// is kept in the context cache whatever the Backend is.
+	Namespace *Namespace
+
+	Expiration time.Duration
+	// NegativeExpiration is how long store.ErrNoSuchEntity returned
+	// by loader is cached. Zero disables negative caching.
+	NegativeExpiration time.Duration
+}
+
+// Cache stores values of type T under keys prefixed by its namespace.
+type Cache[T any] struct {
+	namespace string
+	opt       Options
+	flight    group
+}
+
+func New[T any](namespace string, opt Options) *Cache[T] {
+	if opt.Codec == nil {
+		opt.Codec = GOB
+	}
+	if opt.Backend == nil {
+		opt.Backend = Memcache
+	}
+	return &Cache[T]{
+		namespace: namespace,
+		opt:       opt,
+	}
+}
+
+// Key returns key of the item in the backend.
+func (x *Cache[T]) Key(c store.Context, key string) string {
+	key = x.namespace + ":" + key
+	if x.opt.Namespace != nil {
+		key = x.opt.Namespace.Key(c, key)
+	}
+	return key
+}
+
+func (x *Cache[T]) newValue() T {
+	var v T
+	if x.opt.New != nil {
+		v = x.opt.New().(T)
+	}
+	return v
+}
+
+// Get returns cached value. It returns store.ErrCacheMiss when there is
+// no value and store.ErrNoSuchEntity when absence of the value is cached.
+// Backend and decoding errors are logged and reported as misses.
+func (x *Cache[T]) Get(c store.Context, key string) (T, error) {
+	return x.get(c, x.Key(c, key))
+}
+
+func (x *Cache[T]) get(c store.Context, fullKey string) (T, error) {
+	var zero T
+
+	data, err := x.opt.Backend(c).Get(fullKey)
+	if err != nil {
+		if err != store.ErrCacheMiss {
+			c.Errorf("error getting item: %v", err)
+		}
+		return zero, store.ErrCacheMiss
+	}
+	if len(data) == 0 {
+		return zero, store.ErrCacheMiss
+	}
+
+	switch data[0] {
+	case notFoundFlag:
+		return zero, store.ErrNoSuchEntity
+	case valueFlag:
+		v, err := x.decode(data)
+		if err != nil {
+			c.Errorf("error decoding %s: %v", x.namespace, err)
+			return zero, store.ErrCacheMiss
+		}
+		return v, nil
+	}
+	return zero, store.ErrCacheMiss
+}
+
+func (x *Cache[T]) encode(v T) ([]byte, error) {
+	data, err := x.opt.Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{valueFlag}, data...), nil
+}
+
+func (x *Cache[T]) decode(data []byte) (T, error) {
+	v := x.newValue()
+	err := x.opt.Codec.Unmarshal(data[1:], &v)
+	return v, err
+}
+
+func (x *Cache[T]) Set(c store.Context, key string, v T) error {
+	data, err := x.encode(v)
+	if err != nil {
+		return err
+	}
+	return x.opt.Backend(c).Set(x.Key(c, key), data, x.opt.Expiration)
+}
+
+// SetNotFound caches absence of the value.
+func (x *Cache[T]) SetNotFound(c store.Context, key string) error {
+	return x.opt.Backend(c).Set(x.Key(c, key), []byte{notFoundFlag}, x.opt.NegativeExpiration)
+}
+
+// Delete drops cached value. Missing value is not an error.
+func (x *Cache[T]) Delete(c store.Context, key string) error {
+	err := x.opt.Backend(c).Delete(x.Key(c, key))
+	if err == store.ErrCacheMiss {
+		return nil
+	}
+	return err
+}
+
+// GetOrLoad returns cached value or calls load and caches its result.
+// Concurrent misses of the same key in the process share one load;
+// each caller still gets its own copy of the value.
+func (x *Cache[T]) GetOrLoad(c store.Context, key string, load func() (T, error)) (T, error) {
+	// Key is built once, so value loaded while namespace is bumped is
+	// stored under the old generation.
+	fullKey := x.Key(c, key)
+	if v, err := x.get(c, fullKey); err != store.ErrCacheMiss {
+		return v, err
+	}
+
+	var loaded T
+	isLeader := false
+	data, err := x.flight.do(fullKey, func() ([]byte, error) {
+		isLeader = true
+
+		var err error
+		loaded, err = load()
+		if err == store.ErrNoSuchEntity && x.opt.NegativeExpiration > 0 {
+			err := x.opt.Backend(c).Set(fullKey, []byte{notFoundFlag}, x.opt.NegativeExpiration)
+			if err != nil {
+				c.Errorf("error setting item: %v", err)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := x.encode(loaded)
+		if err != nil {
+			c.Errorf("error encoding %s: %v", x.namespace, err)
+			return nil, nil
+		}
+		if err := x.opt.Backend(c).Set(fullKey, data, x.opt.Expiration); err != nil {
+			c.Errorf("error setting item: %v", err)
+		}
+		return data, nil
+	})
+	if isLeader {
+		return loaded, err
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	if data == nil {
+		return load()
+	}
+	v, err := x.decode(data)
+	if err != nil {
+		return load()
+	}
+	return v, nil
+}
+
+// ----------------------------------------------------------------------------
+
+type call struct {
+	wg    sync.WaitGroup
+	value []byte
+	err   error
+}
+
+// group runs only one function per key at a time; concurrent callers
+// wait for it and get the same result.
+type group struct {
+	mutex sync.Mutex
+	calls map[string]*call
+}
+
+func (g *group) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if cl, ok := g.calls[key]; ok {
+		g.mutex.Unlock()
+		cl.wg.Wait()
+		return cl.value, cl.err
+	}
+	cl := &call{}
+	cl.wg.Add(1)
+	g.calls[key] = cl
+	g.mutex.Unlock()
+
+	defer func() {
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+		cl.wg.Done()
+	}()
+
+	cl.value, cl.err = fn()
+	return cl.value, cl.err
+}
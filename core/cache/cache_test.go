@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"core/store"
+)
+
+type testItem struct {
+	Name string
+	Tags []string
+}
+
+func newTestContext() store.Context {
+	return store.NewStdContext(nil, NewLRU(100), nil)
+}
+
+func TestCodecs(t *testing.T) {
+	for name, codec := range map[string]Codec{"gob": GOB, "json": JSON} {
+		c := newTestContext()
+		x := New[*testItem]("item", Options{
+			Codec:   codec,
+			Backend: InProcess(NewLRU(10)),
+			New:     func() interface{} { return &testItem{} },
+		})
+
+		if _, err := x.Get(c, "a"); err != store.ErrCacheMiss {
+			t.Errorf("%s: Get returned %v, want ErrCacheMiss", name, err)
+		}
+		want := &testItem{Name: "a", Tags: []string{"x", "y"}}
+		if err := x.Set(c, "a", want); err != nil {
+			t.Fatalf("%s: Set returned %v", name, err)
+		}
+		got, err := x.Get(c, "a")
+		if err != nil || !reflect.DeepEqual(got, want) || got == want {
+			t.Errorf("%s: Get = %+v, %v, want copy of %+v", name, got, err, want)
+		}
+
+		if err := x.Delete(c, "a"); err != nil {
+			t.Errorf("%s: Delete returned %v", name, err)
+		}
+		if err := x.Delete(c, "a"); err != nil {
+			t.Errorf("%s: Delete of missing item returned %v", name, err)
+		}
+		if _, err := x.Get(c, "a"); err != store.ErrCacheMiss {
+			t.Errorf("%s: Get returned %v after Delete, want ErrCacheMiss", name, err)
+		}
+	}
+}
+
+func TestCorruptItem(t *testing.T) {
+	c := newTestContext()
+	lru := NewLRU(10)
+	x := New[testItem]("item", Options{Backend: InProcess(lru)})
+
+	lru.Set(x.Key(c, "a"), []byte{valueFlag, 1, 2, 3}, 0)
+	lru.Set(x.Key(c, "b"), []byte("?"), 0)
+	for _, key := range []string{"a", "b"} {
+		if _, err := x.Get(c, key); err != store.ErrCacheMiss {
+			t.Errorf("Get(%s) returned %v, want ErrCacheMiss", key, err)
+		}
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	c := newTestContext()
+	x := New[[]string]("list", Options{Backend: InProcess(NewLRU(10))})
+
+	var loads int32
+	started := make(chan bool)
+	release := make(chan bool)
+	load := func() ([]string, error) {
+		if atomic.AddInt32(&loads, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return []string{"a", "b"}, nil
+	}
+
+	const N = 10
+	results := make([][]string, N)
+	errs := make([]error, N)
+	var wg sync.WaitGroup
+	run := func(i int) {
+		defer wg.Done()
+		results[i], errs[i] = x.GetOrLoad(c, "k", load)
+	}
+	wg.Add(N)
+	go run(0)
+	<-started
+	for i := 1; i < N; i++ {
+		go run(i)
+	}
+	// let the other callers wait for the first load
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("load is called %d times, want 1", loads)
+	}
+	for i := range results {
+		if errs[i] != nil || !reflect.DeepEqual(results[i], []string{"a", "b"}) {
+			t.Errorf("GetOrLoad #%d = %q, %v", i, results[i], errs[i])
+		}
+	}
+	results[0][0] = "x"
+	if results[1][0] != "a" {
+		t.Errorf("callers share loaded value")
+	}
+
+	v, err := x.GetOrLoad(c, "k", func() ([]string, error) {
+		t.Errorf("load is called for cached value")
+		return nil, nil
+	})
+	if err != nil || !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Errorf("GetOrLoad = %q, %v", v, err)
+	}
+}
+
+func TestGetOrLoadError(t *testing.T) {
+	c := newTestContext()
+	x := New[string]("s", Options{Backend: InProcess(NewLRU(10))})
+
+	errLoad := errors.New("load failed")
+	if _, err := x.GetOrLoad(c, "k", func() (string, error) { return "", errLoad }); err != errLoad {
+		t.Errorf("GetOrLoad returned %v, want %v", err, errLoad)
+	}
+	if _, err := x.Get(c, "k"); err != store.ErrCacheMiss {
+		t.Errorf("error is cached: Get returned %v", err)
+	}
+}
+
+func TestNegativeCaching(t *testing.T) {
+	notFound := func() (string, error) { return "", store.ErrNoSuchEntity }
+
+	c := newTestContext()
+	x := New[string]("s", Options{Backend: InProcess(NewLRU(10))})
+	if _, err := x.GetOrLoad(c, "k", notFound); err != store.ErrNoSuchEntity {
+		t.Errorf("GetOrLoad returned %v, want ErrNoSuchEntity", err)
+	}
+	if _, err := x.Get(c, "k"); err != store.ErrCacheMiss {
+		t.Errorf("absence is cached without NegativeExpiration: Get returned %v", err)
+	}
+
+	x = New[string]("s", Options{
+		Backend:            InProcess(NewLRU(10)),
+		NegativeExpiration: time.Hour,
+	})
+	loads := 0
+	for i := 0; i < 2; i++ {
+		_, err := x.GetOrLoad(c, "k", func() (string, error) {
+			loads++
+			return notFound()
+		})
+		if err != store.ErrNoSuchEntity {
+			t.Errorf("GetOrLoad returned %v, want ErrNoSuchEntity", err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("load is called %d times, want 1", loads)
+	}
+
+	x.SetNotFound(c, "m")
+	if _, err := x.Get(c, "m"); err != store.ErrNoSuchEntity {
+		t.Errorf("Get returned %v after SetNotFound, want ErrNoSuchEntity", err)
+	}
+	x.Set(c, "m", "v")
+	if v, err := x.Get(c, "m"); err != nil || v != "v" {
+		t.Errorf("Get = %q, %v after Set, want v", v, err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	c := newTestContext()
+	ns := NewNamespace("ns")
+	lru := NewLRU(10)
+	x := New[string]("s", Options{Backend: InProcess(lru), Namespace: ns})
+
+	generation := ns.Generation(c)
+	if generation == "" || ns.Generation(c) != generation {
+		t.Fatalf("Generation is not stable: %q", generation)
+	}
+	key := x.Key(c, "k")
+	if want := "ns-" + generation + "-s:k"; key != want {
+		t.Errorf("Key = %q, want %q", key, want)
+	}
+
+	x.Set(c, "k", "v")
+	if _, err := lru.Get(key); err != nil {
+		t.Errorf("item is not stored in the backend: %v", err)
+	}
+	// generation lives in the context cache, not in the backend
+	if _, err := c.Cache().Get("ns-generation"); err != nil {
+		t.Errorf("generation is not stored in the context cache: %v", err)
+	}
+	if _, err := lru.Get("ns-generation"); err != store.ErrCacheMiss {
+		t.Errorf("generation is stored in the backend")
+	}
+
+	if ns.Bump(c) == generation {
+		t.Errorf("Bump returned the same generation")
+	}
+	if x.Key(c, "k") == key {
+		t.Errorf("Key is not changed by Bump")
+	}
+	if _, err := x.Get(c, "k"); err != store.ErrCacheMiss {
+		t.Errorf("Get returned %v after Bump, want ErrCacheMiss", err)
+	}
+}
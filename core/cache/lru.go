@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"core/store"
+)
+
+type lruItem struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// LRU is in-process store.Cache that holds at most size items and
+// evicts least recently used ones first.
+type LRU struct {
+	mutex sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (l *LRU) Get(key string) ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e, ok := l.items[key]
+	if !ok {
+		return nil, store.ErrCacheMiss
+	}
+	it := e.Value.(*lruItem)
+	if !it.expires.IsZero() && time.Now().After(it.expires) {
+		l.remove(e)
+		return nil, store.ErrCacheMiss
+	}
+	l.ll.MoveToFront(e)
+	return append([]byte(nil), it.value...), nil
+}
+
+func (l *LRU) Set(key string, value []byte, expiration time.Duration) error {
+	it := &lruItem{key: key, value: append([]byte(nil), value...)}
+	if expiration > 0 {
+		it.expires = time.Now().Add(expiration)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, ok := l.items[key]; ok {
+		e.Value = it
+		l.ll.MoveToFront(e)
+		return nil
+	}
+	l.items[key] = l.ll.PushFront(it)
+	for l.ll.Len() > l.size {
+		l.remove(l.ll.Back())
+	}
+	return nil
+}
+
+func (l *LRU) Delete(key string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, ok := l.items[key]; ok {
+		l.remove(e)
+	}
+	return nil
+}
+
+// Len returns number of items in the cache including expired ones.
+func (l *LRU) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.ll.Len()
+}
+
+func (l *LRU) remove(e *list.Element) {
+	l.ll.Remove(e)
+	delete(l.items, e.Value.(*lruItem).key)
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"core/store"
+)
+
+func TestLRU(t *testing.T) {
+	l := NewLRU(2)
+	l.Set("a", []byte("1"), 0)
+	l.Set("b", []byte("2"), 0)
+	if _, err := l.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	// b is least recently used now
+	l.Set("c", []byte("3"), 0)
+
+	if _, err := l.Get("b"); err != store.ErrCacheMiss {
+		t.Errorf("Get(b) returned %v, want ErrCacheMiss", err)
+	}
+	for key, want := range map[string]string{"a": "1", "c": "3"} {
+		if value, err := l.Get(key); err != nil || string(value) != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, value, err, want)
+		}
+	}
+	if n := l.Len(); n != 2 {
+		t.Errorf("Len() = %d, want 2", n)
+	}
+
+	l.Set("a", []byte("4"), 0)
+	if value, _ := l.Get("a"); string(value) != "4" {
+		t.Errorf("Get(a) = %q after update, want 4", value)
+	}
+	l.Delete("a")
+	l.Delete("x")
+	if _, err := l.Get("a"); err != store.ErrCacheMiss {
+		t.Errorf("Get(a) returned %v after Delete, want ErrCacheMiss", err)
+	}
+}
+
+func TestLRUCopies(t *testing.T) {
+	l := NewLRU(1)
+	value := []byte("abc")
+	l.Set("a", value, 0)
+	value[0] = 'x'
+
+	got, _ := l.Get("a")
+	got[1] = 'x'
+	if got, _ := l.Get("a"); string(got) != "abc" {
+		t.Errorf("Get(a) = %q, want abc", got)
+	}
+}
+
+func TestLRUExpiration(t *testing.T) {
+	l := NewLRU(2)
+	l.Set("a", []byte("1"), time.Millisecond)
+	l.Set("b", []byte("2"), time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := l.Get("a"); err != store.ErrCacheMiss {
+		t.Errorf("Get(a) returned %v, want ErrCacheMiss", err)
+	}
+	if l.Len() != 1 {
+		t.Errorf("expired item is not removed")
+	}
+	if _, err := l.Get("b"); err != nil {
+		t.Errorf("Get(b) returned %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"strconv"
+	"time"
+
+	"core/store"
+)
+
+// Namespace is versioned group of cache keys. Bump starts new generation,
+// so keys of the previous ones become unreachable and just expire. It is
+// used for data that depends on many entities, e.g. listings and feeds.
+//
+// Generation is always kept in the cache of the store context, not in the
+// backend of caches using the namespace. It is shared by all instances,
+// so Bump also invalidates InProcess caches of other instances.
+type Namespace struct {
+	name string
+}
+
+func NewNamespace(name string) *Namespace {
+	return &Namespace{name: name}
+}
+
+func (n *Namespace) generationKey() string {
+	return n.name + "-generation"
+}
+
+// Generation returns current generation of the namespace.
+func (n *Namespace) Generation(c store.Context) string {
+	if value, err := c.Cache().Get(n.generationKey()); err == nil {
+		return string(value)
+	}
+	return n.Bump(c)
+}
+
+// Bump starts new generation of the namespace and returns it.
+func (n *Namespace) Bump(c store.Context) string {
+	generation := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := c.Cache().Set(n.generationKey(), []byte(generation), 0); err != nil {
+		c.Errorf("error setting item: %v", err)
+	}
+	return generation
+}
+
+// Key returns key prefixed with current generation of the namespace.
+func (n *Namespace) Key(c store.Context, key string) string {
+	return n.name + "-" + n.Generation(c) + "-" + key
+}
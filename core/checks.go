@@ -1,14 +1,16 @@
 package core
 
 import (
+	"errors"
 	"net/http"
 
-	"appengine"
-
 	"auth"
+	"core/store"
 )
 
-func AuthUser(c appengine.Context, w http.ResponseWriter) *auth.User {
+var ErrPermissionDenied = errors.New("You don't have permission to do this.")
+
+func AuthUser(c store.Context, w http.ResponseWriter) *auth.User {
 	user := auth.CurrentUser(c)
 
 	if !user.IsAuth() {
@@ -19,14 +21,31 @@ func AuthUser(c appengine.Context, w http.ResponseWriter) *auth.User {
 	return user
 }
 
-func AdminUser(c appengine.Context, w http.ResponseWriter) *auth.User {
+func AdminUser(c store.Context, w http.ResponseWriter) *auth.User {
 	user := AuthUser(c, w)
 	if user == nil {
 		return nil
 	}
 
 	if !user.IsAdmin {
-		HandleAuthRequired(c, w)
+		HandleForbidden(c, w, ErrPermissionDenied)
+		return nil
+	}
+
+	return user
+}
+
+// RequirePermission returns current user if it has the permission on
+// object owned by owner (nil for objects without owner). Otherwise it
+// responds with 401 or 403 page and returns nil.
+func RequirePermission(c store.Context, w http.ResponseWriter, perm string, owner *store.Key) *auth.User {
+	user := AuthUser(c, w)
+	if user == nil {
+		return nil
+	}
+
+	if !user.CanOwn(perm, owner) {
+		HandleForbidden(c, w, ErrPermissionDenied)
 		return nil
 	}
 
@@ -3,15 +3,15 @@ package core
 import (
 	"bytes"
 	"html/template"
-	"io"
 	"net/http"
 	"path"
+	"path/filepath"
 	"strings"
 
-	"appengine"
 	"code.google.com/p/gorilla/mux"
 
 	"auth"
+	"core/store"
 	"tmplt"
 )
 
@@ -21,17 +21,29 @@ const (
 
 var (
 	Router = &mux.Router{}
+
+	// TemplateDir is the directory templates are loaded from. Template
+	// names are relative to the application root, e.g. "templates/layout.html".
+	TemplateDir = "templates"
 )
 
 func init() {
 	Router.NotFoundHandler = http.HandlerFunc(NotFoundHandler)
 	Router.HandleFunc("/500.html", InternalErrorHandler).Name("internalError")
-	Router.HandleFunc("/profile/", TemplateHandler("templates/profile.html", "templates/layout.html")).Name("profile")
+}
+
+// Handler returns the handler that serves all registered routes.
+func Handler() http.Handler {
+	return NewProfilingHandler(auth.NewTokenHandler(NewCSRFHandler(Router)))
+}
 
-	http.Handle("/", NewProfilingHandler(Router))
+func templatePath(name string) string {
+	return filepath.Join(TemplateDir, filepath.FromSlash(strings.TrimPrefix(name, "templates/")))
 }
 
-func RenderTemplate(c appengine.Context, w http.ResponseWriter, context tmplt.Context, templateNames ...string) {
+// ExecuteTemplate renders templates with the context and returns
+// the output.
+func ExecuteTemplate(c store.Context, context tmplt.Context, templateNames ...string) ([]byte, error) {
 	if len(templateNames) == 0 {
 		panic("expected at least 1 template, but got 0")
 	}
@@ -41,7 +53,11 @@ func RenderTemplate(c appengine.Context, w http.ResponseWriter, context tmplt.Co
 
 		newT := template.New(path.Base(templateNames[len(templateNames)-1]))
 		newT = AddTemplateFuncs(newT)
-		newT, err = newT.ParseFiles(templateNames...)
+		paths := make([]string, len(templateNames))
+		for i, name := range templateNames {
+			paths[i] = templatePath(name)
+		}
+		newT, err = newT.ParseFiles(paths...)
 		if err != nil {
 			return nil, err
 		}
@@ -50,27 +66,32 @@ func RenderTemplate(c appengine.Context, w http.ResponseWriter, context tmplt.Co
 
 	t, err := tmplt.Holder.Get(strings.Join(templateNames, ","), newFunc)
 	if err != nil {
-		HandleError(c, w, err)
-		return
+		return nil, err
 	}
 
 	if context == nil {
 		context = tmplt.Context{}
 	}
 
-	context["appengineContext"] = c
+	context["requestContext"] = c
 	context["user"] = auth.CurrentUser(c)
 
-	if w.Header().Get("content-type") == "" {
-		w.Header().Add("content-type", "text/html")
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, context); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	buf := &bytes.Buffer{}
-	err = t.Execute(buf, context)
+func RenderTemplate(c store.Context, w http.ResponseWriter, context tmplt.Context, templateNames ...string) {
+	b, err := ExecuteTemplate(c, context, templateNames...)
 	if err != nil {
 		HandleError(c, w, err)
 		return
 	}
 
-	io.Copy(w, buf)
+	if w.Header().Get("content-type") == "" {
+		w.Header().Add("content-type", "text/html")
+	}
+	w.Write(b)
 }
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"code.google.com/p/gorilla/context"
+
+	"auth"
+	"core/store"
+	"tmplt"
+)
+
+const (
+	CSRF_COOKIE = "csrf"
+	CSRF_FIELD  = "csrf_token"
+	CSRF_HEADER = "X-CSRF-Token"
+
+	CSRF_TOKEN_SIZE = 32
+
+	// Token is looked up in the first CSRF_PEEK_SIZE bytes of multipart
+	// body, so csrfField must come first in multipart forms.
+	CSRF_PEEK_SIZE = 64 << 10
+)
+
+var (
+	ErrCSRFToken     = errors.New("Form has expired or was submitted from another site. Please go back, reload the page and try again.")
+	ErrCSRFMultipart = errors.New("Form token was not found at the start of the upload. The token field must come before files in the form.")
+)
+
+type csrfKey int
+
+const csrfTokenKey csrfKey = 0
+
+// csrfCookie binds the token to the session cookie, so the token is
+// rotated when user logs in or out.
+type csrfCookie struct {
+	Token   string
+	Session string
+}
+
+// sessionHash identifies the session cookie of the request; it is empty
+// when there is no session.
+func sessionHash(r *http.Request) string {
+	cookie, err := r.Cookie(auth.SESSION_COOKIE)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(cookie.Value))
+	return hex.EncodeToString(sum[:])
+}
+
+// CSRFHandler rejects unsafe requests without token of the session.
+// Requests authenticated by API token are not checked, because browsers
+// don't send Authorization header across sites.
+type CSRFHandler struct {
+	handler http.Handler
+}
+
+func NewCSRFHandler(handler http.Handler) *CSRFHandler {
+	return &CSRFHandler{handler}
+}
+
+func (h *CSRFHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := store.NewContext(r)
+
+	session := sessionHash(r)
+	cookie := &csrfCookie{}
+	err := auth.GetSignedCookie(c, CSRF_COOKIE, cookie)
+	if err != nil || cookie.Token == "" || cookie.Session != session {
+		token, err := auth.RandomString(CSRF_TOKEN_SIZE)
+		if err != nil {
+			HandleError(c, w, err)
+			return
+		}
+		cookie = &csrfCookie{Token: token, Session: session}
+		if err := auth.SetSignedCookie(c, w, CSRF_COOKIE, cookie, auth.SESSION_MAX_AGE); err != nil {
+			HandleError(c, w, err)
+			return
+		}
+	}
+	token := cookie.Token
+
+	if !isSafeMethod(r.Method) && auth.RequestAPIToken(r) == nil {
+		got, err := requestCSRFToken(r)
+		if err == ErrCSRFMultipart {
+			HandleForbidden(c, w, err)
+			return
+		} else if err != nil {
+			HandleError(c, w, err)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			HandleForbidden(c, w, ErrCSRFToken)
+			return
+		}
+	}
+
+	context.Set(r, csrfTokenKey, token)
+	defer context.Clear(r)
+
+	h.handler.ServeHTTP(w, r)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// requestCSRFToken returns token sent in header or form field. Multipart
+// body is peeked at and restored, so handlers can still read it; if the
+// field is not in the peeked part, ErrCSRFMultipart is returned.
+func requestCSRFToken(r *http.Request) (string, error) {
+	if token := r.Header.Get(CSRF_HEADER); token != "" {
+		return token, nil
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.PostFormValue(CSRF_FIELD), nil
+	}
+
+	peek, err := ioutil.ReadAll(io.LimitReader(r.Body, CSRF_PEEK_SIZE))
+	if err != nil {
+		return "", err
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peek), r.Body), r.Body}
+
+	mr := multipart.NewReader(bytes.NewReader(peek), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if len(peek) == CSRF_PEEK_SIZE && err != io.EOF {
+				return "", ErrCSRFMultipart
+			}
+			return "", nil
+		}
+		if part.FormName() == CSRF_FIELD {
+			// partial token just doesn't match
+			token, _ := ioutil.ReadAll(io.LimitReader(part, 2*CSRF_TOKEN_SIZE+1))
+			return string(token), nil
+		}
+	}
+}
+
+// CSRFToken returns token of the request session.
+func CSRFToken(r *http.Request) string {
+	token, _ := context.Get(r, csrfTokenKey).(string)
+	return token
+}
+
+func csrfToken(context tmplt.Context) string {
+	return CSRFToken(context["requestContext"].(store.Context).Request())
+}
+
+// csrfField returns hidden input with CSRF token to put in POST forms.
+func csrfField(context tmplt.Context) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + CSRF_FIELD + `" value="` +
+		template.HTMLEscapeString(csrfToken(context)) + `">`)
+}
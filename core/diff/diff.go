@@ -0,0 +1,261 @@
+// Package diff implements line based diff of two texts.
+package diff
+
+import (
+	"strconv"
+	"strings"
+)
+
+type Kind int
+
+const (
+	EQUAL Kind = iota
+	DELETE
+	INSERT
+)
+
+func (k Kind) String() string {
+	switch k {
+	case DELETE:
+		return "delete"
+	case INSERT:
+		return "insert"
+	}
+	return "equal"
+}
+
+// Line is a line of the diff. OldNum and NewNum are 1-based line numbers
+// in the old and new texts, 0 if the line is missing there.
+type Line struct {
+	Kind   Kind
+	Text   string
+	OldNum int
+	NewNum int
+}
+
+func (l *Line) Prefix() string {
+	switch l.Kind {
+	case DELETE:
+		return "-"
+	case INSERT:
+		return "+"
+	}
+	return " "
+}
+
+func splitLines(s string) []string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Lines returns diff of the old and new texts.
+func Lines(oldText, newText string) []*Line {
+	a, b := splitLines(oldText), splitLines(newText)
+
+	// Common prefix and suffix don't need LCS table.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]*Line, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, &Line{EQUAL, a[i], i + 1, i + 1})
+	}
+	lines = append(lines, middle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+	for i := suffix; i > 0; i-- {
+		oi, ni := len(a)-i, len(b)-i
+		lines = append(lines, &Line{EQUAL, a[oi], oi + 1, ni + 1})
+	}
+	return lines
+}
+
+// middle diffs a and b using Hirschberg's algorithm, which finds
+// longest common subsequence in linear space: a is split in half and b
+// where LCS lengths of both halves add up to the maximum.
+func middle(a, b []string, oldOffset, newOffset int) []*Line {
+	return hirschberg(make([]*Line, 0, len(a)+len(b)), a, b, oldOffset, newOffset)
+}
+
+func hirschberg(lines []*Line, a, b []string, oldOffset, newOffset int) []*Line {
+	switch {
+	case len(a) == 0:
+		for j, s := range b {
+			lines = append(lines, &Line{INSERT, s, 0, newOffset + j + 1})
+		}
+		return lines
+	case len(b) == 0:
+		for i, s := range a {
+			lines = append(lines, &Line{DELETE, s, oldOffset + i + 1, 0})
+		}
+		return lines
+	case len(a) == 1:
+		j := 0
+		for j < len(b) && b[j] != a[0] {
+			j++
+		}
+		if j == len(b) {
+			lines = hirschberg(lines, a, nil, oldOffset, newOffset)
+			return hirschberg(lines, nil, b, oldOffset+1, newOffset)
+		}
+		lines = hirschberg(lines, nil, b[:j], oldOffset, newOffset)
+		lines = append(lines, &Line{EQUAL, a[0], oldOffset + 1, newOffset + j + 1})
+		return hirschberg(lines, nil, b[j+1:], oldOffset+1, newOffset+j+1)
+	}
+
+	mid := len(a) / 2
+	head := lcsLengths(a[:mid], b)
+	tail := lcsLengthsReverse(a[mid:], b)
+	best, split := -1, 0
+	for j := range head {
+		if n := head[j] + tail[j]; n > best {
+			best, split = n, j
+		}
+	}
+	lines = hirschberg(lines, a[:mid], b[:split], oldOffset, newOffset)
+	return hirschberg(lines, a[mid:], b[split:], oldOffset+mid, newOffset+split)
+}
+
+// lcsLengths returns LCS lengths of a and every prefix of b, i.e.
+// element j is length of LCS of a and b[:j].
+func lcsLengths(a, b []string) []int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// lcsLengthsReverse returns LCS lengths of a and every suffix of b, i.e.
+// element j is length of LCS of a and b[j:].
+func lcsLengthsReverse(a, b []string) []int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				cur[j] = prev[j+1] + 1
+			} else {
+				cur[j] = max(prev[j], cur[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []*Line
+}
+
+// Header returns unified diff hunk header, e.g. "@@ -1,3 +1,4 @@".
+func (h *Hunk) Header() string {
+	return "@@ -" + hunkRange(h.OldStart, h.OldLines) + " +" + hunkRange(h.NewStart, h.NewLines) + " @@"
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return strconv.Itoa(start)
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(lines)
+}
+
+// Unified groups changed lines into hunks with context lines around them.
+func Unified(lines []*Line, context int) []*Hunk {
+	include := make([]bool, len(lines))
+	for i, line := range lines {
+		if line.Kind == EQUAL {
+			continue
+		}
+		for j := i - context; j <= i+context; j++ {
+			if j >= 0 && j < len(lines) {
+				include[j] = true
+			}
+		}
+	}
+
+	hunks := make([]*Hunk, 0)
+	var hunk *Hunk
+	for i, line := range lines {
+		if !include[i] {
+			hunk = nil
+			continue
+		}
+		if hunk == nil {
+			hunk = &Hunk{}
+			hunks = append(hunks, hunk)
+		}
+		hunk.add(line)
+	}
+	return hunks
+}
+
+func (h *Hunk) add(line *Line) {
+	if line.OldNum > 0 && h.OldStart == 0 {
+		h.OldStart = line.OldNum
+	}
+	if line.NewNum > 0 && h.NewStart == 0 {
+		h.NewStart = line.NewNum
+	}
+	if line.Kind != INSERT {
+		h.OldLines++
+	}
+	if line.Kind != DELETE {
+		h.NewLines++
+	}
+	h.Lines = append(h.Lines, line)
+}
+
+// Row is a row of side-by-side diff. Left or Right is nil when the line
+// has no counterpart.
+type Row struct {
+	Left, Right *Line
+}
+
+// SideBySide pairs deleted lines with inserted lines of the same change.
+func SideBySide(lines []*Line) []*Row {
+	rows := make([]*Row, 0, len(lines))
+	deletes, inserts := make([]*Line, 0), make([]*Line, 0)
+	flush := func() {
+		for i := 0; i < len(deletes) || i < len(inserts); i++ {
+			row := &Row{}
+			if i < len(deletes) {
+				row.Left = deletes[i]
+			}
+			if i < len(inserts) {
+				row.Right = inserts[i]
+			}
+			rows = append(rows, row)
+		}
+		deletes, inserts = deletes[:0], inserts[:0]
+	}
+	for _, line := range lines {
+		switch line.Kind {
+		case DELETE:
+			deletes = append(deletes, line)
+		case INSERT:
+			inserts = append(inserts, line)
+		default:
+			flush()
+			rows = append(rows, &Row{line, line})
+		}
+	}
+	flush()
+	return rows
+}
@@ -0,0 +1,194 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// format returns lines in unified diff notation with line numbers,
+// e.g. "-2 3 a" is line 2 of the old text deleted before line 3 of the new.
+func format(lines []*Line) string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = line.Prefix() + strconv.Itoa(line.OldNum) + " " + strconv.Itoa(line.NewNum) + " " + line.Text
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     string
+	}{
+		{"", "", ""},
+		{"a\nb\n", "a\nb\n", " 1 1 a\n 2 2 b"},
+		{"a\r\nb\r\n", "a\nb", " 1 1 a\n 2 2 b"},
+		{"", "a\nb\n", "+0 1 a\n+0 2 b"},
+		{"a\nb\n", "", "-1 0 a\n-2 0 b"},
+		{"a\nb\nc\n", "a\nx\nc\n", " 1 1 a\n-2 0 b\n+0 2 x\n 3 3 c"},
+		{"a\nb\nc\n", "a\nc\n", " 1 1 a\n-2 0 b\n 3 2 c"},
+		{"a\nc\n", "a\nb\nc\n", " 1 1 a\n+0 2 b\n 2 3 c"},
+		{"a\nb\nc\nd\n", "b\nd\ne\n", "-1 0 a\n 2 1 b\n-3 0 c\n 4 2 d\n+0 3 e"},
+		{"x\na\nb\ny\n", "z\nb\na\nw\n", "-1 0 x\n-2 0 a\n+0 1 z\n 3 2 b\n-4 0 y\n+0 3 a\n+0 4 w"},
+	}
+	for _, test := range tests {
+		got := format(Lines(test.old, test.new))
+		if got != test.want {
+			t.Errorf("Lines(%q, %q) =\n%s\nwant\n%s", test.old, test.new, got, test.want)
+		}
+	}
+}
+
+// check verifies that lines turn a into b with the given number of
+// equal lines.
+func check(t *testing.T, a, b []string, lines []*Line, equal int) {
+	var old, new []string
+	n := 0
+	for _, line := range lines {
+		if line.Kind != INSERT {
+			if line.OldNum != len(old)+1 {
+				t.Fatalf("line %q has OldNum %d, want %d", line.Text, line.OldNum, len(old)+1)
+			}
+			old = append(old, line.Text)
+		}
+		if line.Kind != DELETE {
+			if line.NewNum != len(new)+1 {
+				t.Fatalf("line %q has NewNum %d, want %d", line.Text, line.NewNum, len(new)+1)
+			}
+			new = append(new, line.Text)
+		}
+		if line.Kind == EQUAL {
+			n++
+		}
+	}
+	if strings.Join(old, "\n") != strings.Join(a, "\n") {
+		t.Fatalf("old text is not restored from the diff")
+	}
+	if strings.Join(new, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("new text is not restored from the diff")
+	}
+	if n != equal {
+		t.Fatalf("diff has %d equal lines, want %d", n, equal)
+	}
+}
+
+func TestLinesLarge(t *testing.T) {
+	// every third line of the old text is replaced and every fifth
+	// line is deleted
+	var a, b []string
+	equal := 0
+	for i := 0; i < 5000; i++ {
+		line := "line " + strconv.Itoa(i)
+		a = append(a, line)
+		switch {
+		case i%5 == 0:
+		case i%3 == 0:
+			b = append(b, "changed "+strconv.Itoa(i))
+		default:
+			b = append(b, line)
+			equal++
+		}
+	}
+	lines := Lines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	check(t, a, b, lines, equal)
+}
+
+func TestLinesLCS(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal int
+	}{
+		{"abcbdab", "bdcaba", 4},
+		{"abcdefg", "gfedcba", 1},
+		{"aaaa", "aa", 2},
+		{"abab", "baba", 3},
+		{"xyz", "abc", 0},
+	}
+	for _, test := range tests {
+		a, b := strings.Split(test.a, ""), strings.Split(test.b, "")
+		lines := Lines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+		check(t, a, b, lines, test.equal)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	var a, b []string
+	for i := 1; i <= 20; i++ {
+		a = append(a, strconv.Itoa(i))
+		switch i {
+		case 2:
+			b = append(b, "two")
+		case 15:
+		default:
+			b = append(b, strconv.Itoa(i))
+		}
+	}
+	b = append(b, "21")
+
+	hunks := Unified(Lines(strings.Join(a, "\n"), strings.Join(b, "\n")), 2)
+	want := []struct {
+		header string
+		lines  string
+	}{
+		{"@@ -1,4 +1,4 @@", " 1 1 1\n-2 0 2\n+0 2 two\n 3 3 3\n 4 4 4"},
+		{"@@ -13,5 +13,4 @@", " 13 13 13\n 14 14 14\n-15 0 15\n 16 15 16\n 17 16 17"},
+		{"@@ -19,2 +18,3 @@", " 19 18 19\n 20 19 20\n+0 20 21"},
+	}
+	if len(hunks) != len(want) {
+		t.Fatalf("Unified returned %d hunks, want %d", len(hunks), len(want))
+	}
+	for i, hunk := range hunks {
+		if got := hunk.Header(); got != want[i].header {
+			t.Errorf("hunk %d header is %q, want %q", i, got, want[i].header)
+		}
+		if got := format(hunk.Lines); got != want[i].lines {
+			t.Errorf("hunk %d lines are\n%s\nwant\n%s", i, got, want[i].lines)
+		}
+	}
+
+	if hunks := Unified(Lines("a\nb\n", "a\nb\n"), 3); len(hunks) != 0 {
+		t.Errorf("Unified of equal texts returned %d hunks, want 0", len(hunks))
+	}
+}
+
+func TestHunkHeader(t *testing.T) {
+	tests := []struct {
+		hunk *Hunk
+		want string
+	}{
+		{&Hunk{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1}, "@@ -1 +1 @@"},
+		{&Hunk{OldStart: 3, OldLines: 2, NewStart: 4, NewLines: 0}, "@@ -3,2 +4,0 @@"},
+	}
+	for _, test := range tests {
+		if got := test.hunk.Header(); got != test.want {
+			t.Errorf("Header() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	rows := SideBySide(Lines("a\nb\nc\nd\n", "a\nx\ny\nd\n"))
+	want := []string{"a|a", "b|x", "c|y", "d|d"}
+	if len(rows) != len(want) {
+		t.Fatalf("SideBySide returned %d rows, want %d", len(rows), len(want))
+	}
+	for i, row := range rows {
+		got := ""
+		if row.Left != nil {
+			got += row.Left.Text
+		}
+		got += "|"
+		if row.Right != nil {
+			got += row.Right.Text
+		}
+		if got != want[i] {
+			t.Errorf("row %d is %q, want %q", i, got, want[i])
+		}
+	}
+
+	rows = SideBySide(Lines("a\nb\n", "a\n"))
+	if len(rows) != 2 || rows[1].Left == nil || rows[1].Right != nil {
+		t.Errorf("deleted line is not paired with empty right side")
+	}
+}
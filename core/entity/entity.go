@@ -1,19 +1,18 @@
 package entity
 
 import (
-	"appengine"
-	"appengine/datastore"
+	"core/store"
 )
 
 type Putable interface {
 	Kind() string
-	SetKey(*datastore.Key)
-	Key() *datastore.Key
+	SetKey(*store.Key)
+	Key() *store.Key
 }
 
 type Entity struct {
 	// key is public to simplify gob encoding
-	DsKey *datastore.Key
+	DsKey *store.Key
 	kind  string
 }
 
@@ -21,14 +20,14 @@ func NewEntity(kind string) *Entity {
 	return &Entity{kind: kind}
 }
 
-func (e *Entity) SetKey(key *datastore.Key) {
+func (e *Entity) SetKey(key *store.Key) {
 	if e.DsKey != nil {
 		panic("Entity already has a key.")
 	}
 	e.DsKey = key
 }
 
-func (e *Entity) Key() *datastore.Key {
+func (e *Entity) Key() *store.Key {
 	return e.DsKey
 }
 
@@ -39,13 +38,13 @@ func (e *Entity) Kind() string {
 	return e.kind
 }
 
-func Put(c appengine.Context, entity Putable) error {
+func Put(c store.Context, entity Putable) error {
 	key := entity.Key()
 	if key == nil {
-		key = datastore.NewIncompleteKey(c, entity.Kind(), nil)
+		key = store.NewIncompleteKey(entity.Kind(), nil)
 	}
 
-	key, err := datastore.Put(c, key, entity)
+	key, err := store.Put(c, key, entity)
 	if err != nil {
 		return err
 	}
@@ -54,5 +53,33 @@ func Put(c appengine.Context, entity Putable) error {
 		entity.SetKey(key)
 	}
 
+	Changed(c, key)
 	return nil
 }
+
+func Delete(c store.Context, key *store.Key) error {
+	if err := store.Delete(c, key); err != nil {
+		return err
+	}
+	Changed(c, key)
+	return nil
+}
+
+// Hook is called after entity with the key is saved or deleted.
+type Hook func(c store.Context, key *store.Key)
+
+var hooks = make(map[string][]Hook)
+
+// AddHook registers hook for entities of the kind. Hooks are meant to be
+// added during initialization, i.e. they are not guarded by a mutex.
+func AddHook(kind string, hook Hook) {
+	hooks[kind] = append(hooks[kind], hook)
+}
+
+// Changed runs hooks of the entity. Put and Delete call it, so it is only
+// needed when entity is written with store functions directly.
+func Changed(c store.Context, key *store.Key) {
+	for _, hook := range hooks[key.Kind()] {
+		hook(c, key)
+	}
+}
@@ -0,0 +1,208 @@
+package entity
+
+import (
+	"errors"
+	"time"
+
+	"core/cache"
+	"core/page"
+	"core/pager"
+	"core/store"
+)
+
+var ErrNotUnique = errors.New("Got multiple results for unique field.")
+
+// Repository loads and saves entities of one kind. Entities got by key
+// are cached for cacheExpiration; zero expiration disables caching.
+// Cached entities are dropped by hooks whenever they are put or deleted.
+type Repository[T Putable] struct {
+	kind      string
+	newEntity func() T
+	cache     *cache.Cache[T]
+}
+
+func NewRepository[T Putable](kind string, newEntity func() T, cacheExpiration time.Duration) *Repository[T] {
+	r := &Repository[T]{
+		kind:      kind,
+		newEntity: newEntity,
+	}
+	if cacheExpiration != 0 {
+		r.cache = cache.New[T]("entity-"+kind, cache.Options{
+			New:                func() interface{} { return newEntity() },
+			Expiration:         cacheExpiration,
+			NegativeExpiration: cacheExpiration,
+		})
+		AddHook(kind, r.uncache)
+	}
+	return r
+}
+
+func (r *Repository[T]) Kind() string {
+	return r.kind
+}
+
+func (r *Repository[T]) New() T {
+	return r.newEntity()
+}
+
+func (r *Repository[T]) NewKey(id int64, parent *store.Key) *store.Key {
+	return store.NewKey(r.kind, "", id, parent)
+}
+
+func (r *Repository[T]) Query() *store.Query {
+	return store.NewQuery(r.kind)
+}
+
+func (r *Repository[T]) uncache(c store.Context, key *store.Key) {
+	if err := r.cache.Delete(c, key.Encode()); err != nil {
+		c.Errorf("error deleting item: %v", err)
+	}
+}
+
+func (r *Repository[T]) get(c store.Context, key *store.Key) (T, error) {
+	e := r.newEntity()
+	if err := store.Get(c, key, e); err != nil {
+		var zero T
+		return zero, err
+	}
+	e.SetKey(key)
+	return e, nil
+}
+
+// Get returns entity with the given key, from cache if possible.
+func (r *Repository[T]) Get(c store.Context, key *store.Key) (T, error) {
+	if r.cache == nil {
+		return r.get(c, key)
+	}
+	return r.cache.GetOrLoad(c, key.Encode(), func() (T, error) {
+		return r.get(c, key)
+	})
+}
+
+// Load returns entity with the given key from the store and refreshes
+// its cached copy.
+func (r *Repository[T]) Load(c store.Context, key *store.Key) (T, error) {
+	e, err := r.get(c, key)
+	if err != nil {
+		return e, err
+	}
+	if r.cache != nil {
+		if err := r.cache.Set(c, key.Encode(), e); err != nil {
+			c.Errorf("error setting item: %v", err)
+		}
+	}
+	return e, nil
+}
+
+// GetMulti returns entities with the given keys in the same order.
+// Entities that don't exist are returned as zero values.
+func (r *Repository[T]) GetMulti(c store.Context, keys []*store.Key) ([]T, error) {
+	entities := make([]T, len(keys))
+	loaded := make(map[string]T)
+	for i, key := range keys {
+		id := key.Encode()
+		e, ok := loaded[id]
+		if !ok {
+			var err error
+			e, err = r.Get(c, key)
+			if err != nil && err != store.ErrNoSuchEntity {
+				return nil, err
+			}
+			loaded[id] = e
+		}
+		entities[i] = e
+	}
+	return entities, nil
+}
+
+// Put saves the entity, assigning new key to the entity without one.
+func (r *Repository[T]) Put(c store.Context, e T) error {
+	return Put(c, e)
+}
+
+func (r *Repository[T]) Delete(c store.Context, key *store.Key) error {
+	return Delete(c, key)
+}
+
+// GetAll returns all entities matched by the query.
+func (r *Repository[T]) GetAll(c store.Context, q *store.Query) ([]T, error) {
+	entities := make([]T, 0)
+	t := q.Run(c)
+	for {
+		e := r.newEntity()
+		key, err := t.Next(e)
+		if err == store.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.SetKey(key)
+		entities = append(entities, e)
+	}
+	return entities, nil
+}
+
+// GetUnique returns the only entity matched by the query. It returns
+// store.ErrNoSuchEntity if there is none and ErrNotUnique if there
+// are several.
+func (r *Repository[T]) GetUnique(c store.Context, q *store.Query) (T, error) {
+	var zero T
+	entities, err := r.GetAll(c, q.Limit(2))
+	if err != nil {
+		return zero, err
+	}
+	switch len(entities) {
+	case 0:
+		return zero, store.ErrNoSuchEntity
+	case 1:
+		return entities[0], nil
+	}
+	return zero, ErrNotUnique
+}
+
+// GetPage returns up to limit entities matched by the query together
+// with cursor of the next page.
+func (r *Repository[T]) GetPage(c store.Context, q *store.Query, limit int) ([]T, *page.Page, error) {
+	entities := make([]T, 0, limit)
+	p := &page.Page{More: true}
+
+	t := q.Limit(limit + 1).Run(c)
+	for len(entities) < limit {
+		e := r.newEntity()
+		key, err := t.Next(e)
+		if err == store.Done {
+			p.More = false
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		e.SetKey(key)
+		entities = append(entities, e)
+		p.Keys = append(p.Keys, key)
+	}
+
+	if p.More {
+		cursor, err := t.Cursor()
+		if err != nil {
+			return nil, nil, err
+		}
+		p.Start = cursor
+		if _, err := t.Next(r.newEntity()); err == store.Done {
+			p.More = false
+		}
+	}
+
+	return entities, p, nil
+}
+
+// GetPager returns current page of the pager and updates the pager.
+func (r *Repository[T]) GetPager(c store.Context, p *pager.Pager) ([]T, error) {
+	entities, page, err := r.GetPage(c, p.Query(), p.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	p.Update(page.Start, page.More)
+	return entities, nil
+}
@@ -6,23 +6,23 @@ import (
 	"net/http"
 	"time"
 
-	"appengine"
+	"core/store"
 )
 
 func TemplateHandler(templateNames ...string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		c := appengine.NewContext(r)
+		c := store.NewContext(r)
 		RenderTemplate(c, w, nil, templateNames...)
 	}
 }
 
 func InternalErrorHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+	c := store.NewContext(r)
 	HandleError(c, w, errors.New("empty"))
 }
 
 func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+	c := store.NewContext(r)
 	w.WriteHeader(http.StatusNotFound)
 	RenderTemplate(c, w, nil, "templates/404.html", LAYOUT)
 }
@@ -5,42 +5,56 @@ import (
 	"html/template"
 	"net/http"
 
-	"appengine"
-
+	"core/store"
 	"tmplt"
 )
 
-var ErrLayout *template.Template
+const (
+	ERR_LAYOUT = "templates/500.html"
+)
 
-func init() {
-	var err error
-	ErrLayout, err = template.ParseFiles("templates/500.html")
-	if err != nil {
-		panic(err)
-	}
+func errLayout() (*template.Template, error) {
+	return tmplt.Holder.Get(ERR_LAYOUT, func() (*template.Template, error) {
+		return template.ParseFiles(templatePath(ERR_LAYOUT))
+	})
 }
 
-func HandleNotFound(c appengine.Context, w http.ResponseWriter) {
+func HandleNotFound(c store.Context, w http.ResponseWriter) {
 	w.WriteHeader(http.StatusNotFound)
 	RenderTemplate(c, w, nil, LAYOUT, "templates/404.html")
 }
 
-func HandleError(c appengine.Context, w http.ResponseWriter, err error) {
+func HandleError(c store.Context, w http.ResponseWriter, err error) {
 	w.WriteHeader(http.StatusInternalServerError)
 
-	err2 := ErrLayout.Execute(w, tmplt.Context{"err": err})
+	t, err2 := errLayout()
+	if err2 == nil {
+		err2 = t.Execute(w, tmplt.Context{"err": err})
+	}
 	if err2 != nil {
 		c.Criticalf("error %v while serving %v.", err2, err)
 		return
 	}
 }
 
-func HandleAuthRequired(c appengine.Context, w http.ResponseWriter) {
+func HandleAuthRequired(c store.Context, w http.ResponseWriter) {
 	w.WriteHeader(http.StatusUnauthorized)
 	RenderTemplate(c, w, nil, LAYOUT, "templates/401.html")
 }
 
-func HandleJSON(c appengine.Context, w http.ResponseWriter, value interface{}) {
+// HandleForbidden responds that the request is not allowed and why.
+func HandleForbidden(c store.Context, w http.ResponseWriter, reason error) {
+	w.WriteHeader(http.StatusForbidden)
+	RenderTemplate(c, w, tmplt.Context{"reason": reason}, LAYOUT, "templates/403.html")
+}
+
+func HandleJSON(c store.Context, w http.ResponseWriter, value interface{}) {
 	w.Header().Add("content-type", "application/json")
 	json.NewEncoder(w).Encode(value)
 }
+
+func HandleJSONError(c store.Context, w http.ResponseWriter, status int, err error) {
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
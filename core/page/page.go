@@ -5,44 +5,28 @@ package page
 import (
 	"reflect"
 
-	"appengine"
-	"appengine/datastore"
-)
-
-var (
-	typeOfPropertyLoadSaver = reflect.TypeOf((*datastore.PropertyLoadSaver)(nil)).Elem()
-	typeOfPropertyList      = reflect.TypeOf(datastore.PropertyList(nil))
+	"core/store"
 )
 
 type multiArgType int
 
 const (
 	multiArgTypeInvalid multiArgType = iota
-	multiArgTypePropertyLoadSaver
 	multiArgTypeStruct
 	multiArgTypeStructPtr
 	multiArgTypeInterface
 )
 
-// checkMultiArg checks that v has type []S, []*S, []I, or []P, for some struct
-// type S, for some interface type I, or some non-interface non-pointer type P
-// such that P or *P implements PropertyLoadSaver.
+// checkMultiArg checks that v has type []S, []*S or []I, for some struct
+// type S or for some interface type I.
 //
 // It returns what category the slice's elements are, and the reflect.Type
-// that represents S, I or P.
-//
-// As a special case, PropertyList is an invalid type for v.
+// that represents S or I.
 func checkMultiArg(v reflect.Value) (m multiArgType, elemType reflect.Type) {
 	if v.Kind() != reflect.Slice {
 		return multiArgTypeInvalid, nil
 	}
-	if v.Type() == typeOfPropertyList {
-		return multiArgTypeInvalid, nil
-	}
 	elemType = v.Type().Elem()
-	if reflect.PtrTo(elemType).Implements(typeOfPropertyLoadSaver) {
-		return multiArgTypePropertyLoadSaver, elemType
-	}
 	switch elemType.Kind() {
 	case reflect.Struct:
 		return multiArgTypeStruct, elemType
@@ -60,12 +44,12 @@ func checkMultiArg(v reflect.Value) (m multiArgType, elemType reflect.Type) {
 // ----------------------------------------------------------------------------
 
 type Page struct {
-	Keys  []*datastore.Key
-	Start datastore.Cursor
+	Keys  []*store.Key
+	Start store.Cursor
 	More  bool
 }
 
-func GetPage(c appengine.Context, query *datastore.Query, limit int, keysOnly bool, dst interface{}) (*Page, error) {
+func GetPage(c store.Context, query *store.Query, limit int, keysOnly bool, dst interface{}) (*Page, error) {
 	var dv reflect.Value
 	var mat multiArgType
 	var elemType reflect.Type
@@ -73,17 +57,17 @@ func GetPage(c appengine.Context, query *datastore.Query, limit int, keysOnly bo
 	if !keysOnly {
 		dv = reflect.ValueOf(dst)
 		if dv.Kind() != reflect.Ptr || dv.IsNil() {
-			return nil, datastore.ErrInvalidEntityType
+			return nil, store.ErrInvalidEntityType
 		}
 		dv = dv.Elem()
 		mat, elemType = checkMultiArg(dv)
 		if mat == multiArgTypeInvalid || mat == multiArgTypeInterface {
-			return nil, datastore.ErrInvalidEntityType
+			return nil, store.ErrInvalidEntityType
 		}
 	}
 
-	var keys []*datastore.Key
-	var cursor datastore.Cursor
+	var keys []*store.Key
+	var cursor store.Cursor
 
 	query = query.Limit(limit + 1)
 	if keysOnly {
@@ -93,11 +77,13 @@ func GetPage(c appengine.Context, query *datastore.Query, limit int, keysOnly bo
 	more := true
 	for i := 0; i < limit; i++ {
 		var ev reflect.Value
+		var ei interface{}
 		if !keysOnly {
 			ev = reflect.New(elemType)
+			ei = ev.Interface()
 		}
-		k, err := t.Next(ev.Interface())
-		if err == datastore.Done {
+		k, err := t.Next(ei)
+		if err == store.Done {
 			more = false
 			break
 		}
@@ -124,7 +110,7 @@ func GetPage(c appengine.Context, query *datastore.Query, limit int, keysOnly bo
 			ei = reflect.New(elemType).Interface()
 		}
 		_, err = t.Next(ei)
-		if err == datastore.Done {
+		if err == store.Done {
 			more = false
 		}
 	}
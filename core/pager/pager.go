@@ -5,22 +5,23 @@ import (
 	"fmt"
 	"time"
 
-	"appengine"
-	"appengine/datastore"
-	"appengine/memcache"
+	"core/store"
 )
 
 type Pager struct {
 	Page     int
 	PageSize int
 
-	context     appengine.Context
+	// PageURL returns URL of the given page. It is used by pager template.
+	PageURL func(page int) string
+
+	context     store.Context
 	cachePrefix string
-	query       *datastore.Query
+	query       *store.Query
 	hasMore     bool
 }
 
-func NewPager(c appengine.Context, cachePrefix string, q *datastore.Query, page int, pageSize int) *Pager {
+func NewPager(c store.Context, cachePrefix string, q *store.Query, page int, pageSize int) *Pager {
 	if page < 1 {
 		page = 1
 	}
@@ -60,21 +61,37 @@ func (p *Pager) NextPage() int {
 	return p.Page
 }
 
-func (p *Pager) Update(cursor datastore.Cursor, hasMore bool) {
+func (p *Pager) PrevURL() string {
+	return p.PageURL(p.PrevPage())
+}
+
+func (p *Pager) NextURL() string {
+	return p.PageURL(p.NextPage())
+}
+
+// Offset returns number of items before the current page.
+func (p *Pager) Offset() int {
+	return p.PageSize * (p.Page - 1)
+}
+
+// SetHasNext is used instead of Update when items are not fetched
+// by the query, e.g. ranked in memory.
+func (p *Pager) SetHasNext(hasNext bool) {
+	p.hasMore = hasNext
+}
+
+func (p *Pager) Update(cursor store.Cursor, hasMore bool) {
 	p.hasMore = hasMore
-	item := &memcache.Item{
-		Key:        p.cacheKey(p.Page + 1),
-		Value:      []byte(cursor.String()),
-		Expiration: time.Duration(24) * time.Hour,
-	}
-	if err := memcache.Set(p.context, item); err != nil {
+	err := p.context.Cache().Set(
+		p.cacheKey(p.Page+1), []byte(cursor.String()), time.Duration(24)*time.Hour)
+	if err != nil {
 		p.context.Errorf("error setting item: %v", err)
 	}
 }
 
-func (p *Pager) Cursor() (*datastore.Cursor, error) {
-	if item, err := memcache.Get(p.context, p.cacheKey(p.Page)); err == nil {
-		cursor, err := datastore.DecodeCursor(string(item.Value))
+func (p *Pager) Cursor() (*store.Cursor, error) {
+	if value, err := p.context.Cache().Get(p.cacheKey(p.Page)); err == nil {
+		cursor, err := store.DecodeCursor(string(value))
 		if err != nil {
 			return nil, err
 		}
@@ -83,7 +100,7 @@ func (p *Pager) Cursor() (*datastore.Cursor, error) {
 	return nil, errors.New("cursor not found")
 }
 
-func (p *Pager) Query() *datastore.Query {
+func (p *Pager) Query() *store.Query {
 	// there is no cursor for first page
 	if p.Page != 1 {
 		if c, err := p.Cursor(); err == nil {
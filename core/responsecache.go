@@ -0,0 +1,222 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth"
+	"core/cache"
+	"core/store"
+)
+
+var errUncacheable = errors.New("core: response is not cacheable")
+
+type cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+func (resp *cachedResponse) etag() string {
+	sum := sha1.Sum(resp.Body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (resp *cachedResponse) lastModified() time.Time {
+	t, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// responseRecorder collects response of the handler.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+type ResponseCacheOptions struct {
+	Namespace  *cache.Namespace
+	Expiration time.Duration
+	// Params lists query parameters responses depend on. Other
+	// parameters are not part of the cache key, so they can't fill the
+	// cache with copies of the same response.
+	Params []string
+	// Prepare is called on every request before the cache is looked up,
+	// e.g. to apply pending changes that invalidate cached responses.
+	Prepare func(c store.Context) error
+}
+
+// ResponseCache caches whole responses to anonymous GET and HEAD
+// requests by URL. Responses are versioned by the namespace, so bumping
+// it invalidates them. Handlers may set Last-Modified header, which is
+// used for If-Modified-Since requests together with ETag computed from
+// the body.
+type ResponseCache struct {
+	cache   *cache.Cache[*cachedResponse]
+	params  []string
+	prepare func(c store.Context) error
+}
+
+func NewResponseCache(name string, opt ResponseCacheOptions) *ResponseCache {
+	return &ResponseCache{
+		cache: cache.New[*cachedResponse](name, cache.Options{
+			Namespace:  opt.Namespace,
+			Expiration: opt.Expiration,
+		}),
+		params:  opt.Params,
+		prepare: opt.Prepare,
+	}
+}
+
+// key returns cache key of the request: its path and known query
+// parameters in fixed order.
+func (rc *ResponseCache) key(r *http.Request) string {
+	query := r.URL.Query()
+	values := make(url.Values)
+	for _, name := range rc.params {
+		if v, ok := query[name]; ok {
+			values[name] = v
+		}
+	}
+	if len(values) == 0 {
+		return r.URL.EscapedPath()
+	}
+	return r.URL.EscapedPath() + "?" + values.Encode()
+}
+
+func (rc *ResponseCache) Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc.serveHTTP(handler, w, r)
+	})
+}
+
+func (rc *ResponseCache) HandlerFunc(f func(http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc.serveHTTP(http.HandlerFunc(f), w, r)
+	}
+}
+
+func (rc *ResponseCache) serveHTTP(handler http.Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	c := store.NewContext(r)
+	if auth.CurrentUser(c).IsAuth() {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if rc.prepare != nil {
+		if err := rc.prepare(c); err != nil {
+			HandleError(c, w, err)
+			return
+		}
+	}
+
+	record := func() (*cachedResponse, error) {
+		rec := &responseRecorder{header: make(http.Header)}
+		handler.ServeHTTP(rec, r)
+		resp := &cachedResponse{
+			Status: rec.status,
+			Header: rec.header,
+			Body:   rec.body.Bytes(),
+		}
+		if resp.Status == 0 {
+			resp.Status = http.StatusOK
+		}
+		if resp.Status != http.StatusOK || resp.Header.Get("Set-Cookie") != "" {
+			return resp, errUncacheable
+		}
+		return resp, nil
+	}
+
+	resp, err := rc.cache.GetOrLoad(c, rc.key(r), record)
+	if err == errUncacheable && resp == nil {
+		// another request got uncacheable response, so get our own
+		resp, err = record()
+	}
+	if err != nil && err != errUncacheable {
+		HandleError(c, w, err)
+		return
+	}
+
+	writeResponse(w, r, resp, err == nil)
+}
+
+// writeResponse writes recorded response or 304 if the client already
+// has it. Only cacheable responses get validators.
+func writeResponse(w http.ResponseWriter, r *http.Request, resp *cachedResponse, isCacheable bool) {
+	header := w.Header()
+	for name, values := range resp.Header {
+		header[name] = values
+	}
+	if !isCacheable {
+		w.WriteHeader(resp.Status)
+		w.Write(resp.Body)
+		return
+	}
+
+	etag := resp.etag()
+	header.Set("ETag", etag)
+	header.Add("Vary", "Cookie")
+	if isNotModified(r, etag, resp.lastModified()) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// isNotModified evaluates conditional headers of the request. ETag takes
+// precedence over modification time as required by RFC 7232.
+func isNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return ETagMatch(inm, etag)
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// ETagMatch reports whether If-None-Match header matches the etag.
+func ETagMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
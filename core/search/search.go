@@ -0,0 +1,156 @@
+// Package search implements text tokenization, BM25 ranking and
+// highlighting of matched snippets.
+package search
+
+import (
+	"html"
+	"html/template"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// BM25 parameters.
+	K1 = 1.2
+	B  = 0.75
+
+	MIN_TERM_LEN = 2
+)
+
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an and are as at be but by for from has have
+		if in into is it its of on or that the their then there these this to
+		was were will with`) {
+		stopWords[w] = true
+	}
+}
+
+func isTermRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Tokenize splits text into lowercased terms, skipping stop words.
+func Tokenize(text string) []string {
+	terms := make([]string, 0)
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !isTermRune(r) }) {
+		term := strings.ToLower(word)
+		if len([]rune(term)) < MIN_TERM_LEN || stopWords[term] {
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// Unique returns terms without duplicates, in order of first occurrence.
+func Unique(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	unique := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
+
+// Frequencies counts terms.
+func Frequencies(terms []string) map[string]int {
+	freqs := make(map[string]int)
+	for _, term := range terms {
+		freqs[term]++
+	}
+	return freqs
+}
+
+// IDF returns inverse document frequency of the term found in docFreq
+// of docCount documents.
+func IDF(docCount, docFreq int) float64 {
+	n, df := float64(docCount), float64(docFreq)
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// BM25 returns score of the term with frequency termFreq in the document
+// of length docLen; avgDocLen is average length of all documents.
+func BM25(idf float64, termFreq, docLen int, avgDocLen float64) float64 {
+	if avgDocLen <= 0 {
+		avgDocLen = 1
+	}
+	tf := float64(termFreq)
+	norm := K1 * (1 - B + B*float64(docLen)/avgDocLen)
+	return idf * tf * (K1 + 1) / (tf + norm)
+}
+
+// PlainText strips tags from HTML and unescapes entities.
+func PlainText(s string) string {
+	b := make([]rune, 0, len(s))
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+			b = append(b, ' ')
+		case !inTag:
+			b = append(b, r)
+		}
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(b))), " ")
+}
+
+// Highlight returns escaped snippet of about width words around the first
+// matched term; matched words are wrapped in <mark>.
+func Highlight(text string, terms []string, width int) template.HTML {
+	match := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		match[term] = true
+	}
+
+	words := strings.Fields(text)
+	first := -1
+	for i, word := range words {
+		if isMatch(word, match) {
+			first = i
+			break
+		}
+	}
+
+	start := 0
+	if first > width/3 {
+		start = first - width/3
+	}
+	end := start + width
+	if end > len(words) {
+		end = len(words)
+	}
+
+	parts := make([]string, 0, end-start+2)
+	if start > 0 {
+		parts = append(parts, "&hellip;")
+	}
+	for _, word := range words[start:end] {
+		if isMatch(word, match) {
+			parts = append(parts, "<mark>"+template.HTMLEscapeString(word)+"</mark>")
+		} else {
+			parts = append(parts, template.HTMLEscapeString(word))
+		}
+	}
+	if end < len(words) {
+		parts = append(parts, "&hellip;")
+	}
+	return template.HTML(strings.Join(parts, " "))
+}
+
+func isMatch(word string, match map[string]bool) bool {
+	for _, term := range Tokenize(word) {
+		if match[term] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"The Go programming language", []string{"go", "programming", "language"}},
+		{"go-1.21, C++ and x86_64!", []string{"go", "21", "x86", "64"}},
+		{"Привет, МИР", []string{"привет", "мир"}},
+		{"a I to of", []string{}},
+		{"", []string{}},
+	}
+	for _, test := range tests {
+		if got := Tokenize(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestUnique(t *testing.T) {
+	terms := []string{"b", "a", "b", "c", "a"}
+	if got, want := Unique(terms), []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unique = %q, want %q", got, want)
+	}
+	if got, want := Frequencies(terms), map[string]int{"a": 2, "b": 2, "c": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Frequencies = %v, want %v", got, want)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestIDF(t *testing.T) {
+	if got, want := IDF(10, 1), math.Log(1+9.5/1.5); !near(got, want) {
+		t.Errorf("IDF(10, 1) = %v, want %v", got, want)
+	}
+	if IDF(10, 1) <= IDF(10, 5) {
+		t.Errorf("rare term does not weigh more than common one")
+	}
+	// term found in every document still has positive weight
+	if got := IDF(10, 10); got <= 0 {
+		t.Errorf("IDF(10, 10) = %v, want > 0", got)
+	}
+}
+
+func TestBM25(t *testing.T) {
+	// document of average length: idf * tf * (K1 + 1) / (tf + K1)
+	if got := BM25(1, 1, 10, 10); !near(got, 1) {
+		t.Errorf("BM25(1, 1, 10, 10) = %v, want 1", got)
+	}
+	if got, want := BM25(2, 3, 10, 10), 2*3*(K1+1)/(3+K1); !near(got, want) {
+		t.Errorf("BM25(2, 3, 10, 10) = %v, want %v", got, want)
+	}
+	if BM25(1, 2, 10, 10) <= BM25(1, 1, 10, 10) {
+		t.Errorf("score does not grow with term frequency")
+	}
+	if BM25(1, 1, 20, 10) >= BM25(1, 1, 5, 10) {
+		t.Errorf("score does not decrease with document length")
+	}
+	// term frequency saturates at K1 + 1
+	if got := BM25(1, 1e6, 10, 10); got >= K1+1 {
+		t.Errorf("BM25 with huge tf = %v, want < %v", got, K1+1)
+	}
+	if got := BM25(1, 1, 0, 0); math.IsNaN(got) || math.IsInf(got, 0) {
+		t.Errorf("BM25 with empty collection = %v", got)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"<p>a &amp; b</p><p>c</p>", "a & b c"},
+		{"x<br />y", "x y"},
+		{"1 &lt; 2 &gt; 0", "1 < 2 > 0"},
+		{"  many \n spaces ", "many spaces"},
+	}
+	for _, test := range tests {
+		if got := PlainText(test.in); got != test.want {
+			t.Errorf("PlainText(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		text  string
+		terms []string
+		width int
+		want  string
+	}{
+		{"Learn Go today", []string{"go"}, 10, "Learn <mark>Go</mark> today"},
+		{"no match here", []string{"go"}, 10, "no match here"},
+		{
+			`1 < 2 & "go" <script>alert(1)</script>`, []string{"go", "script"}, 12,
+			`1 &lt; 2 &amp; <mark>&#34;go&#34;</mark> <mark>&lt;script&gt;alert(1)&lt;/script&gt;</mark>`,
+		},
+		{"a b c d e f g h", []string{"zz"}, 3, "a b c &hellip;"},
+	}
+	for _, test := range tests {
+		if got := string(Highlight(test.text, test.terms, test.width)); got != test.want {
+			t.Errorf("Highlight(%q, %q, %d) = %q, want %q", test.text, test.terms, test.width, got, test.want)
+		}
+	}
+
+	words := make([]string, 20)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i)
+	}
+	words[15] = "go"
+	got := string(Highlight(strings.Join(words, " "), []string{"go"}, 6))
+	if want := "&hellip; w13 w14 <mark>go</mark> w16 w17 w18 &hellip;"; got != want {
+		t.Errorf("Highlight window = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,264 @@
+//go:build appengine
+// +build appengine
+
+// Package gae implements store backend on top of App Engine datastore
+// and memcache.
+package gae
+
+import (
+	"net/http"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/memcache"
+
+	"core/store"
+)
+
+type Backend struct{}
+
+func (Backend) NewContext(r *http.Request) store.Context {
+	return NewContext(appengine.NewContext(r), r)
+}
+
+type context struct {
+	appengine.Context
+	req *http.Request
+}
+
+func NewContext(c appengine.Context, r *http.Request) store.Context {
+	return &context{Context: c, req: r}
+}
+
+// AppengineContext returns App Engine context wrapped by c. It is used
+// by code that calls App Engine only services, e.g. blobstore.
+func AppengineContext(c store.Context) appengine.Context {
+	return c.(*context).Context
+}
+
+func (c *context) Store() store.Store {
+	return &datastoreStore{c.Context}
+}
+
+func (c *context) Cache() store.Cache {
+	return &memcacheCache{c.Context}
+}
+
+func (c *context) Request() *http.Request {
+	return c.req
+}
+
+// ----------------------------------------------------------------------------
+
+func toDatastoreKey(c appengine.Context, key *store.Key) *datastore.Key {
+	if key == nil {
+		return nil
+	}
+	return datastore.NewKey(c, key.Kind(), key.StringID(), key.IntID(),
+		toDatastoreKey(c, key.Parent()))
+}
+
+func fromDatastoreKey(key *datastore.Key) *store.Key {
+	if key == nil {
+		return nil
+	}
+	return store.NewKey(key.Kind(), key.StringID(), key.IntID(),
+		fromDatastoreKey(key.Parent()))
+}
+
+func toPropertyList(c appengine.Context, props []store.Property) datastore.PropertyList {
+	pl := make(datastore.PropertyList, len(props))
+	for i, p := range props {
+		value := p.Value
+		if key, ok := value.(*store.Key); ok {
+			value = toDatastoreKey(c, key)
+		}
+		pl[i] = datastore.Property{
+			Name:     p.Name,
+			Value:    value,
+			NoIndex:  p.NoIndex,
+			Multiple: p.Multiple,
+		}
+	}
+	return pl
+}
+
+func fromPropertyList(pl datastore.PropertyList) []store.Property {
+	props := make([]store.Property, len(pl))
+	for i, p := range pl {
+		value := p.Value
+		switch v := value.(type) {
+		case *datastore.Key:
+			value = fromDatastoreKey(v)
+		case appengine.BlobKey:
+			value = string(v)
+		}
+		props[i] = store.Property{
+			Name:     p.Name,
+			Value:    value,
+			NoIndex:  p.NoIndex,
+			Multiple: p.Multiple,
+		}
+	}
+	return props
+}
+
+func convertError(err error) error {
+	switch err {
+	case datastore.ErrNoSuchEntity:
+		return store.ErrNoSuchEntity
+	case datastore.ErrInvalidEntityType:
+		return store.ErrInvalidEntityType
+	case datastore.Done:
+		return store.Done
+	}
+	return err
+}
+
+type datastoreStore struct {
+	c appengine.Context
+}
+
+func (s *datastoreStore) Get(key *store.Key, dst interface{}) error {
+	var pl datastore.PropertyList
+	if err := datastore.Get(s.c, toDatastoreKey(s.c, key), &pl); err != nil {
+		return convertError(err)
+	}
+	return store.LoadStruct(dst, fromPropertyList(pl))
+}
+
+func (s *datastoreStore) Put(key *store.Key, src interface{}) (*store.Key, error) {
+	props, err := store.SaveStruct(src)
+	if err != nil {
+		return nil, err
+	}
+	pl := toPropertyList(s.c, props)
+	dsKey, err := datastore.Put(s.c, toDatastoreKey(s.c, key), &pl)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return fromDatastoreKey(dsKey), nil
+}
+
+func (s *datastoreStore) Delete(key *store.Key) error {
+	return convertError(datastore.Delete(s.c, toDatastoreKey(s.c, key)))
+}
+
+func (s *datastoreStore) RunInTransaction(c store.Context, f func(tc store.Context) error) error {
+	return datastore.RunInTransaction(s.c, func(tc appengine.Context) error {
+		return f(NewContext(tc, c.Request()))
+	}, nil)
+}
+
+func (s *datastoreStore) Run(q *store.Query) store.Iterator {
+	dsq := datastore.NewQuery(q.GetKind())
+	if ancestor := q.GetAncestor(); ancestor != nil {
+		dsq = dsq.Ancestor(toDatastoreKey(s.c, ancestor))
+	}
+	for _, f := range q.GetFilters() {
+		value := f.Value
+		if key, ok := value.(*store.Key); ok {
+			value = toDatastoreKey(s.c, key)
+		}
+		dsq = dsq.Filter(f.Field+" "+f.Operator, value)
+	}
+	for _, o := range q.GetOrders() {
+		if o.Descending {
+			dsq = dsq.Order("-" + o.Field)
+		} else {
+			dsq = dsq.Order(o.Field)
+		}
+	}
+	if limit := q.GetLimit(); limit >= 0 {
+		dsq = dsq.Limit(limit)
+	}
+	if offset := q.GetOffset(); offset > 0 {
+		dsq = dsq.Offset(offset)
+	}
+	if start := q.GetStart(); start != "" {
+		cursor, err := datastore.DecodeCursor(string(start))
+		if err != nil {
+			return &iterator{err: err}
+		}
+		dsq = dsq.Start(cursor)
+	}
+	if q.IsKeysOnly() {
+		dsq = dsq.KeysOnly()
+	}
+	return &iterator{t: dsq.Run(s.c), keysOnly: q.IsKeysOnly()}
+}
+
+type iterator struct {
+	t        *datastore.Iterator
+	keysOnly bool
+	err      error
+}
+
+func (t *iterator) Next(dst interface{}) (*store.Key, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	if t.keysOnly {
+		key, err := t.t.Next(nil)
+		if err != nil {
+			return nil, convertError(err)
+		}
+		return fromDatastoreKey(key), nil
+	}
+
+	var pl datastore.PropertyList
+	key, err := t.t.Next(&pl)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if dst != nil {
+		if err := store.LoadStruct(dst, fromPropertyList(pl)); err != nil {
+			return nil, err
+		}
+	}
+	return fromDatastoreKey(key), nil
+}
+
+func (t *iterator) Cursor() (store.Cursor, error) {
+	if t.err != nil {
+		return "", t.err
+	}
+	cursor, err := t.t.Cursor()
+	if err != nil {
+		return "", err
+	}
+	return store.Cursor(cursor.String()), nil
+}
+
+// ----------------------------------------------------------------------------
+
+type memcacheCache struct {
+	c appengine.Context
+}
+
+func (m *memcacheCache) Get(key string) ([]byte, error) {
+	item, err := memcache.Get(m.c, key)
+	if err == memcache.ErrCacheMiss {
+		return nil, store.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+func (m *memcacheCache) Set(key string, value []byte, expiration time.Duration) error {
+	return memcache.Set(m.c, &memcache.Item{
+		Key:        key,
+		Value:      value,
+		Expiration: expiration,
+	})
+}
+
+func (m *memcacheCache) Delete(key string) error {
+	if err := memcache.Delete(m.c, key); err != memcache.ErrCacheMiss {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("store: invalid key")
+
+// Key identifies an entity. It mirrors datastore.Key, but does not depend on
+// App Engine, so models can be used with any backend.
+type Key struct {
+	kind     string
+	stringID string
+	intID    int64
+	parent   *Key
+}
+
+func NewKey(kind, stringID string, intID int64, parent *Key) *Key {
+	return &Key{
+		kind:     kind,
+		stringID: stringID,
+		intID:    intID,
+		parent:   parent,
+	}
+}
+
+func NewIncompleteKey(kind string, parent *Key) *Key {
+	return NewKey(kind, "", 0, parent)
+}
+
+func (k *Key) Kind() string {
+	return k.kind
+}
+
+func (k *Key) StringID() string {
+	return k.stringID
+}
+
+func (k *Key) IntID() int64 {
+	return k.intID
+}
+
+func (k *Key) Parent() *Key {
+	return k.parent
+}
+
+func (k *Key) Incomplete() bool {
+	return k.stringID == "" && k.intID == 0
+}
+
+// HasAncestor reports whether ancestor is k or one of k's parents.
+func (k *Key) HasAncestor(ancestor *Key) bool {
+	for ; k != nil; k = k.parent {
+		if k.Equal(ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Key) Equal(o *Key) bool {
+	for k != nil && o != nil {
+		if k.kind != o.kind || k.stringID != o.stringID || k.intID != o.intID {
+			return false
+		}
+		k, o = k.parent, o.parent
+	}
+	return k == o
+}
+
+func (k *Key) path() []*Key {
+	var path []*Key
+	for ; k != nil; k = k.parent {
+		path = append([]*Key{k}, path...)
+	}
+	return path
+}
+
+// compare orders keys like datastore: by path elements, where
+// numeric IDs go before string IDs.
+func (k *Key) compare(o *Key) int {
+	a, b := k.path(), o.path()
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, y := a[i], b[i]
+		if cmp := strings.Compare(x.kind, y.kind); cmp != 0 {
+			return cmp
+		}
+		switch {
+		case x.stringID == "" && y.stringID != "":
+			return -1
+		case x.stringID != "" && y.stringID == "":
+			return 1
+		case x.intID < y.intID:
+			return -1
+		case x.intID > y.intID:
+			return 1
+		}
+		if cmp := strings.Compare(x.stringID, y.stringID); cmp != 0 {
+			return cmp
+		}
+	}
+	return len(a) - len(b)
+}
+
+func (k *Key) marshal(b *bytes.Buffer) {
+	if k.parent != nil {
+		k.parent.marshal(b)
+		b.WriteByte('/')
+	}
+	b.WriteString(url.QueryEscape(k.kind))
+	b.WriteByte(',')
+	if k.stringID != "" {
+		b.WriteByte('s')
+		b.WriteString(url.QueryEscape(k.stringID))
+	} else {
+		b.WriteByte('i')
+		b.WriteString(strconv.FormatInt(k.intID, 10))
+	}
+}
+
+// String returns human readable representation of the key path,
+// e.g. "article,i12/comment,i3".
+func (k *Key) String() string {
+	b := &bytes.Buffer{}
+	k.marshal(b)
+	return b.String()
+}
+
+// Encode returns opaque representation of the key suitable for use in URLs.
+func (k *Key) Encode() string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString([]byte(k.String())), "=")
+}
+
+// ParseKey parses key path returned by Key.String.
+func ParseKey(s string) (*Key, error) {
+	var key *Key
+	for _, elem := range strings.Split(s, "/") {
+		parts := strings.SplitN(elem, ",", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, ErrInvalidKey
+		}
+		kind, err := url.QueryUnescape(parts[0])
+		if err != nil {
+			return nil, ErrInvalidKey
+		}
+		key = NewIncompleteKey(kind, key)
+		switch id := parts[1][1:]; parts[1][0] {
+		case 's':
+			if key.stringID, err = url.QueryUnescape(id); err != nil {
+				return nil, ErrInvalidKey
+			}
+		case 'i':
+			if key.intID, err = strconv.ParseInt(id, 10, 64); err != nil {
+				return nil, ErrInvalidKey
+			}
+		default:
+			return nil, ErrInvalidKey
+		}
+	}
+	return key, nil
+}
+
+func DecodeKey(encoded string) (*Key, error) {
+	if m := len(encoded) % 4; m != 0 {
+		encoded += strings.Repeat("=", 4-m)
+	}
+	b, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return ParseKey(string(b))
+}
+
+func (k *Key) GobEncode() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *Key) GobDecode(b []byte) error {
+	key, err := ParseKey(string(b))
+	if err != nil {
+		return err
+	}
+	*k = *key
+	return nil
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func TestKeyString(t *testing.T) {
+	parent := NewKey("article", "", 12, nil)
+	tests := []struct {
+		key  *Key
+		want string
+	}{
+		{NewKey("article", "", 12, nil), "article,i12"},
+		{NewKey("user", "bob", 0, nil), "user,sbob"},
+		{NewKey("comment", "", 3, parent), "article,i12/comment,i3"},
+		{NewKey("tag", "a/b,c d", 0, parent), "article,i12/tag,sa%2Fb%2Cc+d"},
+		{NewKey("odd kind", "", -1, nil), "odd+kind,i-1"},
+		{NewIncompleteKey("article", nil), "article,i0"},
+	}
+	for _, test := range tests {
+		s := test.key.String()
+		if s != test.want {
+			t.Errorf("String() = %q, want %q", s, test.want)
+		}
+
+		key, err := ParseKey(s)
+		if err != nil {
+			t.Errorf("ParseKey(%q) failed: %v", s, err)
+			continue
+		}
+		if !key.Equal(test.key) {
+			t.Errorf("ParseKey(%q) = %v, want %v", s, key, test.key)
+		}
+
+		key, err = DecodeKey(test.key.Encode())
+		if err != nil {
+			t.Errorf("DecodeKey(%q) failed: %v", test.key.Encode(), err)
+			continue
+		}
+		if !key.Equal(test.key) {
+			t.Errorf("DecodeKey(%q) = %v, want %v", test.key.Encode(), key, test.key)
+		}
+	}
+}
+
+func TestParseKeyInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"article",
+		"article,",
+		"article,x12",
+		"article,iabc",
+		"article,i1/",
+		"article,s%zz",
+		"%zz,i1",
+	} {
+		if _, err := ParseKey(s); err != ErrInvalidKey {
+			t.Errorf("ParseKey(%q) returned %v, want ErrInvalidKey", s, err)
+		}
+	}
+
+	for _, s := range []string{"!!!", "YXJ0aWNsZQ"} {
+		if _, err := DecodeKey(s); err != ErrInvalidKey {
+			t.Errorf("DecodeKey(%q) returned %v, want ErrInvalidKey", s, err)
+		}
+	}
+}
+
+func TestKeyCompare(t *testing.T) {
+	a1 := NewKey("article", "", 1, nil)
+	tests := []struct {
+		a, b *Key
+		want int
+	}{
+		{a1, NewKey("article", "", 1, nil), 0},
+		{a1, NewKey("article", "", 2, nil), -1},
+		{NewKey("article", "", 10, nil), NewKey("article", "", 9, nil), 1},
+		{NewKey("article", "", 100, nil), NewKey("article", "a", 0, nil), -1},
+		{NewKey("article", "a", 0, nil), NewKey("article", "b", 0, nil), -1},
+		{NewKey("article", "", 5, nil), NewKey("user", "", 1, nil), -1},
+		{a1, NewKey("comment", "", 1, a1), -1},
+		{NewKey("comment", "", 9, a1), NewKey("comment", "", 1, NewKey("article", "", 2, nil)), -1},
+	}
+	for _, test := range tests {
+		if got := sign(test.a.compare(test.b)); got != test.want {
+			t.Errorf("%v compare %v = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := sign(test.b.compare(test.a)); got != -test.want {
+			t.Errorf("%v compare %v = %d, want %d", test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestKeyHasAncestor(t *testing.T) {
+	root := NewKey("blog", "main", 0, nil)
+	article := NewKey("article", "", 1, root)
+	comment := NewKey("comment", "", 2, article)
+	tests := []struct {
+		key, ancestor *Key
+		want          bool
+	}{
+		{comment, comment, true},
+		{comment, article, true},
+		{comment, root, true},
+		{article, comment, false},
+		{comment, NewKey("article", "", 1, nil), false},
+		{comment, NewKey("article", "", 2, root), false},
+	}
+	for _, test := range tests {
+		if got := test.key.HasAncestor(test.ancestor); got != test.want {
+			t.Errorf("%v.HasAncestor(%v) = %v, want %v", test.key, test.ancestor, got, test.want)
+		}
+	}
+}
+
+func TestKeyGob(t *testing.T) {
+	key := NewKey("comment", "x", 0, NewKey("article", "", 7, nil))
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(key); err != nil {
+		t.Fatal(err)
+	}
+	got := &Key{}
+	if err := gob.NewDecoder(buf).Decode(got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(key) {
+		t.Errorf("got %v, want %v", got, key)
+	}
+}
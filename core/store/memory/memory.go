@@ -0,0 +1,143 @@
+// Package memory implements in-process store backend. It is used to run
+// the blog without App Engine SDK, e.g. in development and tests.
+package memory
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"core/store"
+)
+
+type Backend struct {
+	store *Store
+	cache *Cache
+}
+
+func NewBackend() *Backend {
+	return &Backend{
+		store: NewStore(),
+		cache: NewCache(),
+	}
+}
+
+func (b *Backend) NewContext(r *http.Request) store.Context {
+	return store.NewStdContext(b.store, b.cache, r)
+}
+
+// ----------------------------------------------------------------------------
+
+type Store struct {
+	mutex   sync.RWMutex
+	txMutex sync.Mutex
+	records map[string]*store.Record
+	lastID  int64
+}
+
+func NewStore() *Store {
+	return &Store{records: make(map[string]*store.Record)}
+}
+
+func (s *Store) Get(key *store.Key, dst interface{}) error {
+	s.mutex.RLock()
+	rec, ok := s.records[key.String()]
+	s.mutex.RUnlock()
+	if !ok {
+		return store.ErrNoSuchEntity
+	}
+	return store.LoadStruct(dst, rec.Props)
+}
+
+func (s *Store) Put(key *store.Key, src interface{}) (*store.Key, error) {
+	props, err := store.SaveStruct(src)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if key.Incomplete() {
+		s.lastID++
+		key = store.NewKey(key.Kind(), "", s.lastID, key.Parent())
+	}
+	s.records[key.String()] = &store.Record{Key: key, Props: props}
+	return key, nil
+}
+
+func (s *Store) Delete(key *store.Key) error {
+	s.mutex.Lock()
+	delete(s.records, key.String())
+	s.mutex.Unlock()
+	return nil
+}
+
+// RunInTransaction serializes transactions. Changes are not rolled back
+// when f fails.
+func (s *Store) RunInTransaction(c store.Context, f func(tc store.Context) error) error {
+	s.txMutex.Lock()
+	defer s.txMutex.Unlock()
+	return f(c)
+}
+
+func (s *Store) Run(q *store.Query) store.Iterator {
+	s.mutex.RLock()
+	records := make([]*store.Record, 0, len(s.records))
+	for _, rec := range s.records {
+		records = append(records, rec)
+	}
+	s.mutex.RUnlock()
+
+	return store.RunRecords(records, q)
+}
+
+// ----------------------------------------------------------------------------
+
+type item struct {
+	value   []byte
+	expires time.Time
+}
+
+type Cache struct {
+	mutex sync.Mutex
+	items map[string]*item
+}
+
+func NewCache() *Cache {
+	return &Cache{items: make(map[string]*item)}
+}
+
+func (c *Cache) Get(key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	it, ok := c.items[key]
+	if !ok {
+		return nil, store.ErrCacheMiss
+	}
+	if !it.expires.IsZero() && time.Now().After(it.expires) {
+		delete(c.items, key)
+		return nil, store.ErrCacheMiss
+	}
+	return append([]byte(nil), it.value...), nil
+}
+
+func (c *Cache) Set(key string, value []byte, expiration time.Duration) error {
+	it := &item{value: append([]byte(nil), value...)}
+	if expiration > 0 {
+		it.expires = time.Now().Add(expiration)
+	}
+
+	c.mutex.Lock()
+	c.items[key] = it
+	c.mutex.Unlock()
+	return nil
+}
+
+func (c *Cache) Delete(key string) error {
+	c.mutex.Lock()
+	delete(c.items, key)
+	c.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"core/store"
+	"core/store/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Backend {
+		return NewBackend()
+	})
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache()
+	tests := []struct {
+		key        string
+		expiration time.Duration
+		want       error
+	}{
+		{"forever", 0, nil},
+		{"later", time.Hour, nil},
+		{"expired", -time.Second, nil},
+	}
+	for _, test := range tests {
+		if err := c.Set(test.key, []byte(test.key), test.expiration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.items["expired"].expires = time.Now().Add(-time.Second)
+	for _, test := range tests {
+		b, err := c.Get(test.key)
+		want := error(nil)
+		if test.key == "expired" {
+			want = store.ErrCacheMiss
+		}
+		if err != want {
+			t.Errorf("Get(%q) returned error %v, want %v", test.key, err, want)
+			continue
+		}
+		if err == nil && string(b) != test.key {
+			t.Errorf("Get(%q) = %q", test.key, b)
+		}
+	}
+
+	if err := c.Delete("forever"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("forever"); err != store.ErrCacheMiss {
+		t.Errorf("Get after Delete returned %v, want ErrCacheMiss", err)
+	}
+}
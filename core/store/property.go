@@ -0,0 +1,336 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	typeOfByteSlice = reflect.TypeOf([]byte(nil))
+	typeOfTime      = reflect.TypeOf(time.Time{})
+	typeOfKey       = reflect.TypeOf((*Key)(nil))
+)
+
+// Property mirrors datastore.Property. Value is one of: int64, bool,
+// string, float64, []byte, time.Time or *Key.
+type Property struct {
+	Name     string
+	Value    interface{}
+	NoIndex  bool
+	Multiple bool
+}
+
+type field struct {
+	index   int
+	name    string
+	noIndex bool
+}
+
+// structFields returns stored fields of the struct type. Field names and
+// options are taken from `datastore:"name,noindex"` tags, so models keep
+// working with App Engine datastore.
+func structFields(t reflect.Type) []field {
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("datastore")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i != -1 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, field{
+			index:   i,
+			name:    name,
+			noIndex: opts == "noindex",
+		})
+	}
+	return fields
+}
+
+func normalizeValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Type() {
+	case typeOfByteSlice:
+		return append([]byte(nil), v.Bytes()...)
+	case typeOfTime, typeOfKey:
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	}
+	return nil
+}
+
+// SaveStruct converts struct pointed to by src to a list of properties.
+func SaveStruct(src interface{}) ([]Property, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, ErrInvalidEntityType
+	}
+	v = v.Elem()
+
+	var props []Property
+	for _, f := range structFields(v.Type()) {
+		fv := v.Field(f.index)
+		if fv.Kind() == reflect.Slice && fv.Type() != typeOfByteSlice {
+			for j := 0; j < fv.Len(); j++ {
+				value := normalizeValue(fv.Index(j))
+				if value == nil {
+					return nil, fmt.Errorf("store: unsupported field type %v", fv.Type())
+				}
+				props = append(props, Property{
+					Name:     f.name,
+					Value:    value,
+					NoIndex:  f.noIndex,
+					Multiple: true,
+				})
+			}
+			continue
+		}
+
+		value := normalizeValue(fv)
+		if value == nil {
+			return nil, fmt.Errorf("store: unsupported field type %v", fv.Type())
+		}
+		_, isBytes := value.([]byte)
+		props = append(props, Property{
+			Name:    f.name,
+			Value:   value,
+			NoIndex: f.noIndex || isBytes,
+		})
+	}
+	return props, nil
+}
+
+func setValue(v reflect.Value, value interface{}) error {
+	switch x := value.(type) {
+	case []byte:
+		if v.Type() == typeOfByteSlice {
+			v.SetBytes(append([]byte(nil), x...))
+			return nil
+		}
+	case time.Time:
+		if v.Type() == typeOfTime {
+			v.Set(reflect.ValueOf(x))
+			return nil
+		}
+	case *Key:
+		if v.Type() == typeOfKey {
+			v.Set(reflect.ValueOf(x))
+			return nil
+		}
+	case nil:
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	case int64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v.SetInt(x)
+			return nil
+		}
+	case float64:
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(x)
+			return nil
+		}
+	case bool:
+		if v.Kind() == reflect.Bool {
+			v.SetBool(x)
+			return nil
+		}
+	case string:
+		if v.Kind() == reflect.String {
+			v.SetString(x)
+			return nil
+		}
+	}
+	return fmt.Errorf("store: can't load %T into %v", value, v.Type())
+}
+
+// LoadStruct loads properties into struct pointed to by dst. Properties
+// without matching field are ignored, so fields can be removed from models.
+func LoadStruct(dst interface{}, props []Property) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ErrInvalidEntityType
+	}
+	v = v.Elem()
+
+	fields := make(map[string]field)
+	for _, f := range structFields(v.Type()) {
+		fields[f.name] = f
+	}
+
+	reset := make(map[string]bool)
+	for _, p := range props {
+		f, ok := fields[p.Name]
+		if !ok {
+			continue
+		}
+		fv := v.Field(f.index)
+		if fv.Kind() == reflect.Slice && fv.Type() != typeOfByteSlice {
+			if !reset[p.Name] {
+				fv.Set(reflect.MakeSlice(fv.Type(), 0, 1))
+				reset[p.Name] = true
+			}
+			ev := reflect.New(fv.Type().Elem()).Elem()
+			if err := setValue(ev, p.Value); err != nil {
+				return err
+			}
+			fv.Set(reflect.Append(fv, ev))
+			continue
+		}
+		if err := setValue(fv, p.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case int64:
+		return 1
+	case time.Time:
+		return 2
+	case bool:
+		return 3
+	case string, []byte:
+		return 4
+	case float64:
+		return 5
+	case *Key:
+		return 6
+	}
+	return 7
+}
+
+// Compare compares two property values using datastore ordering rules:
+// values of different types are ordered by type first.
+func Compare(a, b interface{}) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch x := a.(type) {
+	case int64:
+		y := b.(int64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	case float64:
+		y := b.(float64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	case time.Time:
+		y := b.(time.Time)
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+	case bool:
+		y := b.(bool)
+		switch {
+		case !x && y:
+			return -1
+		case x && !y:
+			return 1
+		}
+	case string, []byte:
+		return bytes.Compare(toBytes(a), toBytes(b))
+	case *Key:
+		y := b.(*Key)
+		switch {
+		case x == nil && y == nil:
+			return 0
+		case x == nil:
+			return -1
+		case y == nil:
+			return 1
+		}
+		return x.compare(y)
+	}
+	return 0
+}
+
+func toBytes(v interface{}) []byte {
+	if s, ok := v.(string); ok {
+		return []byte(s)
+	}
+	return v.([]byte)
+}
+
+// Match reports whether any of the property values satisfies the filter.
+// Unindexed properties never match, like in datastore.
+func (f Filter) Match(props []Property) bool {
+	for _, p := range props {
+		if p.Name != f.Field || p.NoIndex {
+			continue
+		}
+		cmp := Compare(p.Value, f.Value)
+		var ok bool
+		switch f.Operator {
+		case "=":
+			ok = cmp == 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns all values of the named property.
+func Values(props []Property, name string) []interface{} {
+	var values []interface{}
+	for _, p := range props {
+		if p.Name == name {
+			values = append(values, p.Value)
+		}
+	}
+	return values
+}
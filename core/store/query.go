@@ -0,0 +1,244 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("store: invalid cursor")
+
+var operators = []string{">=", "<=", "=", "<", ">"}
+
+type Filter struct {
+	Field    string
+	Operator string
+	Value    interface{}
+}
+
+type Order struct {
+	Field      string
+	Descending bool
+}
+
+// Query mirrors datastore.Query: every method returns modified copy
+// of the query, so queries can be safely shared.
+type Query struct {
+	kind     string
+	ancestor *Key
+	filters  []Filter
+	orders   []Order
+	limit    int
+	offset   int
+	start    Cursor
+	keysOnly bool
+
+	err error
+}
+
+func NewQuery(kind string) *Query {
+	return &Query{
+		kind:  kind,
+		limit: -1,
+	}
+}
+
+func (q *Query) clone() *Query {
+	x := *q
+	x.filters = append([]Filter(nil), q.filters...)
+	x.orders = append([]Order(nil), q.orders...)
+	return &x
+}
+
+func (q *Query) Ancestor(ancestor *Key) *Query {
+	q = q.clone()
+	if ancestor == nil {
+		q.err = ErrInvalidKey
+		return q
+	}
+	q.ancestor = ancestor
+	return q
+}
+
+// Filter adds field-based filter to the query. filterStr is a field name
+// followed by an operator: "=", "<", "<=", ">" or ">=", e.g. "IsPublic=".
+func (q *Query) Filter(filterStr string, value interface{}) *Query {
+	q = q.clone()
+	filterStr = strings.TrimSpace(filterStr)
+	for _, op := range operators {
+		if strings.HasSuffix(filterStr, op) {
+			field := strings.TrimSpace(strings.TrimSuffix(filterStr, op))
+			if field == "" {
+				break
+			}
+			q.filters = append(q.filters, Filter{
+				Field:    field,
+				Operator: op,
+				Value:    normalizeValue(reflect.ValueOf(value)),
+			})
+			return q
+		}
+	}
+	q.err = fmt.Errorf("store: invalid filter %q", filterStr)
+	return q
+}
+
+// Order adds field-based sort to the query. Field name prefixed with "-"
+// means descending order.
+func (q *Query) Order(fieldName string) *Query {
+	q = q.clone()
+	fieldName = strings.TrimSpace(fieldName)
+	order := Order{Field: fieldName}
+	if strings.HasPrefix(fieldName, "-") {
+		order.Field = strings.TrimSpace(fieldName[1:])
+		order.Descending = true
+	}
+	if order.Field == "" {
+		q.err = fmt.Errorf("store: invalid order %q", fieldName)
+		return q
+	}
+	q.orders = append(q.orders, order)
+	return q
+}
+
+func (q *Query) KeysOnly() *Query {
+	q = q.clone()
+	q.keysOnly = true
+	return q
+}
+
+func (q *Query) Limit(limit int) *Query {
+	q = q.clone()
+	q.limit = limit
+	return q
+}
+
+func (q *Query) Offset(offset int) *Query {
+	q = q.clone()
+	q.offset = offset
+	return q
+}
+
+func (q *Query) Start(c Cursor) *Query {
+	q = q.clone()
+	q.start = c
+	return q
+}
+
+// Getters below are used by backends.
+
+func (q *Query) GetKind() string      { return q.kind }
+func (q *Query) GetAncestor() *Key    { return q.ancestor }
+func (q *Query) GetFilters() []Filter { return q.filters }
+func (q *Query) GetOrders() []Order   { return q.orders }
+func (q *Query) GetLimit() int        { return q.limit }
+func (q *Query) GetOffset() int       { return q.offset }
+func (q *Query) GetStart() Cursor     { return q.start }
+func (q *Query) IsKeysOnly() bool     { return q.keysOnly }
+
+func (q *Query) Run(c Context) Iterator {
+	if q.err != nil {
+		return &errIterator{q.err}
+	}
+	return c.Store().Run(q)
+}
+
+// GetAll runs the query and appends results to dst, which must be
+// a pointer to a slice of structs or struct pointers.
+func (q *Query) GetAll(c Context, dst interface{}) ([]*Key, error) {
+	var dv reflect.Value
+	var elemType reflect.Type
+	isPtr := false
+	if !q.keysOnly {
+		dv = reflect.ValueOf(dst)
+		if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+			return nil, ErrInvalidEntityType
+		}
+		dv = dv.Elem()
+		elemType = dv.Type().Elem()
+		if elemType.Kind() == reflect.Ptr {
+			isPtr = true
+			elemType = elemType.Elem()
+		}
+		if elemType.Kind() != reflect.Struct {
+			return nil, ErrInvalidEntityType
+		}
+	}
+
+	var keys []*Key
+	t := q.Run(c)
+	for {
+		var ev reflect.Value
+		var ei interface{}
+		if !q.keysOnly {
+			ev = reflect.New(elemType)
+			ei = ev.Interface()
+		}
+		key, err := t.Next(ei)
+		if err == Done {
+			break
+		}
+		if err != nil {
+			return keys, err
+		}
+		if !q.keysOnly {
+			if !isPtr {
+				ev = ev.Elem()
+			}
+			dv.Set(reflect.Append(dv, ev))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Cursor is an opaque position in query results. Its format
+// depends on the backend.
+type Cursor string
+
+// String returns representation of the cursor suitable for use in URLs.
+// Use DecodeCursor to parse it.
+func (c Cursor) String() string {
+	if c == "" {
+		return ""
+	}
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(string(c)); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+// DecodeCursor parses cursor returned by Cursor.String. Cursors damaged
+// or made up by clients are reported with ErrInvalidCursor.
+func DecodeCursor(s string) (Cursor, error) {
+	if s == "" {
+		return "", nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	var c string
+	r := bytes.NewReader(b)
+	if err := gob.NewDecoder(r).Decode(&c); err != nil || c == "" || r.Len() > 0 {
+		return "", ErrInvalidCursor
+	}
+	return Cursor(c), nil
+}
+
+type errIterator struct {
+	err error
+}
+
+func (t *errIterator) Next(dst interface{}) (*Key, error) {
+	return nil, t.err
+}
+
+func (t *errIterator) Cursor() (Cursor, error) {
+	return "", t.err
+}
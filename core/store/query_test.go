@@ -0,0 +1,204 @@
+package store
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   Filter
+		ok     bool
+	}{
+		{"IsPublic=", Filter{"IsPublic", "=", true}, true},
+		{"IsPublic =", Filter{"IsPublic", "=", true}, true},
+		{" CreatedOn >= ", Filter{"CreatedOn", ">=", true}, true},
+		{"CreatedOn<=", Filter{"CreatedOn", "<=", true}, true},
+		{"CreatedOn<", Filter{"CreatedOn", "<", true}, true},
+		{"CreatedOn >", Filter{"CreatedOn", ">", true}, true},
+		{"IsPublic", Filter{}, false},
+		{"=", Filter{}, false},
+	}
+	for _, test := range tests {
+		q := NewQuery("article").Filter(test.filter, true)
+		if !test.ok {
+			if q.err == nil {
+				t.Errorf("Filter(%q) did not fail", test.filter)
+			}
+			continue
+		}
+		if q.err != nil {
+			t.Errorf("Filter(%q) failed: %v", test.filter, q.err)
+			continue
+		}
+		if got := q.GetFilters(); !reflect.DeepEqual(got, []Filter{test.want}) {
+			t.Errorf("Filter(%q) = %+v, want %+v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestQueryFilterNormalizesValue(t *testing.T) {
+	now := time.Now()
+	key := NewKey("user", "bob", 0, nil)
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{1, int64(1)},
+		{int32(2), int64(2)},
+		{float32(0.5), float64(0.5)},
+		{"s", "s"},
+		{now, now},
+		{key, key},
+	}
+	for _, test := range tests {
+		got := NewQuery("x").Filter("A=", test.value).GetFilters()[0].Value
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Filter value %#v = %#v, want %#v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestQueryOrder(t *testing.T) {
+	tests := []struct {
+		order string
+		want  Order
+		ok    bool
+	}{
+		{"CreatedOn", Order{"CreatedOn", false}, true},
+		{"-CreatedOn", Order{"CreatedOn", true}, true},
+		{" - CreatedOn", Order{"CreatedOn", true}, true},
+		{"", Order{}, false},
+		{"-", Order{}, false},
+	}
+	for _, test := range tests {
+		q := NewQuery("article").Order(test.order)
+		if !test.ok {
+			if q.err == nil {
+				t.Errorf("Order(%q) did not fail", test.order)
+			}
+			continue
+		}
+		if got := q.GetOrders(); !reflect.DeepEqual(got, []Order{test.want}) {
+			t.Errorf("Order(%q) = %+v, want %+v", test.order, got, test.want)
+		}
+	}
+}
+
+func TestQueryCopyOnWrite(t *testing.T) {
+	base := NewQuery("article").Filter("IsPublic=", true).Order("-CreatedOn")
+	a := base.Filter("Tags=", "go").Order("Title").Limit(10)
+	b := base.Filter("Tags=", "sql").Offset(5)
+
+	if len(base.GetFilters()) != 1 || len(base.GetOrders()) != 1 {
+		t.Errorf("base query changed: %+v %+v", base.GetFilters(), base.GetOrders())
+	}
+	if base.GetLimit() != -1 || base.GetOffset() != 0 {
+		t.Errorf("base query changed: limit %d, offset %d", base.GetLimit(), base.GetOffset())
+	}
+	if a.GetFilters()[1].Value != "go" || b.GetFilters()[1].Value != "sql" {
+		t.Errorf("derived queries share filters: %+v %+v", a.GetFilters(), b.GetFilters())
+	}
+	if len(a.GetOrders()) != 2 || len(b.GetOrders()) != 1 {
+		t.Errorf("derived queries share orders: %+v %+v", a.GetOrders(), b.GetOrders())
+	}
+}
+
+func TestQueryInvalidAncestor(t *testing.T) {
+	it := NewQuery("comment").Ancestor(nil).Run(nil)
+	if _, err := it.Next(nil); err != ErrInvalidKey {
+		t.Errorf("Next returned %v, want ErrInvalidKey", err)
+	}
+}
+
+type record struct {
+	Title string
+	Rank  int
+}
+
+func newRecord(t *testing.T, id int64, title string, rank int) *Record {
+	props, err := SaveStruct(&record{title, rank})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Record{Key: NewKey("record", "", id, nil), Props: props}
+}
+
+func TestRunRecordsCursor(t *testing.T) {
+	a := newRecord(t, 1, "a", 3)
+	records := []*Record{
+		a,
+		newRecord(t, 2, "b", 1),
+		newRecord(t, 3, "c", 2),
+		newRecord(t, 4, "d", 1),
+		{Key: NewKey("record", "", 5, nil)},
+		{Key: NewKey("other", "", 6, nil), Props: a.Props},
+	}
+	tests := []struct {
+		start Cursor
+		limit int
+		want  []string
+		next  Cursor
+	}{
+		{"", 2, []string{"b", "d"}, "2"},
+		{"2", 2, []string{"c", "a"}, "4"},
+		{"4", 2, nil, "4"},
+		{"1", -1, []string{"d", "c", "a"}, "4"},
+	}
+	for _, test := range tests {
+		q := NewQuery("record").Order("Rank").Start(test.start).Limit(test.limit)
+		it := RunRecords(records, q)
+		var got []string
+		for {
+			r := &record{}
+			_, err := it.Next(r)
+			if err == Done {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, r.Title)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("start %q: got %v, want %v", test.start, got, test.want)
+		}
+		if next, _ := it.Cursor(); next != test.next {
+			t.Errorf("start %q: got cursor %q, want %q", test.start, next, test.next)
+		}
+	}
+}
+
+func TestRunRecordsInvalidCursor(t *testing.T) {
+	it := RunRecords(nil, NewQuery("record").Start("x"))
+	if _, err := it.Next(nil); err != ErrInvalidCursor {
+		t.Errorf("Next returned %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestCursorString(t *testing.T) {
+	for _, c := range []Cursor{"", "0", "42", "\x00binary\xff/+="} {
+		s := c.String()
+		if strings.ContainsAny(s, "/+=") {
+			t.Errorf("Cursor(%q).String() = %q is not URL safe", c, s)
+		}
+		got, err := DecodeCursor(s)
+		if err != nil {
+			t.Errorf("DecodeCursor(%q) failed: %v", s, err)
+			continue
+		}
+		if got != c {
+			t.Errorf("DecodeCursor(%q) = %q, want %q", s, got, c)
+		}
+	}
+
+	valid := Cursor("42").String()
+	for _, s := range []string{"!!!", "42", "aGVsbG8", valid[:len(valid)-2], valid + "AA"} {
+		if c, err := DecodeCursor(s); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q) = %q, %v, want ErrInvalidCursor", s, c, err)
+		}
+	}
+}
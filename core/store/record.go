@@ -0,0 +1,165 @@
+package store
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Record is an entity loaded into memory. Backends that can't run
+// a query natively use RunRecords to evaluate it over records.
+type Record struct {
+	Key   *Key
+	Props []Property
+}
+
+// RunRecords applies ancestor, filters, orders, start cursor, offset and
+// limit of the query to the records. Records that miss sort properties
+// are skipped like in datastore. Cursors are positions in the result.
+func RunRecords(records []*Record, q *Query) Iterator {
+	matched := make([]*Record, 0, len(records))
+	for _, rec := range records {
+		if rec.Key.Kind() != q.kind {
+			continue
+		}
+		if q.ancestor != nil && !rec.Key.HasAncestor(q.ancestor) {
+			continue
+		}
+		if matches(rec, q) {
+			matched = append(matched, rec)
+		}
+	}
+	sort.Sort(&byOrders{matched, q.orders})
+
+	pos := 0
+	if q.start != "" {
+		n, err := strconv.Atoi(string(q.start))
+		if err != nil || n < 0 {
+			return &errIterator{ErrInvalidCursor}
+		}
+		pos = n
+	}
+	pos += q.offset
+
+	end := len(matched)
+	if q.limit >= 0 && pos+q.limit < end {
+		end = pos + q.limit
+	}
+	return &recordIterator{records: matched, pos: pos, end: end}
+}
+
+func matches(rec *Record, q *Query) bool {
+	for _, f := range q.filters {
+		if !f.Match(rec.Props) {
+			return false
+		}
+	}
+	for _, o := range q.orders {
+		if len(Values(rec.Props, o.Field)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type byOrders struct {
+	records []*Record
+	orders  []Order
+}
+
+func (s *byOrders) Len() int {
+	return len(s.records)
+}
+
+func (s *byOrders) Swap(i, j int) {
+	s.records[i], s.records[j] = s.records[j], s.records[i]
+}
+
+func (s *byOrders) Less(i, j int) bool {
+	a, b := s.records[i], s.records[j]
+	for _, o := range s.orders {
+		cmp := Compare(Values(a.Props, o.Field)[0], Values(b.Props, o.Field)[0])
+		if o.Descending {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return Compare(a.Key, b.Key) < 0
+}
+
+type recordIterator struct {
+	records []*Record
+	pos     int
+	end     int
+}
+
+func (t *recordIterator) Next(dst interface{}) (*Key, error) {
+	if t.pos >= t.end {
+		return nil, Done
+	}
+	rec := t.records[t.pos]
+	t.pos++
+	if dst != nil {
+		if err := LoadStruct(dst, rec.Props); err != nil {
+			return nil, err
+		}
+	}
+	return rec.Key, nil
+}
+
+func (t *recordIterator) Cursor() (Cursor, error) {
+	return Cursor(strconv.Itoa(t.pos)), nil
+}
+
+// ----------------------------------------------------------------------------
+
+type stdContext struct {
+	store Store
+	cache Cache
+	req   *http.Request
+}
+
+// NewStdContext returns context that uses given store and cache and
+// writes messages to the standard logger.
+func NewStdContext(s Store, cache Cache, r *http.Request) Context {
+	return &stdContext{store: s, cache: cache, req: r}
+}
+
+func (c *stdContext) Store() Store {
+	return c.store
+}
+
+func (c *stdContext) Cache() Cache {
+	return c.cache
+}
+
+func (c *stdContext) Request() *http.Request {
+	return c.req
+}
+
+func (c *stdContext) logf(level, format string, args []interface{}) {
+	log.Printf(level+": "+format, args...)
+}
+
+func (c *stdContext) Debugf(format string, args ...interface{}) {
+	c.logf("DEBUG", format, args)
+}
+
+func (c *stdContext) Infof(format string, args ...interface{}) {
+	c.logf("INFO", format, args)
+}
+
+func (c *stdContext) Warningf(format string, args ...interface{}) {
+	c.logf("WARNING", format, args)
+}
+
+func (c *stdContext) Errorf(format string, args ...interface{}) {
+	c.logf("ERROR", format, args)
+}
+
+func (c *stdContext) Criticalf(format string, args ...interface{}) {
+	c.logf("CRITICAL", format, args)
+}
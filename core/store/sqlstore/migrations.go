@@ -0,0 +1,237 @@
+package sqlstore
+
+import (
+	"strings"
+	"time"
+)
+
+// migration is a list of steps; each step is either SQL statement
+// or a function run inside migration transaction.
+type migration []interface{}
+
+// migrations must only be appended to: the position of the migration
+// in the list is its schema version. "{{blob}}" is replaced with binary
+// column type of the database.
+var migrations = []migration{
+	// 1: initial schema
+	{
+		`CREATE TABLE sequences (
+			name TEXT PRIMARY KEY,
+			value BIGINT NOT NULL
+		)`,
+		`INSERT INTO sequences (name, value) VALUES ('id', 0)`,
+		`CREATE TABLE entities (
+			path TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			props {{blob}} NOT NULL
+		)`,
+		`CREATE INDEX entities_kind ON entities (kind)`,
+		`CREATE TABLE articles (
+			path TEXT PRIMARY KEY,
+			props {{blob}} NOT NULL,
+			created_on BIGINT,
+			is_public BOOLEAN
+		)`,
+		`CREATE INDEX articles_is_public_created_on ON articles (is_public, created_on)`,
+		`CREATE TABLE users (
+			path TEXT PRIMARY KEY,
+			props {{blob}} NOT NULL,
+			user_id TEXT
+		)`,
+		`CREATE INDEX users_user_id ON users (user_id)`,
+	},
+	// 2: scheduled articles
+	{
+		`ALTER TABLE articles ADD COLUMN is_scheduled BOOLEAN`,
+		`ALTER TABLE articles ADD COLUMN publish_at BIGINT`,
+		`CREATE INDEX articles_is_scheduled_publish_at ON articles (is_scheduled, publish_at)`,
+		reindex("article", "is_scheduled", "publish_at"),
+	},
+	// 3: article authors
+	{
+		`ALTER TABLE articles ADD COLUMN author_key TEXT`,
+		`CREATE INDEX articles_author_key_created_on ON articles (author_key, created_on)`,
+		reindex("article", "author_key"),
+	},
+	// 4: listings ordered by publication time, zero times stored as 0
+	{
+		`CREATE INDEX articles_is_public_publish_at ON articles (is_public, publish_at)`,
+		`CREATE INDEX articles_author_key_publish_at ON articles (author_key, publish_at)`,
+		reindex("article", "created_on", "publish_at"),
+	},
+	// 5: queried kinds moved from entities to their own tables, list
+	// columns for tags and search terms
+	{
+		`CREATE TABLE articles_tags (
+			path TEXT NOT NULL,
+			value TEXT NOT NULL
+		)`,
+		`CREATE INDEX articles_tags_value ON articles_tags (value)`,
+		`CREATE INDEX articles_tags_path ON articles_tags (path)`,
+		reindex("article", "tags"),
+
+		`CREATE TABLE api_tokens (
+			path TEXT PRIMARY KEY,
+			props {{blob}} NOT NULL,
+			hash TEXT,
+			user_key TEXT,
+			created_on BIGINT
+		)`,
+		`CREATE INDEX api_tokens_hash ON api_tokens (hash)`,
+		`CREATE INDEX api_tokens_user_key_created_on ON api_tokens (user_key, created_on)`,
+		moveEntities("apiToken"),
+
+		`CREATE TABLE comments (
+			path TEXT PRIMARY KEY,
+			props {{blob}} NOT NULL,
+			status TEXT,
+			author_key TEXT,
+			created_on BIGINT
+		)`,
+		`CREATE INDEX comments_status_created_on ON comments (status, created_on)`,
+		`CREATE INDEX comments_author_key_status_created_on ON comments (author_key, status, created_on)`,
+		moveEntities("comment"),
+
+		`CREATE TABLE article_revisions (
+			path TEXT PRIMARY KEY,
+			props {{blob}} NOT NULL,
+			created_on BIGINT
+		)`,
+		moveEntities("articleRevision"),
+
+		`CREATE TABLE search_docs (
+			path TEXT PRIMARY KEY,
+			props {{blob}} NOT NULL,
+			is_public BOOLEAN,
+			created_on BIGINT
+		)`,
+		`CREATE TABLE search_docs_terms (
+			path TEXT NOT NULL,
+			value TEXT NOT NULL
+		)`,
+		`CREATE INDEX search_docs_terms_value ON search_docs_terms (value)`,
+		`CREATE INDEX search_docs_terms_path ON search_docs_terms (path)`,
+		moveEntities("searchDoc"),
+	},
+}
+
+func (s *Store) schemaVersion() (int, error) {
+	err := s.exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		applied_on BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = s.queryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// migrate applies pending migrations, each in its own transaction.
+func (s *Store) migrate() error {
+	version, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		err := s.inTransaction(func(s *Store) error {
+			for _, step := range migrations[i] {
+				var err error
+				switch step := step.(type) {
+				case string:
+					err = s.exec(strings.Replace(step, "{{blob}}", s.dialect.blobType, -1))
+				case func(*Store) error:
+					err = step(s)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return s.exec(
+				`INSERT INTO schema_migrations (version, applied_on) VALUES (?, ?)`,
+				i+1, time.Now().Unix())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reindex returns migration step that fills newly added columns
+// of the table from stored properties.
+func reindex(kind string, columns ...string) func(*Store) error {
+	return func(s *Store) error {
+		t := tables[kind]
+		rows, err := s.query(`SELECT path, props FROM ` + t.name)
+		if err != nil {
+			return err
+		}
+		records, err := scanRecords(rows)
+		if err != nil {
+			return err
+		}
+
+		// plain columns are updated in place, list columns are
+		// rewritten by writeLists
+		var plain []column
+		lists := &table{name: t.name}
+		for _, name := range columns {
+			for _, col := range t.columns {
+				if col.name != name {
+					continue
+				}
+				if col.isList {
+					lists.columns = append(lists.columns, col)
+				} else {
+					plain = append(plain, col)
+				}
+			}
+		}
+
+		for _, rec := range records {
+			if len(plain) > 0 {
+				var set []string
+				var args []interface{}
+				for _, col := range plain {
+					set = append(set, col.name+" = ?")
+					args = append(args, columnValue(rec.Props, col.property))
+				}
+				args = append(args, rec.Key.String())
+				err := s.exec(`UPDATE `+t.name+` SET `+strings.Join(set, ", ")+` WHERE path = ?`, args...)
+				if err != nil {
+					return err
+				}
+			}
+			if err := s.writeLists(lists, rec.Key.String(), rec.Props); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// moveEntities returns migration step that moves entities of the kind
+// from the entities table to the table of the kind and fills its
+// columns.
+func moveEntities(kind string) func(*Store) error {
+	return func(s *Store) error {
+		t := tables[kind]
+		err := s.exec(`INSERT INTO `+t.name+` (path, props) SELECT path, props FROM `+entitiesTable+` WHERE kind = ?`, kind)
+		if err != nil {
+			return err
+		}
+		if err := s.exec(`DELETE FROM `+entitiesTable+` WHERE kind = ?`, kind); err != nil {
+			return err
+		}
+
+		columns := make([]string, len(t.columns))
+		for i, col := range t.columns {
+			columns[i] = col.name
+		}
+		return reindex(kind, columns...)(s)
+	}
+}
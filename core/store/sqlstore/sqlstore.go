@@ -0,0 +1,692 @@
+// Package sqlstore implements store backend on top of database/sql.
+//
+// Kinds the application queries are mapped to their own tables with
+// indexed columns, so listings are served by SQL queries with keyset
+// cursors. Entities of other kinds are kept in the generic entities table
+// and queried in memory. Schema is created and upgraded automatically by
+// Open.
+package sqlstore
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"core/cache"
+	"core/store"
+)
+
+// CACHE_SIZE is number of items kept in the in-process cache.
+const CACHE_SIZE = 10000
+
+func init() {
+	gob.Register(time.Time{})
+	gob.Register(&store.Key{})
+}
+
+type dialect struct {
+	blobType string
+	// noLimit is LIMIT clause used when only OFFSET is needed.
+	noLimit     string
+	numberedArg bool
+	singleConn  bool
+}
+
+var dialects = map[string]*dialect{
+	"sqlite3": {
+		blobType:   "BLOB",
+		noLimit:    "LIMIT -1",
+		singleConn: true,
+	},
+	"postgres": {
+		blobType:    "BYTEA",
+		noLimit:     "LIMIT ALL",
+		numberedArg: true,
+	},
+}
+
+// rebind replaces "?" placeholders with "$N" for databases that need it.
+func (d *dialect) rebind(query string) string {
+	if !d.numberedArg {
+		return query
+	}
+	b := &bytes.Buffer{}
+	n := 0
+	for _, ch := range query {
+		if ch == '?' {
+			n++
+			fmt.Fprintf(b, "$%d", n)
+			continue
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
+
+type column struct {
+	property string
+	name     string
+	// isList column holds values of multi-valued property in table
+	// <table>_<column> with row per value. It can only be filtered by
+	// equality.
+	isList bool
+}
+
+type table struct {
+	name    string
+	columns []column
+}
+
+func (t *table) column(property string) *column {
+	for i := range t.columns {
+		if t.columns[i].property == property {
+			return &t.columns[i]
+		}
+	}
+	return nil
+}
+
+func (t *table) listTable(col *column) string {
+	return t.name + "_" + col.name
+}
+
+// canRun reports whether the query can be translated to SQL.
+func (t *table) canRun(q *store.Query) bool {
+	for _, f := range q.GetFilters() {
+		col := t.column(f.Field)
+		if col == nil || col.isList && f.Operator != "=" {
+			return false
+		}
+	}
+	for _, o := range q.GetOrders() {
+		col := t.column(o.Field)
+		if col == nil || col.isList {
+			return false
+		}
+	}
+	return true
+}
+
+// tables maps kinds to tables. Keep it in sync with migrations.
+var tables = map[string]*table{
+	// blog.ARTICLE_KIND
+	"article": {
+		name: "articles",
+		columns: []column{
+			{"CreatedOn", "created_on", false},
+			{"IsPublic", "is_public", false},
+			{"IsScheduled", "is_scheduled", false},
+			{"PublishAt", "publish_at", false},
+			{"AuthorKey", "author_key", false},
+			{"Tags", "tags", true},
+		},
+	},
+	// auth.USER_KIND
+	"user": {
+		name: "users",
+		columns: []column{
+			{"UserId", "user_id", false},
+		},
+	},
+	// auth.API_TOKEN_KIND
+	"apiToken": {
+		name: "api_tokens",
+		columns: []column{
+			{"Hash", "hash", false},
+			{"UserKey", "user_key", false},
+			{"CreatedOn", "created_on", false},
+		},
+	},
+	// blog.COMMENT_KIND
+	"comment": {
+		name: "comments",
+		columns: []column{
+			{"Status", "status", false},
+			{"AuthorKey", "author_key", false},
+			{"CreatedOn", "created_on", false},
+		},
+	},
+	// blog.ARTICLE_REVISION_KIND
+	"articleRevision": {
+		name: "article_revisions",
+		columns: []column{
+			{"CreatedOn", "created_on", false},
+		},
+	},
+	// blog.SEARCH_DOC_KIND
+	"searchDoc": {
+		name: "search_docs",
+		columns: []column{
+			{"IsPublic", "is_public", false},
+			{"CreatedOn", "created_on", false},
+			{"Terms", "terms", true},
+		},
+	},
+}
+
+const entitiesTable = "entities"
+
+// sqlValue converts property value to the value stored in a column.
+// Times are stored as nanoseconds to keep ordering portable. Zero time
+// doesn't fit in nanoseconds and is stored as 0, so it still goes
+// before other times.
+func sqlValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case time.Time:
+		if x.IsZero() {
+			return int64(0)
+		}
+		return x.UnixNano()
+	case *store.Key:
+		if x == nil {
+			return nil
+		}
+		return x.String()
+	}
+	return v
+}
+
+func columnValue(props []store.Property, property string) interface{} {
+	values := store.Values(props, property)
+	if len(values) == 0 {
+		return nil
+	}
+	return sqlValue(values[0])
+}
+
+func encodeProps(props []store.Property) ([]byte, error) {
+	props = append([]store.Property(nil), props...)
+	for i := range props {
+		// gob can't encode nil pointer inside interface
+		if key, ok := props[i].Value.(*store.Key); ok && key == nil {
+			props[i].Value = nil
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(props); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeProps(b []byte) ([]store.Property, error) {
+	var props []store.Property
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&props); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// ----------------------------------------------------------------------------
+
+type Backend struct {
+	store *Store
+	cache store.Cache
+}
+
+// Open opens database and migrates it to the latest schema. driverName
+// must be "sqlite3" or "postgres"; the driver itself must be imported
+// by the caller.
+func Open(driverName, dataSourceName string) (*Backend, error) {
+	d, ok := dialects[driverName]
+	if !ok {
+		return nil, fmt.Errorf("sqlstore: unsupported driver %q", driverName)
+	}
+
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	if d.singleConn {
+		// SQLite does not support concurrent writers.
+		db.SetMaxOpenConns(1)
+	}
+
+	s := &Store{db: db, q: db, dialect: d}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Backend{
+		store: s,
+		cache: cache.NewLRU(CACHE_SIZE),
+	}, nil
+}
+
+func (b *Backend) NewContext(r *http.Request) store.Context {
+	return store.NewStdContext(b.store, b.cache, r)
+}
+
+func (b *Backend) Close() error {
+	return b.store.db.Close()
+}
+
+// ----------------------------------------------------------------------------
+
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type Store struct {
+	db      *sql.DB
+	q       querier
+	tx      *sql.Tx
+	dialect *dialect
+}
+
+func (s *Store) exec(query string, args ...interface{}) error {
+	_, err := s.q.Exec(s.dialect.rebind(query), args...)
+	return err
+}
+
+func (s *Store) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.q.QueryRow(s.dialect.rebind(query), args...)
+}
+
+func (s *Store) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.q.Query(s.dialect.rebind(query), args...)
+}
+
+func (s *Store) inTransaction(f func(s *Store) error) error {
+	if s.tx != nil {
+		return f(s)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(&Store{db: s.db, q: tx, tx: tx, dialect: s.dialect}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) RunInTransaction(c store.Context, f func(tc store.Context) error) error {
+	return s.inTransaction(func(s *Store) error {
+		return f(store.NewStdContext(s, c.Cache(), c.Request()))
+	})
+}
+
+func (s *Store) allocateID() (int64, error) {
+	var id int64
+	err := s.inTransaction(func(s *Store) error {
+		if err := s.exec(`UPDATE sequences SET value = value + 1 WHERE name = 'id'`); err != nil {
+			return err
+		}
+		return s.queryRow(`SELECT value FROM sequences WHERE name = 'id'`).Scan(&id)
+	})
+	return id, err
+}
+
+func tableName(kind string) string {
+	if t, ok := tables[kind]; ok {
+		return t.name
+	}
+	return entitiesTable
+}
+
+func (s *Store) Get(key *store.Key, dst interface{}) error {
+	var data []byte
+	err := s.queryRow(
+		`SELECT props FROM `+tableName(key.Kind())+` WHERE path = ?`, key.String(),
+	).Scan(&data)
+	if err == sql.ErrNoRows {
+		return store.ErrNoSuchEntity
+	}
+	if err != nil {
+		return err
+	}
+
+	props, err := decodeProps(data)
+	if err != nil {
+		return err
+	}
+	return store.LoadStruct(dst, props)
+}
+
+func (s *Store) Put(key *store.Key, src interface{}) (*store.Key, error) {
+	props, err := store.SaveStruct(src)
+	if err != nil {
+		return nil, err
+	}
+	data, err := encodeProps(props)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Incomplete() {
+		id, err := s.allocateID()
+		if err != nil {
+			return nil, err
+		}
+		key = store.NewKey(key.Kind(), "", id, key.Parent())
+	}
+
+	names := []string{"path", "props"}
+	values := []interface{}{key.String(), data}
+	t, ok := tables[key.Kind()]
+	if ok {
+		for _, col := range t.columns {
+			if col.isList {
+				continue
+			}
+			names = append(names, col.name)
+			values = append(values, columnValue(props, col.property))
+		}
+	} else {
+		t = &table{name: entitiesTable}
+		names = append(names, "kind")
+		values = append(values, key.Kind())
+	}
+
+	updates := make([]string, 0, len(names)-1)
+	for _, name := range names[1:] {
+		updates = append(updates, name+" = excluded."+name)
+	}
+	err = s.inTransaction(func(s *Store) error {
+		err := s.exec(fmt.Sprintf(
+			`INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (path) DO UPDATE SET %s`,
+			t.name,
+			strings.Join(names, ", "),
+			strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", "),
+			strings.Join(updates, ", "),
+		), values...)
+		if err != nil {
+			return err
+		}
+		return s.writeLists(t, key.String(), props)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// writeLists replaces rows of list columns of the entity.
+func (s *Store) writeLists(t *table, path string, props []store.Property) error {
+	for i := range t.columns {
+		col := &t.columns[i]
+		if !col.isList {
+			continue
+		}
+		if err := s.exec(`DELETE FROM `+t.listTable(col)+` WHERE path = ?`, path); err != nil {
+			return err
+		}
+		for _, v := range store.Values(props, col.property) {
+			err := s.exec(`INSERT INTO `+t.listTable(col)+` (path, value) VALUES (?, ?)`, path, sqlValue(v))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) Delete(key *store.Key) error {
+	return s.inTransaction(func(s *Store) error {
+		if t, ok := tables[key.Kind()]; ok {
+			if err := s.writeLists(t, key.String(), nil); err != nil {
+				return err
+			}
+		}
+		return s.exec(`DELETE FROM `+tableName(key.Kind())+` WHERE path = ?`, key.String())
+	})
+}
+
+func (s *Store) Run(q *store.Query) store.Iterator {
+	if t, ok := tables[q.GetKind()]; ok && t.canRun(q) {
+		it, err := s.runSQL(t, q)
+		if err != nil {
+			return errIterator{err}
+		}
+		return it
+	}
+
+	records, err := s.loadRecords(q)
+	if err != nil {
+		return errIterator{err}
+	}
+	return store.RunRecords(records, q)
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// ancestorWhere returns condition matching the ancestor and entities
+// under it.
+func ancestorWhere(ancestor *store.Key) (string, []interface{}) {
+	return `(path = ? OR path LIKE ? ESCAPE '\')`,
+		[]interface{}{ancestor.String(), escapeLike(ancestor.String()) + "/%"}
+}
+
+// loadRecords loads all entities that can match the query. Filters on
+// columns of the kind are applied in SQL.
+func (s *Store) loadRecords(q *store.Query) ([]*store.Record, error) {
+	var where []string
+	var args []interface{}
+
+	name := tableName(q.GetKind())
+	if name == entitiesTable {
+		where = append(where, "kind = ?")
+		args = append(args, q.GetKind())
+	}
+	if ancestor := q.GetAncestor(); ancestor != nil {
+		cond, condArgs := ancestorWhere(ancestor)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+	if t, ok := tables[q.GetKind()]; ok {
+		for _, f := range q.GetFilters() {
+			if col := t.column(f.Field); col != nil && (!col.isList || f.Operator == "=") {
+				where = append(where, t.filterWhere(col, f.Operator))
+				args = append(args, sqlValue(f.Value))
+			}
+		}
+	}
+
+	query := `SELECT path, props FROM ` + name
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func scanRecords(rows *sql.Rows) ([]*store.Record, error) {
+	defer rows.Close()
+
+	var records []*store.Record
+	for rows.Next() {
+		var path string
+		var data []byte
+		if err := rows.Scan(&path, &data); err != nil {
+			return nil, err
+		}
+		key, err := store.ParseKey(path)
+		if err != nil {
+			return nil, err
+		}
+		props, err := decodeProps(data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, &store.Record{Key: key, Props: props})
+	}
+	return records, rows.Err()
+}
+
+// ----------------------------------------------------------------------------
+
+// cursor points after the row with given sort values and path.
+type cursor struct {
+	Values []interface{}
+	Path   string
+}
+
+func (c *cursor) encode() (store.Cursor, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(c); err != nil {
+		return "", err
+	}
+	return store.Cursor(buf.String()), nil
+}
+
+func decodeCursor(s store.Cursor) (*cursor, error) {
+	c := &cursor{}
+	if err := gob.NewDecoder(strings.NewReader(string(s))).Decode(c); err != nil {
+		return nil, store.ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// filterWhere returns condition of filter on the column.
+func (t *table) filterWhere(col *column, operator string) string {
+	if col.isList {
+		return "path IN (SELECT path FROM " + t.listTable(col) + " WHERE value = ?)"
+	}
+	return col.name + " " + operator + " ?"
+}
+
+func (s *Store) runSQL(t *table, q *store.Query) (store.Iterator, error) {
+	var where []string
+	var args []interface{}
+
+	if ancestor := q.GetAncestor(); ancestor != nil {
+		cond, condArgs := ancestorWhere(ancestor)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+	for _, f := range q.GetFilters() {
+		where = append(where, t.filterWhere(t.column(f.Field), f.Operator))
+		args = append(args, sqlValue(f.Value))
+	}
+
+	orders := q.GetOrders()
+	orderBy := make([]string, 0, len(orders)+1)
+	for _, o := range orders {
+		name := t.column(o.Field).name
+		where = append(where, name+" IS NOT NULL")
+		if o.Descending {
+			orderBy = append(orderBy, name+" DESC")
+		} else {
+			orderBy = append(orderBy, name)
+		}
+	}
+	orderBy = append(orderBy, "path")
+
+	if start := q.GetStart(); start != "" {
+		c, err := decodeCursor(start)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.Values) != len(orders) {
+			return nil, store.ErrInvalidCursor
+		}
+
+		// (a > ?) OR (a = ? AND b > ?) OR ... OR (a = ? AND b = ? AND path > ?)
+		var or []string
+		for i := 0; i <= len(orders); i++ {
+			var and []string
+			for j := 0; j < i; j++ {
+				and = append(and, t.column(orders[j].Field).name+" = ?")
+				args = append(args, c.Values[j])
+			}
+			if i < len(orders) {
+				op := " > ?"
+				if orders[i].Descending {
+					op = " < ?"
+				}
+				and = append(and, t.column(orders[i].Field).name+op)
+				args = append(args, c.Values[i])
+			} else {
+				and = append(and, "path > ?")
+				args = append(args, c.Path)
+			}
+			or = append(or, "("+strings.Join(and, " AND ")+")")
+		}
+		where = append(where, "("+strings.Join(or, " OR ")+")")
+	}
+
+	query := `SELECT path, props FROM ` + t.name
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY ` + strings.Join(orderBy, ", ")
+	if limit := q.GetLimit(); limit >= 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	} else if q.GetOffset() > 0 {
+		query += " " + s.dialect.noLimit
+	}
+	if offset := q.GetOffset(); offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", offset)
+	}
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	records, err := scanRecords(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &iterator{records: records, orders: orders, start: q.GetStart()}, nil
+}
+
+type iterator struct {
+	records []*store.Record
+	orders  []store.Order
+	start   store.Cursor
+	pos     int
+}
+
+func (t *iterator) Next(dst interface{}) (*store.Key, error) {
+	if t.pos >= len(t.records) {
+		return nil, store.Done
+	}
+	rec := t.records[t.pos]
+	t.pos++
+	if dst != nil {
+		if err := store.LoadStruct(dst, rec.Props); err != nil {
+			return nil, err
+		}
+	}
+	return rec.Key, nil
+}
+
+func (t *iterator) Cursor() (store.Cursor, error) {
+	if t.pos == 0 {
+		return t.start, nil
+	}
+	rec := t.records[t.pos-1]
+	c := &cursor{Path: rec.Key.String()}
+	for _, o := range t.orders {
+		c.Values = append(c.Values, columnValue(rec.Props, o.Field))
+	}
+	return c.encode()
+}
+
+type errIterator struct {
+	err error
+}
+
+func (t errIterator) Next(dst interface{}) (*store.Key, error) {
+	return nil, t.err
+}
+
+func (t errIterator) Cursor() (store.Cursor, error) {
+	return "", t.err
+}
@@ -0,0 +1,201 @@
+package sqlstore
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"core/store"
+	"core/store/storetest"
+)
+
+func openTest(t *testing.T) *Backend {
+	b, err := Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Backend {
+		return openTest(t)
+	})
+}
+
+func TestMigrateTwice(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		b, err := Open("sqlite3", filepath.Join(dir, "test.db"))
+		if err != nil {
+			t.Fatalf("Open #%d: %v", i+1, err)
+		}
+		version, err := b.store.schemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != len(migrations) {
+			t.Errorf("got schema version %d, want %d", version, len(migrations))
+		}
+		b.Close()
+	}
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		driver string
+		query  string
+		want   string
+	}{
+		{"sqlite3", "a = ? AND b = ?", "a = ? AND b = ?"},
+		{"postgres", "a = ? AND b = ?", "a = $1 AND b = $2"},
+		{"postgres", "a = 1", "a = 1"},
+	}
+	for _, test := range tests {
+		if got := dialects[test.driver].rebind(test.query); got != test.want {
+			t.Errorf("%s rebind(%q) = %q, want %q", test.driver, test.query, got, test.want)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	key := store.NewKey("article", "", 3, nil)
+	c := &cursor{Values: []interface{}{int64(42), true, key.String()}, Path: key.String()}
+	encoded, err := c.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeCursor(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Values) != 3 || got.Values[0] != int64(42) || got.Values[1] != true || got.Path != c.Path {
+		t.Errorf("got %+v, want %+v", got, c)
+	}
+
+	for _, s := range []store.Cursor{"", "hello", encoded[:len(encoded)/2]} {
+		if _, err := decodeCursor(s); err != store.ErrInvalidCursor {
+			t.Errorf("decodeCursor(%q) returned %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+type comment struct {
+	Status    string
+	CreatedOn int64
+}
+
+type searchDoc struct {
+	Terms    []string
+	IsPublic bool
+}
+
+func TestMoveEntities(t *testing.T) {
+	all := migrations
+	migrations = all[:4]
+	b := openTest(t)
+	migrations = all
+
+	article := store.NewKey("article", "", 1, nil)
+	entities := map[*store.Key]interface{}{
+		store.NewKey("comment", "", 2, article): &comment{"approved", 2},
+		store.NewKey("comment", "", 3, article): &comment{"pending", 3},
+		store.NewKey("comment", "", 4, nil):     &comment{"approved", 4},
+		store.NewKey("searchDoc", "", 1, nil):   &searchDoc{[]string{"go", "sql"}, true},
+		store.NewKey("searchDoc", "", 5, nil):   &searchDoc{[]string{"go"}, false},
+	}
+	for key, src := range entities {
+		props, err := store.SaveStruct(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := encodeProps(props)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = b.store.exec(`INSERT INTO entities (path, kind, props) VALUES (?, ?, ?)`, key.String(), key.Kind(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.store.migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := b.store.queryRow(`SELECT COUNT(*) FROM entities`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("%d entities left in entities table, want 0", n)
+	}
+
+	c := b.NewContext(httptest.NewRequest("GET", "/", nil))
+	q := store.NewQuery("comment").Ancestor(article).Filter("Status =", "approved")
+	keys, err := q.KeysOnly().GetAll(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].IntID() != 2 {
+		t.Errorf("approved comments of the article are %v, want id 2", keys)
+	}
+
+	q = store.NewQuery("searchDoc").Filter("Terms =", "go").Filter("IsPublic =", true)
+	keys, err = q.KeysOnly().GetAll(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].IntID() != 1 {
+		t.Errorf("public documents with term are %v, want id 1", keys)
+	}
+}
+
+func TestListColumn(t *testing.T) {
+	b := openTest(t)
+	c := b.NewContext(httptest.NewRequest("GET", "/", nil))
+
+	countTags := func() int {
+		var n int
+		if err := b.store.queryRow(`SELECT COUNT(*) FROM articles_tags`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	tagged := func(tag string) int {
+		keys, err := store.NewQuery("article").Filter("Tags =", tag).KeysOnly().GetAll(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(keys)
+	}
+
+	a := &storetest.Article{Title: "a", Tags: []string{"go", "sql"}}
+	key, err := store.Put(c, store.NewIncompleteKey("article", nil), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countTags(); n != 2 {
+		t.Errorf("got %d tag rows, want 2", n)
+	}
+
+	a.Tags = []string{"rust"}
+	if _, err := store.Put(c, key, a); err != nil {
+		t.Fatal(err)
+	}
+	if n := tagged("go"); n != 0 {
+		t.Errorf("got %d articles with removed tag, want 0", n)
+	}
+	if n := tagged("rust"); n != 1 {
+		t.Errorf("got %d articles with new tag, want 1", n)
+	}
+
+	if err := store.Delete(c, key); err != nil {
+		t.Fatal(err)
+	}
+	if n := countTags(); n != 0 {
+		t.Errorf("got %d tag rows after delete, want 0", n)
+	}
+}
@@ -0,0 +1,88 @@
+// Package store abstracts persistence used by the models, so the blog
+// can run on App Engine datastore/memcache as well as on other backends.
+package store
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrNoSuchEntity      = errors.New("store: no such entity")
+	ErrInvalidEntityType = errors.New("store: invalid entity type")
+	ErrCacheMiss         = errors.New("store: cache miss")
+
+	// Done is returned by Iterator.Next when no more results are available.
+	Done = errors.New("store: query has no more results")
+)
+
+type Store interface {
+	Get(key *Key, dst interface{}) error
+	Put(key *Key, src interface{}) (*Key, error)
+	Delete(key *Key) error
+	Run(q *Query) Iterator
+	RunInTransaction(c Context, f func(tc Context) error) error
+}
+
+type Iterator interface {
+	// Next loads next result into dst and returns its key.
+	// dst may be nil for keys only queries.
+	Next(dst interface{}) (*Key, error)
+	// Cursor returns cursor pointing after the last returned result.
+	Cursor() (Cursor, error)
+}
+
+type Cache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, expiration time.Duration) error
+	Delete(key string) error
+}
+
+// Context is a per request handle to the backend. Its logging methods
+// match appengine.Context.
+type Context interface {
+	Store() Store
+	Cache() Cache
+	Request() *http.Request
+
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	Criticalf(format string, args ...interface{})
+}
+
+type Backend interface {
+	NewContext(r *http.Request) Context
+}
+
+var backend Backend
+
+// Register sets backend used by NewContext.
+func Register(b Backend) {
+	backend = b
+}
+
+func NewContext(r *http.Request) Context {
+	if backend == nil {
+		panic("store: no backend registered")
+	}
+	return backend.NewContext(r)
+}
+
+func Get(c Context, key *Key, dst interface{}) error {
+	return c.Store().Get(key, dst)
+}
+
+func Put(c Context, key *Key, src interface{}) (*Key, error) {
+	return c.Store().Put(key, src)
+}
+
+func Delete(c Context, key *Key) error {
+	return c.Store().Delete(key)
+}
+
+func RunInTransaction(c Context, f func(tc Context) error) error {
+	return c.Store().RunInTransaction(c, f)
+}
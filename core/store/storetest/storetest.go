@@ -0,0 +1,382 @@
+// Package storetest implements tests every store backend must pass,
+// so backends behave the same and models can switch between them.
+package storetest
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"core/store"
+)
+
+// Article uses kind and properties that SQL backends map to their own
+// columns. Note is stored as a generic entity.
+type Article struct {
+	Title     string
+	CreatedOn time.Time
+	IsPublic  bool
+	AuthorKey *store.Key
+	Tags      []string
+}
+
+type Note struct {
+	Title     string
+	CreatedOn time.Time
+	IsPublic  bool
+	Text      []byte
+}
+
+var baseTime = time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func day(n int) time.Time {
+	return baseTime.AddDate(0, 0, n)
+}
+
+// Run runs the test suite against backends returned by newBackend. Every
+// test gets a new empty backend.
+func Run(t *testing.T, newBackend func(t *testing.T) store.Backend) {
+	tests := []struct {
+		name string
+		f    func(t *testing.T, c store.Context)
+	}{
+		{"PutGet", testPutGet},
+		{"Delete", testDelete},
+		{"Transaction", testTransaction},
+		{"Query", testQuery},
+		{"Ancestor", testAncestor},
+		{"ZeroTime", testZeroTime},
+		{"Cursor", testCursor},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			b := newBackend(t)
+			test.f(t, b.NewContext(httptest.NewRequest("GET", "/", nil)))
+		})
+	}
+}
+
+func testPutGet(t *testing.T, c store.Context) {
+	author := store.NewKey("user", "bob", 0, nil)
+	src := &Article{
+		Title:     "Hello",
+		CreatedOn: day(1),
+		IsPublic:  true,
+		AuthorKey: author,
+		Tags:      []string{"go", "blog"},
+	}
+
+	key, err := store.Put(c, store.NewIncompleteKey("article", nil), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Incomplete() {
+		t.Fatalf("Put returned incomplete key %v", key)
+	}
+
+	dst := &Article{}
+	if err := store.Get(c, key, dst); err != nil {
+		t.Fatal(err)
+	}
+	if !dst.CreatedOn.Equal(src.CreatedOn) {
+		t.Errorf("got CreatedOn %v, want %v", dst.CreatedOn, src.CreatedOn)
+	}
+	dst.CreatedOn = src.CreatedOn
+	if !reflect.DeepEqual(dst, src) {
+		t.Errorf("got %+v, want %+v", dst, src)
+	}
+
+	other, err := store.Put(c, store.NewIncompleteKey("article", nil), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Equal(key) {
+		t.Errorf("Put allocated %v twice", key)
+	}
+
+	src.Title = "Updated"
+	if _, err := store.Put(c, key, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Get(c, key, dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Title != "Updated" {
+		t.Errorf("got title %q after update, want %q", dst.Title, "Updated")
+	}
+
+	note := &Note{Title: "note", Text: []byte{0, 1, 2}}
+	noteKey := store.NewKey("note", "first", 0, key)
+	if _, err := store.Put(c, noteKey, note); err != nil {
+		t.Fatal(err)
+	}
+	gotNote := &Note{}
+	if err := store.Get(c, noteKey, gotNote); err != nil {
+		t.Fatal(err)
+	}
+	if gotNote.Title != note.Title || string(gotNote.Text) != string(note.Text) {
+		t.Errorf("got %+v, want %+v", gotNote, note)
+	}
+
+	err = store.Get(c, store.NewKey("article", "", 1000, nil), dst)
+	if err != store.ErrNoSuchEntity {
+		t.Errorf("Get of missing entity returned %v, want ErrNoSuchEntity", err)
+	}
+}
+
+func testDelete(t *testing.T, c store.Context) {
+	for _, kind := range []string{"article", "note"} {
+		key, err := store.Put(c, store.NewIncompleteKey(kind, nil), &Note{Title: kind})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete(c, key); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Get(c, key, &Note{}); err != store.ErrNoSuchEntity {
+			t.Errorf("%s: Get after Delete returned %v, want ErrNoSuchEntity", kind, err)
+		}
+		if err := store.Delete(c, key); err != nil {
+			t.Errorf("%s: Delete of missing entity returned %v", kind, err)
+		}
+	}
+}
+
+func testTransaction(t *testing.T, c store.Context) {
+	key := store.NewKey("note", "counter", 0, nil)
+	err := store.RunInTransaction(c, func(tc store.Context) error {
+		_, err := store.Put(tc, key, &Note{Title: "committed"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	note := &Note{}
+	if err := store.Get(c, key, note); err != nil {
+		t.Fatal(err)
+	}
+	if note.Title != "committed" {
+		t.Errorf("got title %q, want %q", note.Title, "committed")
+	}
+
+	errFail := errors.New("fail")
+	err = store.RunInTransaction(c, func(tc store.Context) error {
+		return errFail
+	})
+	if err != errFail {
+		t.Errorf("RunInTransaction returned %v, want %v", err, errFail)
+	}
+}
+
+// putFixtures stores the same entities under both kinds. Sort values are
+// unique, so results do not depend on how backends break ties.
+func putFixtures(t *testing.T, c store.Context) {
+	alice := store.NewKey("user", "alice", 0, nil)
+	bob := store.NewKey("user", "bob", 0, nil)
+	articles := []*Article{
+		{Title: "a", CreatedOn: day(3), IsPublic: true, AuthorKey: alice, Tags: []string{"go"}},
+		{Title: "b", CreatedOn: day(1), IsPublic: false, AuthorKey: bob, Tags: []string{"go", "sql"}},
+		{Title: "c", CreatedOn: day(5), IsPublic: true, AuthorKey: bob},
+		{Title: "d", CreatedOn: day(2), IsPublic: true, AuthorKey: alice, Tags: []string{"sql"}},
+		{Title: "e", CreatedOn: day(4), IsPublic: false, AuthorKey: alice},
+	}
+
+	for _, a := range articles {
+		if _, err := store.Put(c, store.NewIncompleteKey("article", nil), a); err != nil {
+			t.Fatal(err)
+		}
+		note := &Note{Title: a.Title, CreatedOn: a.CreatedOn, IsPublic: a.IsPublic}
+		if _, err := store.Put(c, store.NewIncompleteKey("note", nil), note); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func titles(t *testing.T, c store.Context, q *store.Query) []string {
+	var notes []*Note
+	if _, err := q.GetAll(c, &notes); err != nil {
+		t.Fatal(err)
+	}
+	result := make([]string, 0, len(notes))
+	for _, n := range notes {
+		result = append(result, n.Title)
+	}
+	return result
+}
+
+func testQuery(t *testing.T, c store.Context) {
+	putFixtures(t, c)
+
+	tests := []struct {
+		name  string
+		query func(q *store.Query) *store.Query
+		want  []string
+	}{
+		{"all by key", func(q *store.Query) *store.Query { return q }, []string{"a", "b", "c", "d", "e"}},
+		{"order", func(q *store.Query) *store.Query { return q.Order("CreatedOn") }, []string{"b", "d", "a", "e", "c"}},
+		{"order desc", func(q *store.Query) *store.Query { return q.Order("-CreatedOn") }, []string{"c", "e", "a", "d", "b"}},
+		{"filter eq", func(q *store.Query) *store.Query {
+			return q.Filter("IsPublic=", true).Order("-CreatedOn")
+		}, []string{"c", "a", "d"}},
+		{"filter lt", func(q *store.Query) *store.Query {
+			return q.Filter("CreatedOn <", day(3)).Order("CreatedOn")
+		}, []string{"b", "d"}},
+		{"filter le", func(q *store.Query) *store.Query {
+			return q.Filter("CreatedOn <=", day(3)).Order("CreatedOn")
+		}, []string{"b", "d", "a"}},
+		{"filter gt", func(q *store.Query) *store.Query {
+			return q.Filter("CreatedOn >", day(3)).Order("CreatedOn")
+		}, []string{"e", "c"}},
+		{"filter ge", func(q *store.Query) *store.Query {
+			return q.Filter("CreatedOn >=", day(3)).Order("CreatedOn")
+		}, []string{"a", "e", "c"}},
+		{"filter range", func(q *store.Query) *store.Query {
+			return q.Filter("CreatedOn >", day(1)).Filter("CreatedOn <", day(5)).Order("-CreatedOn")
+		}, []string{"e", "a", "d"}},
+		{"several orders", func(q *store.Query) *store.Query {
+			return q.Order("IsPublic").Order("-CreatedOn")
+		}, []string{"e", "b", "c", "a", "d"}},
+		{"limit", func(q *store.Query) *store.Query { return q.Order("CreatedOn").Limit(2) }, []string{"b", "d"}},
+		{"offset", func(q *store.Query) *store.Query { return q.Order("CreatedOn").Offset(3) }, []string{"e", "c"}},
+		{"limit offset", func(q *store.Query) *store.Query {
+			return q.Order("CreatedOn").Offset(1).Limit(2)
+		}, []string{"d", "a"}},
+		{"offset past end", func(q *store.Query) *store.Query { return q.Offset(10) }, []string{}},
+		{"no matches", func(q *store.Query) *store.Query { return q.Filter("Title=", "x") }, []string{}},
+		{"missing order property", func(q *store.Query) *store.Query { return q.Order("Missing") }, []string{}},
+	}
+	for _, kind := range []string{"article", "note"} {
+		for _, test := range tests {
+			got := titles(t, c, test.query(store.NewQuery(kind)))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s %s: got %v, want %v", kind, test.name, got, test.want)
+			}
+		}
+	}
+
+	// Filters on multiple properties match any value.
+	for _, test := range []struct {
+		tag  string
+		want []string
+	}{
+		{"go", []string{"a", "b"}},
+		{"sql", []string{"b", "d"}},
+		{"rust", []string{}},
+	} {
+		got := titles(t, c, store.NewQuery("article").Filter("Tags=", test.tag))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("tag %s: got %v, want %v", test.tag, got, test.want)
+		}
+	}
+
+	alice := store.NewKey("user", "alice", 0, nil)
+	got := titles(t, c, store.NewQuery("article").Filter("AuthorKey=", alice).Order("CreatedOn"))
+	if want := []string{"d", "a", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("author: got %v, want %v", got, want)
+	}
+
+	keys, err := store.NewQuery("note").Filter("IsPublic=", false).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("keys only: got %d keys, want 2", len(keys))
+	}
+	for _, key := range keys {
+		if key.Kind() != "note" || key.Incomplete() {
+			t.Errorf("keys only: got key %v", key)
+		}
+	}
+
+	if _, err := store.NewQuery("note").Filter("IsPublic", true).GetAll(c, &[]Note{}); err == nil {
+		t.Errorf("filter without operator did not fail")
+	}
+}
+
+func testAncestor(t *testing.T, c store.Context) {
+	parent := store.NewKey("blog", "main", 0, nil)
+	other := store.NewKey("blog", "main", 0, store.NewKey("site", "other", 0, nil))
+	for _, kind := range []string{"article", "note"} {
+		for i, p := range []*store.Key{parent, other, parent, nil} {
+			note := &Note{Title: string(rune('a' + i)), CreatedOn: day(-i)}
+			if _, err := store.Put(c, store.NewIncompleteKey(kind, p), note); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got := titles(t, c, store.NewQuery(kind).Ancestor(parent).Order("CreatedOn"))
+		if want := []string{"c", "a"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", kind, got, want)
+		}
+	}
+}
+
+func testZeroTime(t *testing.T, c store.Context) {
+	for _, kind := range []string{"article", "note"} {
+		for _, note := range []*Note{{Title: "b", CreatedOn: day(1)}, {Title: "a"}, {Title: "c", CreatedOn: day(2)}} {
+			if _, err := store.Put(c, store.NewIncompleteKey(kind, nil), note); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got := titles(t, c, store.NewQuery(kind).Order("CreatedOn"))
+		if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", kind, got, want)
+		}
+		got = titles(t, c, store.NewQuery(kind).Filter("CreatedOn <", day(2)).Order("-CreatedOn"))
+		if want := []string{"b", "a"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", kind, got, want)
+		}
+	}
+}
+
+func testCursor(t *testing.T, c store.Context) {
+	putFixtures(t, c)
+
+	queries := []*store.Query{
+		store.NewQuery("article").Order("-CreatedOn"),
+		store.NewQuery("article").Filter("IsPublic=", true).Order("CreatedOn"),
+		store.NewQuery("article").Order("IsPublic").Order("CreatedOn"),
+		store.NewQuery("note").Order("-CreatedOn"),
+		store.NewQuery("note"),
+	}
+	for _, q := range queries {
+		want := titles(t, c, q)
+
+		got := []string{}
+		var cursor store.Cursor
+		for pages := 0; ; pages++ {
+			if pages > len(want) {
+				t.Fatalf("%v: paging does not stop", q.GetKind())
+			}
+			it := q.Start(cursor).Limit(2).Run(c)
+			n := 0
+			for {
+				note := &Note{}
+				_, err := it.Next(note)
+				if err == store.Done {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, note.Title)
+				n++
+			}
+			if n == 0 {
+				break
+			}
+			var err error
+			cursor, err = it.Cursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s %v: paged %v, want %v", q.GetKind(), q.GetOrders(), got, want)
+		}
+	}
+}
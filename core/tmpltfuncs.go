@@ -3,17 +3,26 @@ package core
 import (
 	"fmt"
 	"html/template"
+	"net/url"
 	"time"
 
-	"appengine"
-	"appengine/blobstore"
-	"appengine/user"
 	"github.com/vmihailenco/gforms"
 
+	"auth"
+	"core/store"
 	"tmplt"
 )
 
+var extraTemplateFuncs = template.FuncMap{}
+
+// RegisterTemplateFunc makes f available in all templates under the name.
+// It must be called before templates are rendered, e.g. in init.
+func RegisterTemplateFunc(name string, f interface{}) {
+	extraTemplateFuncs[name] = f
+}
+
 func AddTemplateFuncs(t *template.Template) *template.Template {
+	t = t.Funcs(extraTemplateFuncs)
 	return t.Funcs(template.FuncMap{
 		"now":           now,
 		"formatTime":    formatTime,
@@ -23,8 +32,9 @@ func AddTemplateFuncs(t *template.Template) *template.Template {
 
 		"urlFor":             urlFor,
 		"loginURL":           loginURL,
-		"logoutURL":          logoutURL,
 		"blobstoreUploadURL": blobstoreUploadURL,
+		"csrfField":          csrfField,
+		"csrfToken":          csrfToken,
 
 		"render":      gforms.Render,
 		"renderLabel": gforms.RenderLabel,
@@ -48,6 +58,17 @@ func htmlSafe(text string) template.HTML {
 	return template.HTML(text)
 }
 
+// loginURL returns login page of the only provider or page that lets
+// user choose one.
+func loginURL(context tmplt.Context, redirectTo string) (string, error) {
+	c := context["requestContext"].(store.Context)
+	providers := auth.Providers()
+	if len(providers) == 1 {
+		return providers[0].LoginURL(c, redirectTo)
+	}
+	return auth.LOGIN_PATH + "?" + url.Values{"next": {redirectTo}}.Encode(), nil
+}
+
 func urlFor(name string, pairs ...interface{}) string {
 	size := len(pairs)
 	strPairs := make([]string, size)
@@ -64,22 +85,3 @@ func urlFor(name string, pairs ...interface{}) string {
 	}
 	return url.String()
 }
-
-func loginURL(context tmplt.Context, redirectTo string) (string, error) {
-	c := context["appengineContext"].(appengine.Context)
-	return user.LoginURL(c, redirectTo)
-}
-
-func logoutURL(context tmplt.Context, redirectTo string) (string, error) {
-	c := context["appengineContext"].(appengine.Context)
-	return user.LogoutURL(c, redirectTo)
-}
-
-func blobstoreUploadURL(context tmplt.Context, url string) (string, error) {
-	c := context["appengineContext"].(appengine.Context)
-	uploadURL, err := blobstore.UploadURL(c, url, nil)
-	if err != nil {
-		return "", err
-	}
-	return uploadURL.Path, nil
-}
@@ -1,8 +1,11 @@
 // Generated by CoffeeScript 1.3.1
 (function() {
+  var editor;
+
+  editor = null;
 
   (function() {
-    var $preview, delay, editor, timeout, update;
+    var $preview, delay, timeout, update;
     delay = null;
     timeout = 1000;
     $preview = $('#textHTML');
@@ -42,19 +45,46 @@
   })();
 
   (function() {
-    return $('#Image').fileupload({
-      submit: function(e, data) {
-        var $this;
-        $this = $(this);
-        $.ajax({
-          url: settings.IMAGE_UPLOAD_URL,
-          success: function(result) {
-            data.url = result.url;
-            return $this.fileupload('send', data);
+    var $image, $status, upload;
+    $image = $('#Image');
+    $status = $('#imageUploadStatus');
+    upload = function(file, url) {
+      var data;
+      data = new FormData();
+      data.append('Image', file);
+      return $.ajax({
+        url: url,
+        type: 'POST',
+        data: data,
+        processData: false,
+        contentType: false,
+        success: function(result) {
+          editor.replaceSelection("![" + result.filename + "](" + result.url + ")");
+          $status.text('');
+          return $image.val('');
+        },
+        error: function(xhr) {
+          try {
+            return $status.text(JSON.parse(xhr.responseText).error);
+          } catch (e) {
+            return $status.text('Upload failed.');
           }
-        });
-        return false;
+        }
+      });
+    };
+    return $image.change(function() {
+      var file;
+      file = this.files[0];
+      if (file == null) {
+        return;
       }
+      $status.text('Uploading...');
+      return $.ajax({
+        url: settings.IMAGE_UPLOAD_URL,
+        success: function(result) {
+          return upload(file, result.url);
+        }
+      });
     });
   })();
 